@@ -5,19 +5,19 @@ import (
 	"strings"
 
 	client "github.com/alien45/halo-info-bot/client"
-	"github.com/bwmarrin/discordgo"
 )
 
-func cmdAddress(discord *discordgo.Session, channelID, user, debugTag string, cmdArgs []string, numArgs int) {
-	addresses := data.AddressBook[user]
+func cmdAddress(discord Messenger, channelID, user, lang, debugTag string, args commandArgs) {
+	addresses := state.AddressBook(user)
 	numAddrs := len(addresses)
 	addrMap := map[string]bool{}
-	action := ""
+	action := args.String("action", "")
+	argAddresses := args.List("address")
 	txt := ""
 	var err error
-	if numArgs == 0 {
+	if action == "" && len(argAddresses) == 0 {
 		if numAddrs == 0 {
-			txt = "No addresses available!"
+			txt = tr(lang, "No addresses available!")
 			goto SendMessage
 		}
 		txt = client.DashLine
@@ -26,18 +26,18 @@ func cmdAddress(discord *discordgo.Session, channelID, user, debugTag string, cm
 		}
 		goto SendMessage
 	}
+	if len(argAddresses) == 0 {
+		txt = tr(lang, "No address provided!")
+		goto SendMessage
+	}
 	// Add/Remove addresses
-	action = strings.ToLower(cmdArgs[0])
 	switch action {
 	case "add":
-		if numArgs == 1 {
-			txt = "No address provided!"
-			goto SendMessage
-		} else if numArgs >= 100 {
-			txt = "You have reached the maximum number (100) of items in you address book."
+		if len(argAddresses) >= 100 {
+			txt = tr(lang, "You have reached the maximum number (%d) of items in you address book.", 100)
 			goto SendMessage
 		}
-		addresses = append(addresses, strings.Split(strings.Replace(strings.Join(cmdArgs[1:], " "), "\n", " ", -1), " ")...)
+		addresses = append(addresses, argAddresses...)
 		for i := 0; i < len(addresses); i++ {
 			addrMap[addresses[i]] = true
 		}
@@ -46,30 +46,35 @@ func cmdAddress(discord *discordgo.Session, channelID, user, debugTag string, cm
 		fallthrough
 	case "delete":
 		for i := 0; i < len(addresses); i++ {
-			for a := 1; a < len(cmdArgs); a++ {
-				addrMap[addresses[i]] = addresses[i] != cmdArgs[a]
+			addrMap[addresses[i]] = true
+			for _, address := range argAddresses {
+				if addresses[i] == address {
+					addrMap[addresses[i]] = false
+				}
 			}
 		}
 		break
 	default:
-		txt = "Invalid action. Supported actions: add, remove"
+		txt = tr(lang, "Invalid action. Supported actions: add, remove")
 		goto SendMessage
 	}
 
-	data.AddressBook[user] = []string{}
-	for i := 0; i < len(addresses); i++ {
-		if !addrMap[addresses[i]] || strings.TrimSpace(addresses[i]) == "" {
-			continue
+	err = state.Update(func(data *DiscordData) error {
+		data.AddressBook[user] = []string{}
+		for i := 0; i < len(addresses); i++ {
+			if !addrMap[addresses[i]] || strings.TrimSpace(addresses[i]) == "" {
+				continue
+			}
+			data.AddressBook[user] = append(data.AddressBook[user], addresses[i])
+			delete(addrMap, addresses[i])
 		}
-		data.AddressBook[user] = append(data.AddressBook[user], addresses[i])
-		delete(addrMap, addresses[i])
-	}
-	err = saveDataFile()
+		return nil
+	}, Record{bucketAddressBook, user})
 	if logErrorTS(debugTag, err) {
-		txt = "Failed to save changes!"
+		txt = tr(lang, "Failed to save changes!")
 		goto SendMessage
 	}
-	txt = "Changes saved"
+	txt = tr(lang, "Changes saved")
 SendMessage:
 	discordSend(discord, channelID, "js\n"+txt, true)
 }
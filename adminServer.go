@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/alien45/halo-info-bot/client"
+)
+
+// payoutCheckMaxAge is the maximum duration since the last successful payout check for the bot to be considered
+// healthy. Allows a couple of failed checks due to temporary upstream issues.
+const payoutCheckMaxAge = 3 * payoutCheckInterval
+
+// startedAt is the time the application started
+var startedAt = time.Now()
+
+// healthStatus is the response of the /healthz endpoint
+type healthStatus struct {
+	Healthy bool     `json:"healthy"`
+	Errors  []string `json:"errors,omitempty"`
+	Discord struct {
+		Connected bool      `json:"connected"`
+		Since     time.Time `json:"since"`
+	} `json:"discord"`
+	PayoutCheck struct {
+		Enabled     bool      `json:"enabled"`
+		LastSuccess time.Time `json:"lastsuccess"`
+	} `json:"payoutcheck"`
+}
+
+// cacheStatus describes when a cache was last updated
+type cacheStatus struct {
+	UpdatedAt  time.Time `json:"updatedat"`
+	AgeSeconds float64   `json:"ageseconds"`
+}
+
+// adminStatus is the response of the /status endpoint
+type adminStatus struct {
+	StartedAt       time.Time              `json:"startedat"`
+	UptimeSeconds   float64                `json:"uptimeseconds"`
+	Health          healthStatus           `json:"health"`
+	Caches          map[string]cacheStatus `json:"caches"`
+	RewardPool      client.Payout          `json:"rewardpool"`
+	LastPayout      client.Payout          `json:"lastpayout"`
+	LastAlert       time.Time              `json:"lastalert"`
+	PayoutAlertSubs int                    `json:"payoutalertsubscriptions"`
+	// Payout transaction received from the alert receiver and yet to be processed
+	PayoutTXReceived bool `json:"payouttxreceived"`
+	// Unprocessed entries in the payout transactions file
+	UnprocessedPayoutTXs []client.PayoutTX `json:"unprocessedpayouttxs"`
+	PayoutTXsError       string            `json:"payouttxserror,omitempty"`
+}
+
+// getHealth checks the Discord connection and, if enabled, the payout checker
+func getHealth(now time.Time) (h healthStatus) {
+	h.Discord.Connected, h.Discord.Since = state.Connected()
+	if !h.Discord.Connected {
+		h.Errors = append(h.Errors, "Discord session not connected")
+	}
+	h.PayoutCheck.Enabled = state.MNDApp().CheckPayout
+	h.PayoutCheck.LastSuccess = state.LastPayoutCheck()
+	if h.PayoutCheck.Enabled {
+		// allow time for the first check after start
+		last := h.PayoutCheck.LastSuccess
+		if last.IsZero() {
+			last = startedAt
+		}
+		if now.Sub(last) > payoutCheckMaxAge {
+			h.Errors = append(h.Errors, "Payout check not succeeded since "+client.FormatTS(last))
+		}
+	}
+	h.Healthy = len(h.Errors) == 0
+	return
+}
+
+// getAdminStatus collects the bot's state for inspection
+func getAdminStatus(now time.Time) (s adminStatus) {
+	s.StartedAt = startedAt
+	s.UptimeSeconds = now.Sub(startedAt).Seconds()
+	s.Health = getHealth(now)
+	cacheAge := func(t time.Time) (c cacheStatus) {
+		c.UpdatedAt = t
+		if !t.IsZero() {
+			c.AgeSeconds = now.Sub(t).Seconds()
+		}
+		return
+	}
+	s.Caches = map[string]cacheStatus{
+		client.CacheCMCTickers: cacheAge(state.CMC().CacheUpdatedAt()),
+		client.CacheDEXTickers: cacheAge(state.DEX().TickerCacheUpdatedAt()),
+		client.CacheDEXTokens:  cacheAge(state.DEX().TokenCacheUpdatedAt()),
+		"tier_distribution":    cacheAge(state.MNDApp().TierDistCacheUpdatedAt()),
+	}
+	s.RewardPool = state.RewardPool()
+	s.LastPayout = state.LastPayout()
+	s.LastAlert = state.LastAlert()
+	s.PayoutAlertSubs = len(state.PayoutAlertChannels())
+	_, s.PayoutTXReceived = state.PayoutTX()
+	s.UnprocessedPayoutTXs = []client.PayoutTX{}
+	payoutsTX, err := state.Storage().PayoutTXs()
+	if err != nil {
+		s.PayoutTXsError = err.Error()
+	}
+	for _, tx := range payoutsTX {
+		if !tx.Processed {
+			s.UnprocessedPayoutTXs = append(s.UnprocessedPayoutTXs, tx)
+		}
+	}
+	return
+}
+
+// handleHealthz responds with 200 if healthy, otherwise 503
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	h := getHealth(time.Now())
+	status := http.StatusOK
+	if !h.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, h)
+}
+
+// handleStatus responds with the read-only state of the bot
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, getAdminStatus(time.Now()))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	logErrorTS("AdminServer", encoder.Encode(v))
+}
+
+// startHTTPServers serves the metrics and admin endpoints, if enabled.
+// Both are served by the same server if configured with the same address.
+func startHTTPServers(c *Config) {
+	muxes := map[string]*http.ServeMux{}
+	getMux := func(address string) *http.ServeMux {
+		if muxes[address] == nil {
+			muxes[address] = http.NewServeMux()
+		}
+		return muxes[address]
+	}
+	if c.MetricsAddress != "" {
+		getMux(c.MetricsAddress).Handle("/metrics", metrics)
+		logTS("Metrics", "Serving metrics on "+c.MetricsAddress+"/metrics")
+	}
+	if c.AdminAddress != "" {
+		mux := getMux(c.AdminAddress)
+		mux.HandleFunc("/healthz", handleHealthz)
+		mux.HandleFunc("/status", handleStatus)
+		logTS("AdminServer", "Serving /healthz and /status on "+c.AdminAddress)
+	}
+	for address, mux := range muxes {
+		go func(address string, mux *http.ServeMux) {
+			logErrorTS("HTTPServer", http.ListenAndServe(address, mux))
+		}(address, mux)
+	}
+}
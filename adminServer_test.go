@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdminServer(t *testing.T) {
+	setupCommandTest(t)
+	payoutsTX := `[{"hash": "0x1", "blockNumber": 1, "processed": true}, {"hash": "0x2", "blockNumber": 2}]`
+	err := ioutil.WriteFile(filepath.Join(filepath.Dir(dataFile), "payouts.json"), []byte(payoutsTX), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := *state.Config()
+	c.Client.MNDApp.CheckPayout = true
+	state.SetConfig(&c)
+
+	healthz := func() (status int, h healthStatus) {
+		recorder := httptest.NewRecorder()
+		handleHealthz(recorder, httptest.NewRequest("GET", "/healthz", nil))
+		if err := json.Unmarshal(recorder.Body.Bytes(), &h); err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Code, h
+	}
+	if status, h := healthz(); status != http.StatusServiceUnavailable || h.Discord.Connected {
+		t.Fatalf("expected unhealthy while disconnected, got %d: %+v", status, h)
+	}
+	state.SetConnected(true)
+	if status, h := healthz(); status != http.StatusOK || !h.Healthy {
+		t.Fatalf("expected healthy, got %d: %+v", status, h)
+	}
+	// payout checker wedged
+	state.SetLastPayoutCheck(time.Now().Add(-2 * payoutCheckMaxAge))
+	if status, h := healthz(); status != http.StatusServiceUnavailable || len(h.Errors) != 1 {
+		t.Fatalf("expected unhealthy due to payout check, got %d: %+v", status, h)
+	}
+
+	recorder := httptest.NewRecorder()
+	handleStatus(recorder, httptest.NewRequest("GET", "/status", nil))
+	s := adminStatus{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.UnprocessedPayoutTXs) != 1 || s.UnprocessedPayoutTXs[0].Hash != "0x2" {
+		t.Fatalf("unexpected unprocessed payout transactions: %+v", s.UnprocessedPayoutTXs)
+	}
+	if s.PayoutAlertSubs != len(state.PayoutAlertChannels()) || len(s.Caches) != 4 {
+		t.Fatalf("unexpected status: %+v", s)
+	}
+}
@@ -1,10 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"math"
-	"strconv"
 	"strings"
 	"time"
 
@@ -12,151 +10,145 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
-var payoutTXReceived bool
-var payoutTX client.PayoutTX
-
-func cmdAlert(discord *discordgo.Session, guildID, channelID, userID, username, debugTag string, cmdArgs []string, numArgs int) {
+func cmdAlert(discord Messenger, message *discordgo.MessageCreate, channelID, username, lang, debugTag string,
+	args commandArgs) {
 	// Enable/disable alerts. For personal chat. Possibly for channels as well but should only be setup by admins
-	// TODO: dex status notification // using realtime API
+	// TODO: dex status notification
 	// TODO: feather update notification
-	isRoot := username == conf.Client.DiscordBot.RootUser
-	isAdmin := userHasRole(discord, guildID, userID, guildAdminRole)
+	mndapp := state.MNDApp()
+	guildID, userID := message.GuildID, message.Author.ID
+	isRoot := isRootUser(message.Author)
+	isAdmin := isGuildAdmin(discord, message)
 	allowed := guildID == "" || isAdmin || isRoot
 	txt := ""
-	action := ""
-	alertType := ""
+	alertType := args.String("type", "")
+	action := args.String("action", "")
+	values := args.Floats("value")
 	exists := false
 	saveData := false
 	hostingFeeUSD := 0.00
 	var err error
-	if numArgs == 0 {
-		txt = "Alert type required.\nSupported types: payout"
-		goto AlertMessage
-	}
-	alertType = strings.ToLower(cmdArgs[0])
-	if numArgs < 2 {
-		txt = "Action required"
-		goto AlertMessage
+	_, exists = state.PayoutAlertChannels()[channelID]
+	if action == "" && alertType != "price" {
+		action = "status"
 	}
-	action = strings.ToLower(cmdArgs[1])
-	_, exists = data.Alerts.Payout[channelID]
 
 	switch alertType + " " + action {
 	case "payout hostingfee":
-		if numArgs < 3 {
-			txt = fmt.Sprintf("Hosting fee is set to $%.2f", mndapp.HostingFeeUSD)
+		if len(values) == 0 {
+			txt = tr(lang, "Hosting fee is set to $%s", formatNumber(lang, state.HostingFeeUSD(), 2))
 			goto AlertMessage
 		}
 		if !isRoot {
-			txt = "You are not authorized to change hosting fee"
-			goto AlertMessage
-		}
-		hostingFeeUSD, err = strconv.ParseFloat(strings.Join(strings.Split(cmdArgs[2], "$"), ""), 64)
-		if err != nil {
-			txt = "Please enter a valid number."
+			txt = tr(lang, "You are not authorized to change hosting fee")
 			goto AlertMessage
 		}
-		data.HostingFeeUSD = hostingFeeUSD
-		mndapp.HostingFeeUSD = hostingFeeUSD
-		err = saveDataFile()
-		txt = fmt.Sprintf("Hosting fee changed to $%.2f", hostingFeeUSD)
+		hostingFeeUSD = values[0]
+		before := state.HostingFeeUSD()
+		err = state.Update(func(data *DiscordData) error {
+			data.HostingFeeUSD = hostingFeeUSD
+			return nil
+		}, Record{bucketSettings, recordHostingFee})
+		txt = tr(lang, "Hosting fee changed to $%s", formatNumber(lang, hostingFeeUSD, 2))
 		if err != nil {
-			txt = "Failed to save hosting fee. Please try again later."
+			txt = tr(lang, "Failed to save hosting fee. Please try again later.")
+			break
 		}
+		audit(discord, message, "alert payout hostingfee", "", fmt.Sprint(before), fmt.Sprint(hostingFeeUSD))
 		break
 	case "payout send":
 		if !isRoot {
 			return
 		}
 		// Manually trigger payout alert. Only allowed by the root user
-		if numArgs >= 4 {
+		audit(discord, message, "alert payout send", "", "", strings.Trim(fmt.Sprint(values), "[]"))
+		if len(values) >= 2 {
 			// Minted and fees supplied
-			minted, err := strconv.ParseFloat(cmdArgs[2], 64)
-			if commandErrorIf(err, discord, channelID, "Invalid minted total supplied", debugTag) {
-				return
-			}
-			fees, err := strconv.ParseFloat(cmdArgs[3], 64)
-			if commandErrorIf(err, discord, channelID, "Invalid service fees supplied", debugTag) {
-				return
-			}
-			triggerPayoutsAlert(discord, channelID, minted, fees)
+			triggerPayoutsAlert(discord, channelID, lang, values[0], values[1])
 			return
 		}
-		discordSend(discord, channelID, "Payout alert triggered.", false)
-		total, success, fail := sendPayoutAlerts(discord, mndapp.LastPayout, data.Alerts.Payout)
-		txt = fmt.Sprintf("Payout alert sent. \nTotal channels: %d\nSuccess: %d\nFailed: %d", total, success, fail)
+		discordSend(discord, channelID, tr(lang, "Payout alert triggered."), false)
+		total, success, fail := sendPayoutAlerts(discord, state.LastPayout(), state.PayoutAlertChannels())
+		txt = tr(lang, "Payout alert sent. \nTotal channels: %d\nSuccess: %d\nFailed: %d", total, success, fail)
 		break
 	case "payout update":
 		if !isRoot {
 			return
 		}
-		if numArgs < 4 {
-			txt = "Minted total and service fees required."
+		if len(values) < 2 {
+			txt = tr(lang, "Minted total and service fees required.")
 			break
 		}
-
-		minted, err := strconv.ParseFloat(cmdArgs[2], 64)
-		if commandErrorIf(err, discord, channelID, "Invalid minted total supplied", debugTag) {
-			return
-		}
-		fees, err := strconv.ParseFloat(cmdArgs[3], 64)
-		if commandErrorIf(err, discord, channelID, "Invalid service fees supplied", debugTag) {
-			return
-		}
-		data.LastPayout.Minted = minted
-		data.LastPayout.Fees = fees
-		data.LastPayout.Total = minted + fees
+		minted, fees := values[0], values[1]
+		p := state.LastPayout()
+		audit(discord, message, "alert payout update", "", fmt.Sprintf("minted: %.0f, fees: %.0f", p.Minted, p.Fees),
+			fmt.Sprintf("minted: %.0f, fees: %.0f", minted, fees))
+		p.Minted = minted
+		p.Fees = fees
+		p.Total = minted + fees
 		t1, t2, t3, t4, err := mndapp.GetAllTierDistribution()
-		if commandErrorIf(err, discord, channelID, "Failed to retrieve tier distribution", debugTag) {
+		if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve tier distribution"), debugTag) {
 			return
 		}
-		t1r, t2r, t3r, t4r, duration := mndapp.CalcReward(minted, fees, t1, t2, t3, t4)
-		data.LastPayout.Duration = duration
-		data.LastPayout.Tiers["t1"] = t1r
-		data.LastPayout.Tiers["t2"] = t2r
-		data.LastPayout.Tiers["t3"] = t3r
-		data.LastPayout.Tiers["t4"] = t4r
-		data.LastPayout.HostingFeePerMonth = mndapp.HostingFeeUSD
-		data.LastPayout.HostingFeeHalo,
-			data.LastPayout.HostingFeeUSD,
-			data.LastPayout.Price, _ = getHostingFee(duration)
+		// Use a new map as the previous one is shared with the state
+		p.Tiers = map[string]float64{}
+		p.Tiers["t1"], p.Tiers["t2"], p.Tiers["t3"], p.Tiers["t4"],
+			p.Duration = mndapp.CalcReward(minted, fees, t1, t2, t3, t4)
+		p.HostingFeePerMonth = state.HostingFeeUSD()
+		p.HostingFeeHalo, p.HostingFeeUSD, p.Price, _ = getHostingFee(p.Duration)
 
-		discordSend(discord, channelID, "Payout update triggered.", false)
+		discordSend(discord, channelID, tr(lang, "Payout update triggered."), false)
 		chMsgIDs := map[string]string{}
-		for _, msg := range data.LastPayout.AlertData.Messages {
+		for _, msg := range p.AlertData.Messages {
 			chMsgIDs[msg.ChannelID] = msg.ID
 		}
-		total, success, fail := updatePayoutAlerts(discord, data.LastPayout, chMsgIDs)
-		txt = fmt.Sprintf("Payout alert updated. \nTotal channels: %d\nSuccess: %d\nFailed: %d", total, success, fail)
-		mndapp.LastPayout = data.LastPayout
+		total, success, fail := updatePayoutAlerts(discord, p, chMsgIDs)
+		txt = tr(lang, "Payout alert updated. \nTotal channels: %d\nSuccess: %d\nFailed: %d", total, success, fail)
 		break
 	case "payout on":
 		if !allowed {
-			txt = "You do not have permission to enable alerts on this channel."
+			txt = tr(lang, "You do not have permission to enable alerts on this channel.")
 			goto AlertMessage
 		}
-		data.Alerts.Payout[channelID] = fmt.Sprintf("%s#%s@%s|%s", guildID, channelID, username, userID)
-		txt = "Payout alert is turned on"
+		err = state.Update(func(data *DiscordData) error {
+			data.Alerts.Payout[channelID] = fmt.Sprintf("%s#%s@%s|%s", guildID, channelID, username, userID)
+			return nil
+		}, Record{bucketPayoutAlerts, channelID})
+		txt = tr(lang, "Payout alert is turned on")
 		saveData = true
+		if err == nil && guildID != "" {
+			audit(discord, message, "alert payout on", "#"+channelID, onOff(exists), "on")
+		}
 		break
 	case "payout off":
-		delete(data.Alerts.Payout, channelID)
-		txt = "Payout alert is turned off"
+		err = state.Update(func(data *DiscordData) error {
+			delete(data.Alerts.Payout, channelID)
+			return nil
+		}, Record{bucketPayoutAlerts, channelID})
+		txt = tr(lang, "Payout alert is turned off")
 		saveData = true
+		if err == nil && guildID != "" {
+			audit(discord, message, "alert payout off", "#"+channelID, onOff(exists), "off")
+		}
 		break
 	case "payout status":
-		txt = "Payout alert is turned off"
+		txt = tr(lang, "Payout alert is turned off")
 		if exists {
-			txt = "Payout alert is turned on"
+			txt = tr(lang, "Payout alert is turned on")
 		}
 		break
+	case "trades on", "trades off", "trades status":
+		cmdTradeAlert(discord, message, channelID, username, lang, debugTag, action, args, allowed)
+		return
+	case "price ", "price list", "price remove":
+		cmdPriceAlert(discord, message, lang, debugTag, action, args)
+		return
 	default:
-		txt = "Not implemented or unavailable"
+		txt = tr(lang, "Not implemented or unavailable")
 		break
 	}
 	if saveData {
-		err = saveDataFile()
-		if commandErrorIf(err, discord, channelID, "Failed to save preferences", debugTag) {
+		if commandErrorIf(err, discord, channelID, tr(lang, "Failed to save preferences"), debugTag) {
 			return
 		}
 	}
@@ -164,22 +156,26 @@ AlertMessage:
 	discordSend(discord, channelID, txt, true)
 }
 
+// payoutCheckInterval is the duration between payout checks
+const payoutCheckInterval = 120 * time.Second
+
 // discordInterval invoke a function periodically and only supplies Discord session as parameter
-func discordInterval(discord *discordgo.Session, seconds int, executeOnInit bool, f func(discord *discordgo.Session)) {
+func discordInterval(discord Messenger, seconds int, executeOnInit bool, f func(discord Messenger)) {
 	if executeOnInit {
 		f(discord)
 	}
 	// Execute on interval
-	for range time.Tick(time.Second * 120) {
+	for range time.Tick(payoutCheckInterval) {
 		f(discord)
 	}
 }
 
 // Check if payout occured and send alert messages
-func checkPayout(discord *discordgo.Session) {
-	if !payoutTXReceived {
+func checkPayout(discord Messenger) {
+	if _, received := state.PayoutTX(); !received {
 		checkPayoutEvent(discord)
 	}
+	mndapp := state.MNDApp()
 	debugTag := "CheckPayout"
 	mintedTime := time.Now().UTC()
 	minted, err := mndapp.GetMintedBalance()
@@ -187,24 +183,23 @@ func checkPayout(discord *discordgo.Session) {
 		logTS(debugTag+"] [GetMintedBalance", fmt.Sprint("Minted: ", minted, " [Error]: ", err))
 		return
 	}
+	state.SetLastPayoutCheck(mintedTime)
 
 	fees, err := mndapp.GetServiceFeesBalance()
 	logErrorTS(debugTag+"] [GetServiceFeesBalance", err)
-	prevRP := mndapp.RewardPool
+	prevRP := state.RewardPool()
 	// Payout minimum 8 hours in minutes
 	// minDuration := 8 * 60 / mndapp.BlockTimeMins
 	// minPayout := mndapp.BlockReward * minDuration
 	// Duration in minutes by calculating minted balance
 	mintedDur := (minted / mndapp.BlockReward) * mndapp.BlockTimeMins
 	// Duration in minutes since last payout
-	lastDur := mintedTime.Sub(data.LastPayout.Time).Minutes()
+	lastDur := mintedTime.Sub(state.LastPayout().Time).Minutes()
 	// If Duration since last payout matches calculated duration from minted balance with +-block time
 	validDiff := (lastDur-mndapp.BlockTimeMins) <= mintedDur || (lastDur+mndapp.BlockTimeMins) >= mintedDur
 	if validDiff {
 		// Prevent storing if API returned incorrect data from testnet
-		mndapp.RewardPool.Minted = minted
-		mndapp.RewardPool.Fees = fees
-		mndapp.RewardPool.Time = mintedTime
+		state.SetRewardPool(minted, fees, mintedTime)
 	} else {
 		debugTag += "] [FalsePositive"
 	}
@@ -212,6 +207,7 @@ func checkPayout(discord *discordgo.Session) {
 	logTS(debugTag, fmt.Sprintf(
 		"Total: %.0f | Minted: %.0f | Fees: %.0f | Time: %s",
 		minted+fees, minted, fees, client.FormatTS(mintedTime)))
+	payoutTX, payoutTXReceived := state.PayoutTX()
 	if !payoutTXReceived || prevRP.Minted == 0 {
 		return
 	}
@@ -238,7 +234,7 @@ func checkPayout(discord *discordgo.Session) {
 	p.TierNodes["t2"] = t2
 	p.TierNodes["t3"] = t3
 	p.TierNodes["t4"] = t4
-	p.HostingFeePerMonth = mndapp.HostingFeeUSD
+	p.HostingFeePerMonth = state.HostingFeeUSD()
 	p.HostingFeeHalo, p.HostingFeeUSD, p.Price, _ = getHostingFee(p.Duration)
 	// Log
 	logTS(debugTag, fmt.Sprintf("Total: %.0f | Minted: %.0f | Fees: %.0f | Time: %s | "+
@@ -253,27 +249,33 @@ func checkPayout(discord *discordgo.Session) {
 	}
 	p.Time = payoutTX.TS
 	p.BlockNumber = payoutTX.BlockNumber
-	sendPayoutAlerts(discord, p, data.Alerts.Payout)
-	mndapp.LastAlert = p.Time
-	mndapp.LastPayout = data.LastPayout
-	payoutTXReceived = false
+	sendPayoutAlerts(discord, p, state.PayoutAlertChannels())
+	state.SetLastAlert(p.Time)
 	logErrorTS("setPTXProcessed", setPTXProcessed())
 }
-func triggerPayoutsAlert(discord *discordgo.Session, userChannelID string, minted, fees float64) {
+
+// triggerPayoutsAlert sends a payout alert manually using the supplied minted total and service fees
+func triggerPayoutsAlert(discord Messenger, userChannelID, lang string, minted, fees float64) {
 	debugTag := "sendPayoutsManual"
+	mndapp := state.MNDApp()
 	minimumMinted := 8 * 60 * mndapp.BlockReward / mndapp.BlockTimeMins
 	if minted == 0 || minted < minimumMinted {
-		_, err := discordSend(discord, userChannelID, fmt.Sprintf("Minted total required and must greater than or equal to %.0f", minimumMinted), true)
+		_, err := discordSend(discord, userChannelID, tr(lang,
+			"Minted total required and must be greater than or equal to %s", formatNumber(lang, minimumMinted, 0)), true)
 		logErrorTS(debugTag, err)
 		return
 	}
 	t1, t2, t3, t4, err := mndapp.GetAllTierDistribution()
-	if commandErrorIf(err, discord, userChannelID, "Failed to retrieve tier distribution. Try again.", debugTag) {
+	if commandErrorIf(err, discord, userChannelID, tr(lang, "Failed to retrieve tier distribution. Try again."),
+		debugTag) {
 		return
 	}
 	if t1 == 0 || t2 == 2 || t3 == 0 || t4 == 0 {
-		_, err = discordSend(discord, userChannelID, fmt.Sprintf("Invalid tier distribution received.\n"+
-			"Tier 1 :%.0f \nTier 2: %.0f \nTier 3: %.0f \nTier 4: %.0f", t1, t2, t3, t4), true)
+		txt := tr(lang, "Invalid tier distribution received.")
+		for i, n := range []float64{t1, t2, t3, t4} {
+			txt += "\n" + tr(lang, "Tier %d: %s", i+1, formatNumber(lang, n, 0))
+		}
+		_, err = discordSend(discord, userChannelID, txt, true)
 		logErrorTS(debugTag, err)
 		return
 	}
@@ -289,31 +291,37 @@ func triggerPayoutsAlert(discord *discordgo.Session, userChannelID string, minte
 	p.TierNodes["t2"] = t2
 	p.TierNodes["t3"] = t3
 	p.TierNodes["t4"] = t4
-	p.HostingFeePerMonth = mndapp.HostingFeeUSD
+	p.HostingFeePerMonth = state.HostingFeeUSD()
 	p.HostingFeeHalo, p.HostingFeeUSD, p.Price, _ = getHostingFee(p.Duration)
-	if payoutTXReceived {
+	if payoutTX, received := state.PayoutTX(); received {
 		p.BlockNumber = payoutTX.BlockNumber
 		p.Time = payoutTX.TS
 	}
-	mndapp.LastPayout = p
-	mndapp.LastAlert = p.Time
-	data.LastPayout = p
-	total, success, fail := sendPayoutAlerts(discord, p, data.Alerts.Payout)
-	txt := fmt.Sprintf("Payout alert sent. \nTotal channels: %d\nSuccess: %d\nFailed: %d", total, success, fail)
+	state.SetLastAlert(p.Time)
+	total, success, fail := sendPayoutAlerts(discord, p, state.PayoutAlertChannels())
+	txt := tr(lang, "Payout alert sent. \nTotal channels: %d\nSuccess: %d\nFailed: %d", total, success, fail)
 	_, err = discordSend(discord, userChannelID, txt, true)
 	logErrorTS(debugTag, err)
-	payoutTXReceived = false
 	logErrorTS("setPTXProcessed", setPTXProcessed())
 }
 
 // sendPayoutAlerts sends out Discord payout alert to subscribed channels and users
-func sendPayoutAlerts(discord *discordgo.Session, p client.Payout, channels map[string]string) (total, success, fail int) {
+func sendPayoutAlerts(discord Messenger, p client.Payout, channels map[string]string) (total, success, fail int) {
 	total = len(channels)
 	msgs := []client.Message{}
-	txt := p.FormatAlert(fmt.Sprintf("%s/block/%d\n", explorer.Homepage, p.BlockNumber))
+	blockURL := fmt.Sprintf("%s/block/%d\n", state.Explorer().Homepage, p.BlockNumber)
 	for channelID, name := range channels {
 		msg := client.Message{ChannelID: channelID}
-		dmsg, err := discordSend(discord, channelID, txt, false)
+		lang := alertLanguage(name)
+		var dmsg *discordgo.Message
+		var err error
+		if useEmbeds(alertGuildID(name)) {
+			dmsg, err = discord.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+				Embeds: []*discordgo.MessageEmbed{payoutEmbed(lang, p)},
+			})
+		} else {
+			dmsg, err = discordSend(discord, channelID, p.FormatAlert(localizer(lang), blockURL), false)
+		}
 		if err != nil {
 			logTS("PayoutAlert", fmt.Sprintf("Payout Alert Failed! Channel ID: %s, Name: %s", channelID, name))
 			msg.Error = err.Error()
@@ -326,32 +334,56 @@ func sendPayoutAlerts(discord *discordgo.Session, p client.Payout, channels map[
 	}
 	fail = total - success
 	logTS("PayoutAlertSummary", fmt.Sprintf("Total channels: %d | Success: %d | Failure: %d", total, success, fail))
+	metricPayoutAlerts.Add(float64(success), "send", "success")
+	metricPayoutAlerts.Add(float64(fail), "send", "fail")
 
 	// update last payout details to json file
 	p.AlertData.Messages = msgs
 	p.AlertData.Total = total
 	p.AlertData.SuccessCount = success
 	p.AlertData.FailCount = fail
-	data.LastPayout = p
-	mndapp.LastPayout = p
-	err := saveDataFile()
+	err := state.SetLastPayout(p)
 	if err != nil {
 		logTS("FileSaveError", fmt.Sprintf("Failed to save Payout Data to %s: %+v | [Error]: %v", dataFile, p, err))
 	}
 
 	// save to payouts log
-	addPayoutLog(p)
+	logErrorTS("addPayoutLog", state.Storage().AddPayoutLog(p))
 	return
 }
 
+// alertGuildID returns the guild ID of an alert subscription. Empty if subscribed by private message.
+// Subscription format: guildID#channelID@username|userID
+func alertGuildID(subscription string) string {
+	return strings.SplitN(subscription, "#", 2)[0]
+}
+
+// alertLanguage returns the language of the user that subscribed to an alert, or the language of the guild
+func alertLanguage(subscription string) string {
+	userID := ""
+	if i := strings.LastIndex(subscription, "|"); i >= 0 {
+		userID = subscription[i+1:]
+	}
+	return state.Language(alertGuildID(subscription), userID)
+}
+
 // updatePayoutAlerts sends out Discord payout alert to subscribed channels and users
-func updatePayoutAlerts(discord *discordgo.Session, p client.Payout, channelMsgIDs map[string]string) (total, success, fail int) {
+func updatePayoutAlerts(discord Messenger, p client.Payout, channelMsgIDs map[string]string) (total, success, fail int) {
 	total = len(channelMsgIDs)
 	msgs := []client.Message{}
-	txt := p.FormatAlert(fmt.Sprintf("%s/block/%d\n", explorer.Homepage, p.BlockNumber))
+	blockURL := fmt.Sprintf("%s/block/%d\n", state.Explorer().Homepage, p.BlockNumber)
+	channels := state.PayoutAlertChannels()
 	for channelID, msgID := range channelMsgIDs {
 		msg := client.Message{ChannelID: channelID}
-		nmsg, err := discord.ChannelMessageEdit(channelID, msgID, txt)
+		lang := alertLanguage(channels[channelID])
+		txt := p.FormatAlert(localizer(lang), blockURL)
+		// replaces both content and embeds in case the output style has changed since sent
+		edit := &discordgo.MessageEdit{ID: msgID, Channel: channelID, Content: &txt, Embeds: []*discordgo.MessageEmbed{}}
+		if useEmbeds(alertGuildID(channels[channelID])) {
+			empty := ""
+			edit.Content, edit.Embeds = &empty, []*discordgo.MessageEmbed{payoutEmbed(lang, p)}
+		}
+		nmsg, err := discord.ChannelMessageEditComplex(edit)
 		if err != nil {
 			logTS("PayoutAlert", fmt.Sprintf("Payout Alert Failed! Channel ID: %s", channelID))
 			msg.Error = err.Error()
@@ -364,35 +396,36 @@ func updatePayoutAlerts(discord *discordgo.Session, p client.Payout, channelMsgI
 	}
 	fail = total - success
 	logTS("PayoutAlertSummary", fmt.Sprintf("Total channels: %d | Success: %d | Failure: %d", total, success, fail))
+	metricPayoutAlerts.Add(float64(success), "update", "success")
+	metricPayoutAlerts.Add(float64(fail), "update", "fail")
 
 	// update last payout details to json file
 	p.AlertData.Messages = msgs
 	p.AlertData.Total = total
 	p.AlertData.SuccessCount = success
 	p.AlertData.FailCount = fail
-	data.LastPayout = p
-	err := saveDataFile()
+	err := state.SetLastPayout(p)
 	if err != nil {
 		logTS("FileSaveError", fmt.Sprintf("Failed to save Payout Data to %s: %+v | [Error]: %v", dataFile, p, err))
 	}
 
 	// save to payouts log
-	addPayoutLog(p)
+	logErrorTS("addPayoutLog", state.Storage().AddPayoutLog(p))
 	return
 }
 
 // GetHostingFee estimates the Halo Platform hosting fee for each node using current price from HaloDEX
 func getHostingFee(durationStr string) (feeHalo, feeUSD, haloUSD float64, err error) {
 	hours := durationToNum(durationStr)
-	eth, err := cmc.GetTicker("ETH")
+	eth, err := state.Prices().GetPrice("ETH")
 	if err != nil {
 		return
 	}
-	ticker, err := dex.GetTicker("HALO", "ETH", eth.Quote["USD"].Price, 1)
+	ticker, err := state.DEX().GetTicker("HALO", "ETH", eth.USD, 1)
 	if err != nil {
 		return
 	}
-	feesPerHour := mndapp.HostingFeeUSD / 30 / 24
+	feesPerHour := state.HostingFeeUSD() / 30 / 24
 	feeUSD = math.Ceil(hours) * feesPerHour
 	haloUSD = ticker.LastPriceUSD
 	feeHalo = feeUSD / haloUSD
@@ -409,9 +442,9 @@ func durationToNum(durationStr string) float64 {
 	return duration.Minutes() / 60
 }
 
-func checkPayoutEvent(discord *discordgo.Session) bool {
+func checkPayoutEvent(discord Messenger) bool {
 	debugTag := "checkPayoutEvent"
-	payoutsTX, err := getPayoutTXs()
+	payoutsTX, err := state.Storage().PayoutTXs()
 	if logErrorTS(debugTag+"] [FileReadError", err) {
 		return false
 	}
@@ -422,47 +455,20 @@ func checkPayoutEvent(discord *discordgo.Session) bool {
 	}
 	ptx := payoutsTX[l-1]
 	logTS(debugTag+"] [PayoutReceived", fmt.Sprintf("Block: %d, Time: %v", ptx.BlockNumber, ptx.TS))
-	payoutTXReceived = true
-	payoutTX = ptx
+	state.SetPayoutTX(ptx)
 
-	if conf.DebugChannelID != "" {
-		discordSend(discord, conf.DebugChannelID, fmt.Sprintf("Payout TX: %+v", ptx), true)
+	if debugChannelID := state.Config().DebugChannelID; debugChannelID != "" {
+		discordSend(discord, debugChannelID, fmt.Sprintf("Payout TX: %+v", ptx), true)
 	}
 	return true
 }
 
-func getPayoutTXs() (payoutsTX []client.PayoutTX, err error) {
-	str, err := client.ReadFile(payoutsTXFile)
-	if err != nil {
-		return
-	}
-	err = json.Unmarshal([]byte(str), &payoutsTX)
-	return
-}
-
+// setPTXProcessed marks the received payout transaction as processed
 func setPTXProcessed() (err error) {
-	payoutsTX, err := getPayoutTXs()
-	if err != nil {
-		return
-	}
-	payoutsTX[len(payoutsTX)-1].Processed = true
-	client.SaveJSONFileLarge(payoutsTXFile, payoutsTX)
-	return
-}
-
-func addPayoutLog(p client.Payout) (err error) {
-	str, err := client.ReadFile(payoutLogFile)
-	if err != nil {
-		return
-	}
-	if str == "" {
-		str = "[]"
-	}
-	payouts := []client.Payout{}
-	err = json.Unmarshal([]byte(str), &payouts)
-	if err != nil {
+	tx, received := state.PayoutTX()
+	state.PayoutTXProcessed()
+	if !received {
 		return
 	}
-	payouts = append(payouts, p)
-	return client.SaveJSONFileLarge(payoutLogFile, payouts)
+	return state.Storage().SetPayoutTXProcessed(tx)
 }
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Argument types supported by the argument specification. Eg: "[limit:int(1,50)]".
+const (
+	// Any text. Default type. The last argument of the specification absorbs the rest of the message.
+	argText = "text"
+	// Whole number with optional range. Eg: int(1,50)
+	argInt = "int"
+	// Decimal number. A leading "$" is ignored.
+	argNumber = "number"
+	// Token/coin symbol. Converted to upper case.
+	argTicker = "ticker"
+	// Halo/Ethereum address, address keyword (eg: reward-pool) or address book item number
+	argAddress = "address"
+	// Same as argAddress but also accepts addresses of other chains. Eg: BTC, LTC
+	argWallet = "wallet"
+	// Address book item number
+	argIndex = "index"
+)
+
+var (
+	// Eg: "quote-ticker:ticker", "limit:int(1,50)", "address...", "address:address..."
+	argAlternativeRegex = regexp.MustCompile(`^([a-z0-9-]+)(?::([a-z]+)(?:\((-?\d+),(-?\d+)\))?)?(\.{3,})?$`)
+	argGroupNameRegex   = regexp.MustCompile(`^([a-z0-9-]+):\{`)
+	tickerRegex         = regexp.MustCompile(`^[A-Za-z0-9]{2,10}$`)
+	hexAddressRegex     = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	walletAddressRegex  = regexp.MustCompile(`^[A-Za-z0-9]{26,64}$`)
+)
+
+// argAlternative is a named and typed argument or an exact keyword
+type argAlternative struct {
+	Name    string
+	Keyword bool
+	Type    string
+	// Range of int arguments, if HasRange is true
+	Min, Max int64
+	HasRange bool
+}
+
+// argElement is a required or optional argument with one or more alternatives.
+// Eg: "<address>", "[{config}|{commands}|{data}]"
+type argElement struct {
+	// Name used to retrieve the value. For keywords, the value is also available using the keyword as name.
+	Name         string
+	Required     bool
+	Variadic     bool
+	Alternatives []argAlternative
+}
+
+// argSpec is the parsed form of Command.ArgumentsText. Elements are matched in order. Optional elements are skipped
+// if the supplied argument does not match.
+type argSpec []argElement
+
+// commandArgs contains the validated arguments by name. Values are normalised. Eg: tickers are in upper case,
+// address book item numbers and address keywords are replaced with the addresses.
+type commandArgs map[string][]string
+
+// argError is an invalid argument error along with the position of the argument.
+// The message is kept as the format and the arguments, so that it can be translated.
+type argError struct {
+	Position int
+	Format   string
+	Args     []interface{}
+	// weak errors are replaced by other errors of the same position. Eg: an optional keyword not matching.
+	weak bool
+}
+
+// argErrorf returns an argument error formatted according to the format
+func argErrorf(format string, args ...interface{}) *argError {
+	return &argError{Format: format, Args: args}
+}
+
+func (e *argError) Error() string {
+	return fmt.Sprintf(e.Format, e.Args...)
+}
+
+// Translate returns the error message in the language
+func (e *argError) Translate(lang string) string {
+	return tr(lang, e.Format, e.Args...)
+}
+
+// parseArgSpec parses the argument specification text. See Command.ArgumentsText for the grammar.
+// Arguments may specify a type and groups of keywords may specify a name.
+// Eg: "[target:{config}|{commands}] <address:address> [limit:int(1,50)] [ticker:ticker...]"
+func parseArgSpec(text string) (spec argSpec, err error) {
+	for _, item := range strings.Fields(text) {
+		el := argElement{}
+		switch {
+		case strings.HasPrefix(item, "<") && strings.HasSuffix(item, ">"):
+			el.Required = true
+		case strings.HasPrefix(item, "[") && strings.HasSuffix(item, "]"):
+		case strings.HasPrefix(item, "{") && strings.HasSuffix(item, "}"):
+			// keyword without brackets is required
+			el.Required = true
+			item = "<" + item + ">"
+		default:
+			return nil, fmt.Errorf("Invalid argument: %s", item)
+		}
+		content := item[1 : len(item)-1]
+		if m := argGroupNameRegex.FindStringSubmatch(content); m != nil {
+			el.Name = m[1]
+			content = strings.TrimPrefix(content, m[1]+":")
+		}
+		for _, alt := range strings.Split(content, "|") {
+			a := argAlternative{}
+			if strings.HasPrefix(alt, "{") && strings.HasSuffix(alt, "}") {
+				a.Keyword = true
+				a.Name = strings.ToLower(alt[1 : len(alt)-1])
+				el.Alternatives = append(el.Alternatives, a)
+				continue
+			}
+			m := argAlternativeRegex.FindStringSubmatch(alt)
+			if m == nil {
+				return nil, fmt.Errorf("Invalid argument: %s", item)
+			}
+			a.Name, a.Type = m[1], m[2]
+			if a.Type == "" {
+				a.Type = argText
+			}
+			if !isArgType(a.Type) {
+				return nil, fmt.Errorf("Invalid argument type: %s", a.Type)
+			}
+			if m[3] != "" {
+				a.HasRange = true
+				a.Min, _ = strconv.ParseInt(m[3], 10, 64)
+				a.Max, _ = strconv.ParseInt(m[4], 10, 64)
+			}
+			el.Variadic = el.Variadic || m[5] != ""
+			el.Alternatives = append(el.Alternatives, a)
+		}
+		if el.Name == "" {
+			el.Name = el.Alternatives[0].Name
+		}
+		spec = append(spec, el)
+	}
+	return
+}
+
+func isArgType(t string) bool {
+	switch t {
+	case argText, argInt, argNumber, argTicker, argAddress, argWallet, argIndex:
+		return true
+	}
+	return false
+}
+
+// String returns the specification as displayed to the users. Names of the keyword groups and types are omitted.
+// Eg: "[{config}|{commands}] <address> [limit] [ticker...]"
+func (s argSpec) String() string {
+	items := []string{}
+	for _, el := range s {
+		alts := []string{}
+		for _, a := range el.Alternatives {
+			if a.Keyword {
+				alts = append(alts, "{"+a.Name+"}")
+				continue
+			}
+			alts = append(alts, a.Name)
+		}
+		item := strings.Join(alts, "|")
+		if el.Variadic {
+			item += "..."
+		}
+		if el.Required {
+			item = "<" + item + ">"
+		} else {
+			item = "[" + item + "]"
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, " ")
+}
+
+// Parse validates the supplied arguments against the specification.
+// Addresses are the user's address book items used to resolve address book item numbers.
+func (s argSpec) Parse(line commandLine, addresses []string) (commandArgs, error) {
+	m := &argMatcher{spec: s, line: line, args: line.Args, addresses: addresses}
+	result := commandArgs{}
+	if m.match(0, 0, result) {
+		return result, nil
+	}
+	return nil, m.err
+}
+
+// argMatcher matches the arguments with the elements of the specification. If an optional element does not match,
+// the rest of the elements are matched without it. Repeated elements give up their last values to the following
+// elements if required.
+type argMatcher struct {
+	spec      argSpec
+	line      commandLine
+	args      []string
+	addresses []string
+	// error of the furthest argument that failed to match
+	err *argError
+}
+
+func (m *argMatcher) match(elIndex, argIndex int, result commandArgs) bool {
+	if elIndex == len(m.spec) {
+		if argIndex < len(m.args) {
+			m.fail(argIndex, argErrorf("Unexpected argument: %s", m.args[argIndex]), true)
+			return false
+		}
+		return true
+	}
+	el := m.spec[elIndex]
+	if argIndex < len(m.args) {
+		var keys []string
+		var consumed int
+		if el.Variadic {
+			// names the values were added as, by argument
+			accepted := [][]string{}
+			for _, arg := range m.args[argIndex:] {
+				k, err := m.accept(el, arg, result)
+				if err != nil {
+					m.fail(argIndex+len(accepted), err, false)
+					break
+				}
+				accepted = append(accepted, k)
+			}
+			// the last values are left to the rest of the elements if they do not match otherwise
+			for n := len(accepted); n > 0; n-- {
+				if m.match(elIndex+1, argIndex+n, result) {
+					return true
+				}
+				for _, k := range accepted[n-1] {
+					result[k] = result[k][:len(result[k])-1]
+					if len(result[k]) == 0 {
+						delete(result, k)
+					}
+				}
+			}
+		} else if elIndex == len(m.spec)-1 && len(el.Alternatives) == 1 && el.Alternatives[0].Type == argText {
+			// last text argument absorbs the rest of the message
+			result[el.Name] = []string{m.line.Remainder(argIndex)}
+			keys, consumed = []string{el.Name}, len(m.args)-argIndex
+		} else if k, err := m.accept(el, m.args[argIndex], result); err != nil {
+			m.fail(argIndex, err, !el.Required && el.isKeywords())
+		} else {
+			keys, consumed = k, 1
+		}
+		if consumed > 0 {
+			if m.match(elIndex+1, argIndex+consumed, result) {
+				return true
+			}
+		}
+		for _, k := range keys {
+			delete(result, k)
+		}
+	}
+	if el.Required {
+		if argIndex >= len(m.args) {
+			m.fail(argIndex, argErrorf("Argument required: %s", argSpec{el}), false)
+		}
+		return false
+	}
+	return m.match(elIndex+1, argIndex, result)
+}
+
+// fail keeps the error of the furthest argument
+func (m *argMatcher) fail(position int, err *argError, weak bool) {
+	if m.err == nil || position > m.err.Position || (position == m.err.Position && m.err.weak && !weak) {
+		err.Position, err.weak = position, weak
+		m.err = err
+	}
+}
+
+// isKeywords checks if all alternatives of the element are keywords
+func (el argElement) isKeywords() bool {
+	for _, a := range el.Alternatives {
+		if !a.Keyword {
+			return false
+		}
+	}
+	return true
+}
+
+// accept validates the argument against the alternatives of the element and adds the value to the result.
+// Returns the names the value was added as.
+func (m *argMatcher) accept(el argElement, arg string, result commandArgs) (keys []string, err *argError) {
+	keywords := []string{}
+	for _, a := range el.Alternatives {
+		if a.Keyword {
+			keywords = append(keywords, a.Name)
+			if strings.ToLower(arg) != a.Name {
+				continue
+			}
+			result[el.Name] = append(result[el.Name], a.Name)
+			keys = []string{el.Name}
+			if a.Name != el.Name {
+				result[a.Name] = append(result[a.Name], a.Name)
+				keys = append(keys, a.Name)
+			}
+			return
+		}
+		value, erra := m.validate(a, arg)
+		if erra != nil {
+			if err == nil {
+				err = erra
+			}
+			continue
+		}
+		result[a.Name] = append(result[a.Name], value)
+		return []string{a.Name}, nil
+	}
+	if err == nil {
+		err = argErrorf("Invalid %s: %s. Expected: %s", el.Name, arg, strings.Join(keywords, ", "))
+	}
+	return nil, err
+}
+
+// validate checks the argument against the type and returns the normalised value
+func (m *argMatcher) validate(a argAlternative, arg string) (value string, err *argError) {
+	switch a.Type {
+	case argInt:
+		n, errp := strconv.ParseInt(arg, 10, 64)
+		if errp != nil || (a.HasRange && (n < a.Min || n > a.Max)) {
+			if a.HasRange {
+				return "", argErrorf("Invalid %s: %s. Expected a whole number between %d and %d", a.Name, arg, a.Min,
+					a.Max)
+			}
+			return "", argErrorf("Invalid %s: %s. Expected a whole number", a.Name, arg)
+		}
+		return fmt.Sprint(n), nil
+	case argNumber:
+		n, errp := strconv.ParseFloat(strings.TrimPrefix(arg, "$"), 64)
+		if errp != nil {
+			return "", argErrorf("Invalid %s: %s. Expected a number", a.Name, arg)
+		}
+		return fmt.Sprint(n), nil
+	case argTicker:
+		if !tickerRegex.MatchString(arg) || strings.Trim(arg, "0123456789") == "" {
+			return "", argErrorf("Invalid %s: %s. Expected a ticker", a.Name, arg)
+		}
+		return strings.ToUpper(arg), nil
+	case argIndex:
+		return m.addressBookItem(a, arg)
+	case argAddress, argWallet:
+		if hexAddressRegex.MatchString(arg) || (a.Type == argWallet && walletAddressRegex.MatchString(arg)) {
+			return arg, nil
+		}
+		if address, found := state.AddressKeyword(strings.ToLower(arg)); found {
+			return address, nil
+		}
+		if _, err := strconv.Atoi(arg); err == nil {
+			return m.addressBookItem(a, arg)
+		}
+		return "", argErrorf("Invalid %s: %s. Expected an address, address keyword or address book item number",
+			a.Name, arg)
+	}
+	return arg, nil
+}
+
+// addressBookItem returns the address of the address book item number
+func (m *argMatcher) addressBookItem(a argAlternative, arg string) (string, *argError) {
+	i, err := strconv.Atoi(arg)
+	if err != nil || i < 1 || i > len(m.addresses) {
+		if len(m.addresses) == 0 {
+			return "", argErrorf("Invalid %s: %s. Your address book is empty", a.Name, arg)
+		}
+		return "", argErrorf("Invalid %s: %s. Expected an address book item number between 1 and %d",
+			a.Name, arg, len(m.addresses))
+	}
+	return m.addresses[i-1], nil
+}
+
+// Has checks if the argument or keyword is supplied
+func (a commandArgs) Has(name string) bool {
+	return len(a[name]) > 0
+}
+
+// String returns the first value of the argument or defaultValue if not supplied
+func (a commandArgs) String(name, defaultValue string) string {
+	if !a.Has(name) {
+		return defaultValue
+	}
+	return a[name][0]
+}
+
+// List returns all values of the argument
+func (a commandArgs) List(name string) []string {
+	return a[name]
+}
+
+// Int returns the first value of an int argument or defaultValue if not supplied
+func (a commandArgs) Int(name string, defaultValue int64) int64 {
+	n, err := strconv.ParseInt(a.String(name, ""), 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
+
+// Float returns the first value of a number argument or defaultValue if not supplied
+func (a commandArgs) Float(name string, defaultValue float64) float64 {
+	n, err := strconv.ParseFloat(a.String(name, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
+
+// Floats returns all values of a number argument
+func (a commandArgs) Floats(name string) (numbers []float64) {
+	for _, s := range a[name] {
+		n, _ := strconv.ParseFloat(s, 64)
+		numbers = append(numbers, n)
+	}
+	return
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArgSpecParse(t *testing.T) {
+	setupCommandTest(t)
+	addresses := []string{"0x1111111111111111111111111111111111111111", "0x2222222222222222222222222222222222222222"}
+	tests := []struct {
+		spec     string
+		args     string
+		expected commandArgs
+		err      string
+	}{
+		{
+			spec:     "[quote-ticker:ticker] [base-ticker:ticker] [limit:int(1,50)] [page-no:int(1,1000)]",
+			args:     "halo eth 20 2",
+			expected: commandArgs{"quote-ticker": {"HALO"}, "base-ticker": {"ETH"}, "limit": {"20"}, "page-no": {"2"}},
+		},
+		{
+			// optional arguments are skipped if not matched
+			spec:     "[quote-ticker:ticker] [base-ticker:ticker] [limit:int(1,50)] [page-no:int(1,1000)]",
+			args:     "halo 20",
+			expected: commandArgs{"quote-ticker": {"HALO"}, "limit": {"20"}},
+		},
+		{
+			spec: "[quote-ticker:ticker] [base-ticker:ticker] [limit:int(1,50)] [page-no:int(1,1000)]",
+			args: "halo eth 10 abc",
+			err:  "Invalid page-no: abc. Expected a whole number between 1 and 1000",
+		},
+		{
+			spec: "[quote-ticker:ticker] [base-ticker:ticker] [limit:int(1,50)]",
+			args: "halo eth 100",
+			err:  "Invalid limit: 100. Expected a whole number between 1 and 50",
+		},
+		{
+			// address book item numbers are resolved
+			spec:     "[address:wallet] [ticker:{btc}|{eth}|{halo}]",
+			args:     "2 ETH",
+			expected: commandArgs{"address": {addresses[1]}, "ticker": {"eth"}, "eth": {"eth"}},
+		},
+		{
+			spec:     "[address:wallet] [ticker:{btc}|{eth}|{halo}]",
+			args:     "eth",
+			expected: commandArgs{"ticker": {"eth"}, "eth": {"eth"}},
+		},
+		{
+			spec: "[address:wallet] [ticker:{btc}|{eth}|{halo}]",
+			args: "3",
+			err:  "Invalid address: 3. Expected an address book item number between 1 and 2",
+		},
+		{
+			spec:     "[mode:{full}] [address:address...]",
+			args:     "full 1 " + addresses[1],
+			expected: commandArgs{"mode": {"full"}, "full": {"full"}, "address": {addresses[0], addresses[1]}},
+		},
+		{
+			spec: "[mode:{full}] [address:address...]",
+			args: "0x1234",
+			err:  "Invalid address: 0x1234",
+		},
+		{
+			// repeated arguments leave the values not matching to the following arguments
+			spec:     "[value:number...] [unit:{usd}|{eth}] [window:{1h}|{24h}]",
+			args:     "1 $2 eth 24h",
+			expected: commandArgs{"value": {"1", "2"}, "unit": {"eth"}, "eth": {"eth"}, "window": {"24h"}, "24h": {"24h"}},
+		},
+		{
+			spec: "[value:number...] [unit:{usd}|{eth}]",
+			args: "1 eth usd",
+			err:  "Unexpected argument: usd",
+		},
+		{
+			// last text argument absorbs the remaining words
+			spec:     "<action:{add}|{remove}> <command-name> [message]",
+			args:     "add hello Hello there!",
+			expected: commandArgs{"action": {"add"}, "add": {"add"}, "command-name": {"hello"}, "message": {"Hello there!"}},
+		},
+		{
+			spec: "<action:{add}|{remove}> <command-name> [message]",
+			args: "add",
+			err:  "Argument required: <command-name>",
+		},
+		{
+			spec: "<action:{add}|{remove}> <command-name> [message]",
+			args: "edit hello",
+			err:  "Invalid action: edit. Expected: add, remove",
+		},
+		{
+			spec: "[ticker:ticker]",
+			args: "eth btc",
+			err:  "Unexpected argument: btc",
+		},
+	}
+	for _, test := range tests {
+		spec, err := parseArgSpec(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := spec.Parse(tokenize(test.args), addresses)
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got: %v", test.args, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.args, test.expected, result)
+		}
+	}
+}
+
+func TestArgSpecString(t *testing.T) {
+	spec, err := parseArgSpec("<type:{payout}> [target:{config}|{data}] [limit:int(1,50)] [address:address...]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := spec.String(); s != "<{payout}> [{config}|{data}] [limit] [address...]" {
+		t.Fatalf("unexpected spec text: %s", s)
+	}
+	if _, err = parseArgSpec("[limit:integer]"); err == nil {
+		t.Fatal("expected invalid type error")
+	}
+}
+
+func TestCommandUsageReply(t *testing.T) {
+	fake := setupCommandTest(t)
+	reply := send(fake, testGuildID, testChannelID, "alice", "!trades halo eth 10 x")
+	if !strings.Contains(reply, "Invalid page-no: x") || !strings.Contains(reply, "Usage: !trades [quote-ticker]") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Number of audit log entries shown by default and at most
+const (
+	defaultAuditEntries = 10
+	maxAuditEntries     = 100
+)
+
+// AuditEntry records a privileged action: who did what, where, and the values before and after the change
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Empty for private messages
+	GuildID   string `json:"guildid,omitempty"`
+	ChannelID string `json:"channelid"`
+	UserID    string `json:"userid"`
+	Username  string `json:"username"`
+	// Command and action. Eg: "alert payout hostingfee"
+	Action string `json:"action"`
+	// Item affected by the action, if any. Eg: name of the guild command
+	Target string `json:"target,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// Format returns the entry as text: time, guild, channel and user on the first line followed by the action. Eg:
+// "alert payout hostingfee: 19.99 => 25"
+func (e AuditEntry) Format(lang string) string {
+	guild := e.GuildID
+	if guild == "" {
+		guild = tr(lang, "private")
+	}
+	s := fmt.Sprintf("%s UTC | %s | #%s | %s\n  %s", formatDate(lang, e.Time.UTC()), guild, e.ChannelID, e.Username,
+		e.Action)
+	if e.Target != "" {
+		s += " " + e.Target
+	}
+	if e.Before != "" || e.After != "" {
+		s += fmt.Sprintf(": %s => %s", auditValue(e.Before), auditValue(e.After))
+	}
+	return s + "\n"
+}
+
+// auditValue limits the length of a value and indicates an empty value
+func auditValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	if len(value) > 100 {
+		return value[:97] + "..."
+	}
+	return value
+}
+
+// audit records a privileged action by the author of the message and sends it to the audit channel of the guild,
+// if enabled
+func audit(discord Messenger, message *discordgo.MessageCreate, action, target, before, after string) {
+	e := AuditEntry{
+		Time:      time.Now().UTC(),
+		GuildID:   message.GuildID,
+		ChannelID: message.ChannelID,
+		UserID:    message.Author.ID,
+		Username:  fmt.Sprint(message.Author),
+		Action:    action,
+		Target:    target,
+		Before:    before,
+		After:     after,
+	}
+	logger.Info("Audit", "tag", "audit", "guild", e.GuildID, "channel", e.ChannelID, "user", e.Username,
+		"action", action, "target", target, "before", before, "after", after)
+	logErrorTS("audit", state.Storage().AddAuditEntry(e))
+	if e.GuildID == "" {
+		return
+	}
+	if channelID := state.GuildSettings(e.GuildID).AuditChannel; channelID != "" {
+		_, err := discordSend(discord, channelID, e.Format(state.Language(e.GuildID, "")), true)
+		logErrorTS("audit", err)
+	}
+}
+
+// cmdAudit shows the audit log of the guild or changes the audit channel. Root users can view the audit log of any
+// guild, private messages ("private") or all ("all").
+func cmdAudit(discord Messenger, message *discordgo.MessageCreate, lang, debugTag string, args commandArgs) {
+	guildID, channelID := message.GuildID, message.ChannelID
+	isRoot := isRootUser(message.Author)
+	text := ""
+	guild := args.String("guild", "")
+	count := int(args.Int("count", defaultAuditEntries))
+	var entries []AuditEntry
+	var err error
+	if n, err := strconv.Atoi(guild); err == nil && len(guild) <= 3 && !args.Has("count") {
+		// eg: !audit 20
+		guild, count = "", n
+	}
+	if guildID == "" && !isRoot {
+		// ignore if not from a guild
+		return
+	}
+	switch action := args.String("action", ""); action {
+	case "on", "off":
+		if guildID == "" {
+			text = tr(lang, "Audit channel is only available in guilds")
+			goto SendMessage
+		}
+		before := state.GuildSettings(guildID).AuditChannel
+		after := ""
+		if action == "on" {
+			after = channelID
+		}
+		err = state.UpdateGuildSettings(guildID, func(settings *GuildSettings) {
+			settings.AuditChannel = after
+		})
+		if commandErrorIf(err, discord, channelID, tr(lang, "Failed to save audit channel"), debugTag) {
+			return
+		}
+		audit(discord, message, "audit channel", "", before, after)
+		text = tr(lang, "Audit channel turned off")
+		if action == "on" {
+			text = tr(lang, "Audit channel turned on")
+		}
+		goto SendMessage
+	}
+
+	if count < 1 || count > maxAuditEntries {
+		text = tr(lang, "Number of entries must be between 1 and %d", maxAuditEntries)
+		goto SendMessage
+	}
+	if guild == "" {
+		guild = guildID
+		if guild == "" {
+			guild = "all"
+		}
+	}
+	if guild != guildID && !isRoot {
+		text = tr(lang, "You do not have permission to view the audit log of other guilds")
+		goto SendMessage
+	}
+	entries, err = state.Storage().AuditEntries(func(e AuditEntry) bool {
+		return guild == "all" || e.GuildID == guild || (guild == "private" && e.GuildID == "")
+	}, count)
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve audit log"), debugTag) {
+		return
+	}
+	if len(entries) > 0 {
+		rows := []string{}
+		// most recent first
+		for i := len(entries) - 1; i >= 0; i-- {
+			rows = append(rows, entries[i].Format(lang))
+		}
+		pages := textPages("", rows, rowsPerPage, "")
+		err = sendPages(discord, channelID, lang, 1, len(pages), staticPages(pages))
+		logErrorTS(debugTag, err)
+		return
+	}
+	text = tr(lang, "No audit log entries found")
+SendMessage:
+	_, err = discordSend(discord, channelID, text, true)
+	logErrorTS(debugTag, err)
+}
+
+// appendAuditLog appends an entry to the audit log file. One JSON encoded entry per line.
+func appendAuditLog(filename string, e AuditEntry) error {
+	v, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(v, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readAuditLog returns up to limit most recent entries of the audit log file matching the filter, oldest first
+func readAuditLog(filename string, filter func(AuditEntry) bool, limit int) (entries []AuditEntry, err error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		e := AuditEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return
+		}
+		if !filter(e) {
+			continue
+		}
+		entries = append(entries, e)
+		if len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// onOff returns the state of a switch
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "ButlerAdmin", "id-admin")
+
+	reply := send(fake, testGuildID, "channel-audit", "admin", "!audit on")
+	if !strings.Contains(reply, "Audit channel turned on") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	send(fake, testGuildID, testChannelID, "admin", "!guildcmd add sayhello Hello Discord")
+	mirrored := fake.LastMessage("channel-audit")
+	if !strings.Contains(mirrored, "admin#0001") || !strings.Contains(mirrored, "guildcmd add sayhello: - => Hello Discord") {
+		t.Fatalf("unexpected audit channel message: %q", mirrored)
+	}
+	send(fake, testGuildID, testChannelID, "admin", "!guildcmd update sayhello Hi")
+	send(fake, "", testDMChannelID, "root", "!alert payout hostingfee 25")
+
+	reply = send(fake, testGuildID, testChannelID, "admin", "!audit 2")
+	if !strings.Contains(reply, "guildcmd update sayhello: Hello Discord => Hi") ||
+		!strings.Contains(reply, "guildcmd add sayhello") || strings.Contains(reply, "audit channel") {
+		t.Fatalf("unexpected audit log: %q", reply)
+	}
+	// most recent first
+	if strings.Index(reply, "guildcmd update") > strings.Index(reply, "guildcmd add") {
+		t.Fatalf("unexpected order: %q", reply)
+	}
+	if strings.Contains(reply, "hostingfee") {
+		t.Fatalf("private actions must not be shown in guilds: %q", reply)
+	}
+
+	reply = send(fake, testGuildID, testChannelID, "admin", "!audit private")
+	if !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "!audit")
+	if !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "root", "!audit private")
+	if !strings.Contains(reply, "| private | #"+testDMChannelID+" | root#0001") ||
+		!strings.Contains(reply, "alert payout hostingfee: 0 => 25") {
+		t.Fatalf("unexpected audit log: %q", reply)
+	}
+}
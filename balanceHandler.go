@@ -1,95 +1,54 @@
 package main
 
 import (
-	"fmt"
 	"math"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alien45/gobcy"
 	"github.com/alien45/halo-info-bot/client"
 	_ "github.com/blockcypher/gobcy"
-	"github.com/bwmarrin/discordgo"
 )
 
-func cmdBalance(discord *discordgo.Session, channelID, debugTag string, cmdArgs, addresses []string, numArgs, numAddresses int) {
-	address := ""
+func cmdBalance(discord Messenger, channelID, lang, debugTag string, args commandArgs, addresses []string) {
+	// address keywords and address book item numbers are resolved by the argument parser
+	address := args.String("address", "")
 	txt := ""
-	i := 0
 	var balance float64
 	var err error
-	balfunc := explorer.GetHaloBalance
-	ticker := "HALO"
+	balfunc := state.Explorer().GetHaloBalance
+	ticker := strings.ToUpper(args.String("ticker", "HALO"))
 	dp := 8
 
-	// Check if balance enquiry is for Ethereum
-	if numArgs > 0 {
-		t := strings.ToUpper(cmdArgs[numArgs-1])
-		valid := true
-		switch t {
-		case "BTC":
-			balfunc = getBTCBalance
-			break
-		case "DASH":
-			balfunc = getDashBalance
-			break
-		case "ETH":
-			balfunc = etherscan.GetEthBalance
-			break
-		case "LTC":
-			balfunc = getLTCBalance
-			break
-		case "HALO":
-			break
-		default:
-			valid = false
-			break
-		}
-		if valid {
-			// remove token argument to keep only addresses/keywords
-			cmdArgs = cmdArgs[:numArgs-1]
-			numArgs = len(cmdArgs)
-			ticker = t
-		}
+	switch ticker {
+	case "BTC":
+		balfunc = getBTCBalance
+		break
+	case "DASH":
+		balfunc = getDashBalance
+		break
+	case "ETH":
+		balfunc = state.Etherscan().GetEthBalance
+		break
+	case "LTC":
+		balfunc = getLTCBalance
+		break
 	}
-	// Handle coin/token balance commands
-	if numArgs == 0 || cmdArgs[0] == "" {
-		// No address/address book index supplied
-		if numAddresses == 0 {
-			txt = "Address required."
+	if address == "" {
+		// No address/address book item number supplied
+		if len(addresses) == 0 {
+			txt = tr(lang, "Address required.")
 			goto SendMessage
 		}
 		// Use first item from user's address book
-		cmdArgs = append(cmdArgs, addresses[0])
-		numArgs++
-	}
-
-	address = cmdArgs[0]
-	if addr, found := addressKeywords[strings.ToLower(strings.Join(cmdArgs, "-"))]; found {
-		// Valid keyword supplied
-		address = addr
-	}
-	if address == "" || len(address) <= 3 {
-		// Invalid address supplied
-		i, err = strconv.Atoi(address)
-		if err != nil {
-			// Use first address from user's addressbook, if available
-			i = 1
-		}
-		if numAddresses == 0 || i < 1 || numAddresses < i {
-			// No/invalid address supplied and user has no address saved
-			txt = "Valid address or address book item number required."
-			goto SendMessage
-		}
-		i--
-		address = addresses[i]
+		address = addresses[0]
 	}
 
 	balance, err = balfunc(address)
-	if commandErrorIf(err, discord, channelID, "Failed to retrieve balance for "+address, debugTag) {
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve balance for %s", address), debugTag) {
 		return
 	}
-	txt = fmt.Sprintf("Balance: %s %s", client.FormatNum(balance, dp), ticker)
+	txt = tr(lang, "Balance: %s %s", formatNumber(lang, balance, dp), ticker)
 SendMessage:
 	_, err = discordSend(discord, channelID, "js\n"+txt, true)
 	logErrorTS(debugTag, err)
@@ -99,11 +58,13 @@ SendMessage:
 func getBalanceBC(ticker, address string) (balance float64, err error) {
 	// Use BlockCypher for Bitcoin, Litecon, Doge etc.
 	bc := gobcy.API{
-		Token: conf.Client.BlockCypher.Token,
+		Token: state.Config().Client.BlockCypher.Token,
 		Coin:  strings.ToLower(ticker),
 		Chain: "main",
 	}
+	start := time.Now()
 	addr, err := bc.GetAddrBal(address, map[string]string{})
+	client.HTTP.Observe(client.ServiceBlockCypher, time.Since(start), err)
 	if err == nil {
 		balance = float64(addr.FinalBalance) / math.Pow10(8)
 	}
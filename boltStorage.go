@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alien45/halo-info-bot/client"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Names of the buckets used for non Discord data
+const (
+	// Key: sequence number, value: payout
+	bucketPayoutLog = "payoutlog"
+	// Key: payout TX hash, value: processed (bool)
+	bucketPayoutTX = "payouttx"
+	// Key: sequence number, value: audit entry
+	bucketAuditLog = "auditlog"
+	// Key: metaMigrated
+	bucketMeta   = "meta"
+	metaMigrated = "migrated"
+)
+
+// boltStorage stores data in an embedded key/value database (bbolt). Every record is stored separately as JSON and
+// updated within a transaction, therefore, a change only rewrites the records that changed.
+//
+// Payout transactions are still read from the payouts file written by the alert receiver, only the processing status
+// is stored in the database.
+type boltStorage struct {
+	db            *bolt.DB
+	payoutsTXFile string
+}
+
+// openBoltStorage opens (creates if not exists) the database. On first start, existing data is imported from the
+// Discord data file, payout log file and the payout transactions file.
+func openBoltStorage(path, dataFile, payoutLogFile, payoutsTXFile string) (s *boltStorage, err error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return
+	}
+	s = &boltStorage{db: db, payoutsTXFile: payoutsTXFile}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range append(dataBuckets, bucketPayoutLog, bucketPayoutTX, bucketAuditLog, bucketMeta) {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = s.migrate(dataFile, payoutLogFile)
+	}
+	if err != nil {
+		db.Close()
+		s = nil
+	}
+	return
+}
+
+// migrate imports data from the JSON files, if not already imported
+func (s *boltStorage) migrate(dataFile, payoutLogFile string) error {
+	return s.db.Update(func(tx *bolt.Tx) (err error) {
+		meta := tx.Bucket([]byte(bucketMeta))
+		if meta.Get([]byte(metaMigrated)) != nil {
+			return
+		}
+		if fileExists(dataFile) {
+			logTS("Storage] [Migrate", "Importing "+dataFile)
+			d, err := newJSONStorage(dataFile, "", "", "").LoadData()
+			if err != nil {
+				return err
+			}
+			if err = putRecords(tx, &d, allRecords(&d)); err != nil {
+				return err
+			}
+		}
+		if fileExists(payoutLogFile) {
+			logTS("Storage] [Migrate", "Importing "+payoutLogFile)
+			payouts, err := readPayoutLog(payoutLogFile)
+			if err != nil {
+				return err
+			}
+			for _, p := range payouts {
+				if err = addPayoutLog(tx, p); err != nil {
+					return err
+				}
+			}
+		}
+		if fileExists(s.payoutsTXFile) {
+			logTS("Storage] [Migrate", "Importing "+s.payoutsTXFile)
+			payoutsTX, err := readPayoutTXs(s.payoutsTXFile)
+			if err != nil {
+				return err
+			}
+			for _, ptx := range payoutsTX {
+				if err = putJSON(tx, bucketPayoutTX, payoutTXKey(ptx), ptx.Processed); err != nil {
+					return err
+				}
+			}
+		}
+		return meta.Put([]byte(metaMigrated), []byte(time.Now().UTC().Format(time.RFC3339)))
+	})
+}
+
+// ImportData replaces the Discord data in the database with the data read from the Discord data file
+func (s *boltStorage) ImportData(dataFile string) error {
+	d, err := newJSONStorage(dataFile, "", "", "").LoadData()
+	if err != nil {
+		return err
+	}
+	return s.SaveData(&d)
+}
+
+// LoadData reads the Discord data from the database
+func (s *boltStorage) LoadData() (d DiscordData, err error) {
+	initData(&d)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		for _, name := range dataBuckets {
+			err := tx.Bucket([]byte(name)).ForEach(func(k, v []byte) error {
+				r := Record{Bucket: name, Key: string(k)}
+				if err := r.setValue(&d, v); err != nil {
+					return fmt.Errorf("Failed to decode record %s/%s: %v", r.Bucket, r.Key, err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// SaveData saves the supplied records within a single transaction.
+// If no records supplied, replaces all Discord data in the database.
+func (s *boltStorage) SaveData(data *DiscordData, records ...Record) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if len(records) > 0 {
+			return putRecords(tx, data, records)
+		}
+		for _, name := range dataBuckets {
+			if err := tx.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return putRecords(tx, data, allRecords(data))
+	})
+}
+
+// AddPayoutLog appends a payout to the payout log
+func (s *boltStorage) AddPayoutLog(p client.Payout) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return addPayoutLog(tx, p)
+	})
+}
+
+// PayoutTXs reads the payout transactions file and sets the processing status stored in the database
+func (s *boltStorage) PayoutTXs() (payoutsTX []client.PayoutTX, err error) {
+	payoutsTX, err = readPayoutTXs(s.payoutsTXFile)
+	if err != nil {
+		return
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketPayoutTX))
+		for i := range payoutsTX {
+			v := b.Get([]byte(payoutTXKey(payoutsTX[i])))
+			if v == nil {
+				// new transaction
+				payoutsTX[i].Processed = false
+				continue
+			}
+			if err := json.Unmarshal(v, &payoutsTX[i].Processed); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// SetPayoutTXProcessed marks a payout transaction as processed
+func (s *boltStorage) SetPayoutTXProcessed(ptx client.PayoutTX) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx, bucketPayoutTX, payoutTXKey(ptx), true)
+	})
+}
+
+// AddAuditEntry appends an entry to the audit log
+func (s *boltStorage) AddAuditEntry(e AuditEntry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketAuditLog))
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, id)
+		return b.Put(key, v)
+	})
+}
+
+// AuditEntries reads the audit log starting from the most recent entry
+func (s *boltStorage) AuditEntries(filter func(AuditEntry) bool, limit int) (entries []AuditEntry, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(bucketAuditLog)).Cursor()
+		for k, v := c.Last(); k != nil && len(entries) < limit; k, v = c.Prev() {
+			e := AuditEntry{}
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if filter(e) {
+				entries = append([]AuditEntry{e}, entries...)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Close closes the database
+func (s *boltStorage) Close() error {
+	return s.db.Close()
+}
+
+// putRecords saves or deletes (if not exists in the data) the supplied records
+func putRecords(tx *bolt.Tx, data *DiscordData, records []Record) error {
+	for _, r := range records {
+		value, exists, err := r.getValue(data)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			b := tx.Bucket([]byte(r.Bucket))
+			if b == nil {
+				return fmt.Errorf("Bucket not found: %s", r.Bucket)
+			}
+			if err = b.Delete([]byte(r.Key)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = putJSON(tx, r.Bucket, r.Key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putJSON saves JSON encoded value to a bucket
+func putJSON(tx *bolt.Tx, bucket, key string, value interface{}) error {
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return fmt.Errorf("Bucket not found: %s", bucket)
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), v)
+}
+
+// addPayoutLog appends a payout to the payout log using an incremental key to keep the order
+func addPayoutLog(tx *bolt.Tx, p client.Payout) error {
+	b := tx.Bucket([]byte(bucketPayoutLog))
+	id, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	v, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return b.Put(key, v)
+}
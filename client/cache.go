@@ -0,0 +1,45 @@
+package client
+
+import "sync"
+
+// Names of the caches used by the API clients
+const (
+	CacheCMCTickers = "cmc_tickers"
+	CacheDEXTickers = "dex_tickers"
+	CacheDEXTokens  = "dex_tokens"
+)
+
+// CacheStat describes the number of cache lookups
+type CacheStat struct {
+	Hits   int64
+	Misses int64
+}
+
+var cacheStats = struct {
+	sync.Mutex
+	stats map[string]CacheStat
+}{stats: map[string]CacheStat{}}
+
+// countCache records a cache lookup
+func countCache(name string, hit bool) {
+	cacheStats.Lock()
+	defer cacheStats.Unlock()
+	stat := cacheStats.stats[name]
+	if hit {
+		stat.Hits++
+	} else {
+		stat.Misses++
+	}
+	cacheStats.stats[name] = stat
+}
+
+// CacheStats returns a copy of the cache lookup counters by cache name
+func CacheStats() map[string]CacheStat {
+	cacheStats.Lock()
+	defer cacheStats.Unlock()
+	stats := map[string]CacheStat{}
+	for name, stat := range cacheStats.stats {
+		stats[name] = stat
+	}
+	return stats
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,6 +22,8 @@ type CMC struct {
 	DailyCreditUsed  int64
 	CachedTickers    map[string]CMCTicker // cached CMC Ticker container
 	CacheOnStart     bool                 `json:"cacheonstart"`
+	// guards the cache and credit usage. CMC must not be copied after first use.
+	mutex sync.RWMutex
 }
 
 // Init instantiates a new CMC instance
@@ -33,12 +37,16 @@ func (cmc *CMC) Init(baseURL, apiKey string) {
 
 // GetTicker retrieves tickers from CoinMarketCap.com. Caching enabled.
 func (cmc *CMC) GetTicker(nameOrSymbol string) (ticker CMCTicker, err error) {
+	// Only one cache update at a time to avoid wasting credits
+	cmc.mutex.Lock()
+	defer cmc.mutex.Unlock()
 
 	// Use cache if available and not expired
 	if cmc.DailyCreditUsed == cmc.DailyCreditLimit || (len(cmc.CachedTickers) > 0 &&
 		time.Now().Sub(cmc.CacheLastUpdated).Minutes() < cmc.CacheExpireMins) {
 		log.Println("[CMC] [GetTicker] Using cached tickers")
-		return cmc.FindTicker(nameOrSymbol)
+		countCache(CacheCMCTickers, true)
+		return cmc.findTicker(nameOrSymbol)
 	}
 	// Cache expired. Update cache
 	if cmc.APIKEY == "" {
@@ -47,15 +55,15 @@ func (cmc *CMC) GetTicker(nameOrSymbol string) (ticker CMCTicker, err error) {
 	}
 
 	log.Println("[CMC] [GetTicker] Updating CMC tickers cache")
+	countCache(CacheCMCTickers, false)
 	tickerURL := cmc.BaseURL + "/cryptocurrency/listings/latest?start=1&limit=5000&convert=USD"
-	client := &http.Client{}
 	request, err := http.NewRequest("GET", tickerURL, nil)
 	if err != nil {
 		return
 	}
 
 	request.Header.Set("X-CMC_PRO_API_KEY", cmc.APIKEY)
-	response, err := client.Do(request)
+	response, err := HTTP.Do(ServiceCMC, request, true)
 	if err != nil {
 		return
 	}
@@ -68,7 +76,7 @@ func (cmc *CMC) GetTicker(nameOrSymbol string) (ticker CMCTicker, err error) {
 		Status CMCResultStatus `json:"status,string,omitempty"`
 		Data   []CMCTicker     `json:"data"`
 	}{}
-	err = json.NewDecoder(response.Body).Decode(&tickersResult)
+	err = json.Unmarshal(response.Body, &tickersResult)
 	if err != nil {
 		return
 	}
@@ -80,16 +88,78 @@ func (cmc *CMC) GetTicker(nameOrSymbol string) (ticker CMCTicker, err error) {
 	}
 
 	// Cache result
-	cmc.CachedTickers = map[string]CMCTicker{}
+	tickers := map[string]CMCTicker{}
 	for _, t := range tickersResult.Data {
-		cmc.CachedTickers[t.Symbol] = t
+		tickers[t.Symbol] = t
 	}
+	cmc.CachedTickers = tickers
 	cmc.CacheLastUpdated = time.Now()
-	return cmc.FindTicker(nameOrSymbol)
+	return cmc.findTicker(nameOrSymbol)
+}
+
+// CreditsUsed returns the number of API credits used today
+func (cmc *CMC) CreditsUsed() int64 {
+	cmc.mutex.RLock()
+	defer cmc.mutex.RUnlock()
+	return cmc.DailyCreditUsed
+}
+
+// CacheUpdatedAt returns the time the cached tickers were last updated. Zero if not cached yet.
+func (cmc *CMC) CacheUpdatedAt() time.Time {
+	cmc.mutex.RLock()
+	defer cmc.mutex.RUnlock()
+	return cmc.CacheLastUpdated
+}
+
+// CopyCache copies the cached tickers and the API credits used from another client. Used when the client is replaced,
+// eg: when the config is reloaded, so that the daily credit limit is still enforced.
+func (cmc *CMC) CopyCache(from *CMC) {
+	if from == cmc {
+		return
+	}
+	from.mutex.RLock()
+	defer from.mutex.RUnlock()
+	cmc.mutex.Lock()
+	defer cmc.mutex.Unlock()
+	cmc.CachedTickers = from.CachedTickers
+	cmc.CacheLastUpdated = from.CacheLastUpdated
+	cmc.DailyCreditUsed = from.DailyCreditUsed
+}
+
+// Name returns the name of the price source
+func (cmc *CMC) Name() string {
+	return "CoinMarketCap"
+}
+
+// GetPrice retrieves the USD price of a token by symbol
+func (cmc *CMC) GetPrice(symbol string) (p Price, err error) {
+	ticker, err := cmc.GetTicker(symbol)
+	if err != nil {
+		return
+	}
+	p = Price{
+		Symbol:      ticker.Symbol,
+		USD:         ticker.Quote["USD"].Price,
+		TotalSupply: ticker.TotalSupply,
+		Source:      cmc.Name(),
+		Time:        ticker.LastUpdated,
+	}
+	if p.Time.IsZero() {
+		cmc.mutex.RLock()
+		p.Time = cmc.CacheLastUpdated
+		cmc.mutex.RUnlock()
+	}
+	return
 }
 
 // FindTicker searches for a single ticker by name or symbol within the cached tickers
 func (cmc *CMC) FindTicker(nameOrSymbol string) (ticker CMCTicker, err error) {
+	cmc.mutex.RLock()
+	defer cmc.mutex.RUnlock()
+	return cmc.findTicker(nameOrSymbol)
+}
+
+func (cmc *CMC) findTicker(nameOrSymbol string) (ticker CMCTicker, err error) {
 	if nameOrSymbol == "" {
 		// ticker name or symbol not provided
 		err = errors.New("CMC ticker name or symbol required")
@@ -112,6 +182,23 @@ func (cmc *CMC) FindTicker(nameOrSymbol string) (ticker CMCTicker, err error) {
 	return
 }
 
+// SearchTickers returns up to limit cached tickers with symbol or name starting with query, ordered by rank
+func (cmc *CMC) SearchTickers(query string, limit int) (tickers []CMCTicker) {
+	query = strings.ToLower(query)
+	cmc.mutex.RLock()
+	for _, t := range cmc.CachedTickers {
+		if strings.HasPrefix(strings.ToLower(t.Symbol), query) || strings.HasPrefix(strings.ToLower(t.Name), query) {
+			tickers = append(tickers, t)
+		}
+	}
+	cmc.mutex.RUnlock()
+	sort.Slice(tickers, func(i, j int) bool { return tickers[i].Rank < tickers[j].Rank })
+	if len(tickers) > limit {
+		tickers = tickers[:limit]
+	}
+	return
+}
+
 // CMCTickersResult describes CMC API result for cryptocurrencies
 type CMCTickersResult struct {
 	Status CMCResultStatus `json:"status,string,omitempty"`
@@ -152,18 +239,19 @@ type CMCQuote struct {
 }
 
 // Format formats important ticker values into a string
-func (ticker *CMCTicker) Format() string {
-	return fmt.Sprintf("Ticker           : %s (%s)\n"+DashLine+
-		"Price USD        : $%.8f\n"+DashLine+
-		"24H Price Change : %.4f%%\n"+DashLine+
-		"24H Volume USD   : $%s\n"+DashLine+
-		"Market Cap USD   : $%s\n"+DashLine+
-		"Last Updated     : %s UTC\n"+DashLine,
-		ticker.Name, ticker.Symbol,
-		ticker.Quote["USD"].Price,
-		ticker.Quote["USD"].PercentChange24H,
-		FormatNumShort(ticker.Quote["USD"].Volume24H, 4),
-		FormatNumShort(ticker.Quote["USD"].MarketCap, 4),
-		FormatTimeReverse(ticker.LastUpdated.UTC()),
+func (ticker *CMCTicker) Format(l Localizer) string {
+	label := labels(l, "Ticker", "Price USD", "24H Price Change", "24H Volume USD", "Market Cap USD", "Last Updated")
+	return fmt.Sprintf("%s : %s (%s)\n"+DashLine+
+		"%s : $%s\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : $%s\n"+DashLine+
+		"%s : $%s\n"+DashLine+
+		"%s : %s UTC\n"+DashLine,
+		label[0], ticker.Name, ticker.Symbol,
+		label[1], l.Num(ticker.Quote["USD"].Price, 8),
+		label[2], percent(l, ticker.Quote["USD"].PercentChange24H, 4),
+		label[3], numShort(l, ticker.Quote["USD"].Volume24H, 4),
+		label[4], numShort(l, ticker.Quote["USD"].MarketCap, 4),
+		label[5], l.Date(ticker.LastUpdated.UTC()),
 	)
 }
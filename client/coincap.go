@@ -1,10 +1,8 @@
 package client
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"strings"
 	"time"
 )
@@ -50,15 +48,11 @@ func (cc CoinCap) GetHistory(baseID, interval string, timeFrom, timeTo int64) (h
 	baseID = strings.ToLower(strings.Join(strings.Split(baseID, " "), "-"))
 	url := fmt.Sprintf("%s/assets/%s/history?interval=%s&start=%d&end=%d",
 		cc.BaseURL, baseID, interval, timeFrom, timeTo)
-	response, err := http.Get(url)
-	if err != nil {
-		return
-	}
 	result := struct {
 		Error string          `json:"error"`
 		Data  []CCHistoryItem `json:"Data"`
 	}{}
-	err = json.NewDecoder(response.Body).Decode(&result)
+	err = HTTP.GetJSON(ServiceCoinCap, url, &result)
 	if err != nil {
 		return
 	}
@@ -86,16 +80,11 @@ func (cc CoinCap) GetCandles(baseID, quoteID, exchange, interval string, start,
 	quoteID = strings.ToLower(strings.Join(strings.Split(quoteID, " "), "-"))
 	url := fmt.Sprintf("%s/candles?baseId=%s&quoteId=%s&exchange=%s&interval=%s&start=%d&end=%d",
 		cc.BaseURL, baseID, quoteID, exchange, interval, start, end)
-	fmt.Println(DashLine, url, DashLine)
-	response, err := http.Get(url)
-	if err != nil {
-		return
-	}
 	result := struct {
 		Error string     `json:"error"`
 		Data  []CCCandle `json:"data"`
 	}{}
-	err = json.NewDecoder(response.Body).Decode(&result)
+	err = HTTP.GetJSON(ServiceCoinCap, url, &result)
 	if err != nil {
 		return
 	}
@@ -106,3 +95,61 @@ func (cc CoinCap) GetCandles(baseID, quoteID, exchange, interval string, start,
 	candles = result.Data
 	return
 }
+
+// CCAsset CoinCap asset item
+type CCAsset struct {
+	ID       string  `json:"id"`
+	Symbol   string  `json:"symbol"`
+	Name     string  `json:"name"`
+	Supply   float64 `json:"supply,string"`
+	PriceUSD float64 `json:"priceUsd,string"`
+}
+
+// GetAsset retrieves an asset by symbol from CoinCap.io
+func (cc CoinCap) GetAsset(symbol string) (asset CCAsset, updatedAt time.Time, err error) {
+	symbol = strings.ToUpper(symbol)
+	url := fmt.Sprintf("%s/assets?search=%s&limit=20", cc.BaseURL, symbol)
+	result := struct {
+		Error     string    `json:"error"`
+		Data      []CCAsset `json:"data"`
+		Timestamp int64     `json:"timestamp"` // Unix Epoch time in milliseconds
+	}{}
+	err = HTTP.GetJSON(ServiceCoinCap, url, &result)
+	if err != nil {
+		return
+	}
+	if result.Error != "" {
+		err = errors.New(result.Error)
+		return
+	}
+	updatedAt = time.Unix(0, result.Timestamp*int64(time.Millisecond))
+	for _, a := range result.Data {
+		if strings.ToUpper(a.Symbol) == symbol {
+			asset = a
+			return
+		}
+	}
+	err = errors.New("CoinCap asset not found: " + symbol)
+	return
+}
+
+// Name returns the name of the price source
+func (cc CoinCap) Name() string {
+	return "CoinCap"
+}
+
+// GetPrice retrieves the USD price of a token by symbol
+func (cc CoinCap) GetPrice(symbol string) (p Price, err error) {
+	asset, updatedAt, err := cc.GetAsset(symbol)
+	if err != nil {
+		return
+	}
+	p = Price{
+		Symbol:      asset.Symbol,
+		USD:         asset.PriceUSD,
+		TotalSupply: asset.Supply,
+		Source:      cc.Name(),
+		Time:        updatedAt,
+	}
+	return
+}
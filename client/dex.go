@@ -1,14 +1,14 @@
 package client
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -33,6 +33,10 @@ type DEX struct {
 	CachedTickerExpireMins float64 `json:"tickerexpiremins"`
 	// Cached Ticker last updated timestamp
 	CachedTickerLastUpdated time.Time
+
+	// guard the ticker and token caches. DEX must not be copied after first use.
+	tickerMutex sync.Mutex
+	tokenMutex  sync.Mutex
 }
 
 // Init instantiates DEX struct with required values
@@ -71,14 +75,49 @@ type Trade struct {
 	Amount       float64
 }
 
+// TickerCacheUpdatedAt returns the time the cached tickers were last updated. Zero if not cached yet.
+func (dex *DEX) TickerCacheUpdatedAt() time.Time {
+	dex.tickerMutex.Lock()
+	defer dex.tickerMutex.Unlock()
+	return dex.CachedTickerLastUpdated
+}
+
+// TokenCacheUpdatedAt returns the time the cached tokens were last updated. Zero if not cached yet.
+func (dex *DEX) TokenCacheUpdatedAt() time.Time {
+	dex.tokenMutex.Lock()
+	defer dex.tokenMutex.Unlock()
+	return dex.CachedTokenLastUpdated
+}
+
+// CopyCache copies the cached tickers and tokens from another client. Used when the client is replaced, eg: when the
+// config is reloaded.
+func (dex *DEX) CopyCache(from *DEX) {
+	if from == dex {
+		return
+	}
+	from.tickerMutex.Lock()
+	tickers, tickersUpdated := from.CachedTickers, from.CachedTickerLastUpdated
+	from.tickerMutex.Unlock()
+	from.tokenMutex.Lock()
+	tokens, tokensUpdated := from.CachedTokens, from.CachedTokenLastUpdated
+	from.tokenMutex.Unlock()
+
+	dex.tickerMutex.Lock()
+	dex.CachedTickers, dex.CachedTickerLastUpdated = tickers, tickersUpdated
+	dex.tickerMutex.Unlock()
+	dex.tokenMutex.Lock()
+	dex.CachedTokens, dex.CachedTokenLastUpdated = tokens, tokensUpdated
+	dex.tokenMutex.Unlock()
+}
+
 // FormatTrades transforms Trade attributes into formatted signle line string
-func (dex *DEX) FormatTrades(trades []Trade) (s string) {
+func (dex *DEX) FormatTrades(l Localizer, trades []Trade) (s string) {
 	if len(trades) == 0 {
-		return "No data available"
+		return l.T("No data available")
 	}
 	pricedp, amountdp := 8, 8
 	sign := ""
-	s = "  Price      | Amount      | hh:mm:ss DD-MMM\n"
+	s = "  " + padRight(l.T("Price"), 10) + " | " + padRight(l.T("Amount"), 11) + " | " + l.T("Time") + " (UTC)\n"
 	for _, trade := range trades {
 		sign = "- "
 		if trade.IsBuy {
@@ -91,9 +130,31 @@ func (dex *DEX) FormatTrades(trades []Trade) (s string) {
 			pricedp = 0
 		}
 		s += DashLine
-		s += sign + FillOrLimit(FormatNum(trade.Price, pricedp), " ", 10) + " | "
-		s += FillOrLimit(FormatNum(trade.Amount, amountdp), " ", 11) + " | "
-		s += FormatTimeReverse(trade.Time.UTC()) + "\n"
+		s += sign + padRight(l.Num(trade.Price, pricedp), 10) + " | "
+		s += padRight(l.Num(trade.Amount, amountdp), 11) + " | "
+		s += l.Date(trade.Time.UTC()) + "\n"
+	}
+	return
+}
+
+// FormatAlert formats a large trade alert: side, amount, price, total in the base token and USD, time and the
+// link to the transaction, if any
+func (trade Trade) FormatAlert(l Localizer, quoteTicker, baseTicker, txURL string) (s string) {
+	sign, side := "- ", l.T("SELL")
+	if trade.IsBuy {
+		sign, side = "+ ", l.T("BUY")
+	}
+	label := labels(l, "Total", "Time")
+	s = l.T("Large %s/%s trade!", quoteTicker, baseTicker) + fmt.Sprintf("```diff\n"+
+		"%s%s %s %s @ %s %s\n"+DashLine+
+		"%s : %s %s | $%s\n"+DashLine+
+		"%s : %s UTC\n```",
+		sign, side, l.Num(trade.Amount, 2), quoteTicker, l.Num(trade.Price, 8), baseTicker,
+		label[0], l.Num(trade.Amount*trade.Price, 4), baseTicker, l.Num(trade.Amount*trade.PriceUSD, 2),
+		label[1], l.Date(trade.Time.UTC()),
+	)
+	if trade.TxHash != "" {
+		s += txURL
 	}
 	return
 }
@@ -133,27 +194,19 @@ func (dex *DEX) GetTrades(quoteTicker, baseTicker string, limit, pageNo int64, b
 		log.Println("[DEX] [GetTrades] request error", err)
 		return
 	}
-	response, err := (&http.Client{Timeout: time.Second * 30}).Do(request)
-	if err != nil {
-		return
-	}
-
 	result := struct {
 		Total  int64   `json:"total,string"`
 		Trades []Trade `json:"trades"`
 	}{}
-	err = json.NewDecoder(response.Body).Decode(&result)
+	err = HTTP.DoJSON(ServiceDEX, request, true, &result)
 	if err != nil {
-		if response.StatusCode != http.StatusOK {
-			err = fmt.Errorf("API request failed! Status: %s", response.Status)
-		}
 		return
 	}
 	for i, trade := range result.Trades {
 		result.Trades[i].IsBuy = strings.ToLower(trade.Side) == "sell"
 		if basePriceUSD > 0 {
 			result.Trades[i].BasePriceUSD = basePriceUSD
-			result.Trades[i].PriceUSD = trade.Price * trade.BasePriceUSD
+			result.Trades[i].PriceUSD = trade.Price * basePriceUSD
 		}
 		if result.Trades[i].IsBuy {
 			result.Trades[i].Amount = trade.AmountReceived
@@ -199,88 +252,92 @@ type Ticker struct {
 }
 
 // Format formats important ticker values into a string
-func (ticker *Ticker) Format() string {
+func (ticker *Ticker) Format(l Localizer) string {
 	base := ticker.BaseTicker
+	label := labels(l, "Pair", "Last Price", "24H Change", "Supply", "Market Cap")
 	return fmt.Sprintf(""+
-		"Pair       : %s\n"+DashLine+
-		"Last Price : $%.8f | %.8f %s\n"+DashLine+
-		// "24H High   : $%.8f | %.8f %s\n"+DashLine+ // deprecated ???
-		// "24H Low    : $%.8f | %.8f %s\n"+DashLine+ // deprecated ???
-		"24 Price Changed : %.2f%%\n"+DashLine+
-		"Supply: %s | Market Cap: $%s\n"+DashLine+
-		"                  24hr Volume\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : $%s | %s %s\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : $%s\n"+DashLine+
+		"                  %s\n"+DashLine+
 		"%s| %s| $%s",
-		ticker.Pair,
-		ticker.LastPriceUSD, ticker.Last, base,
-		// ticker.TwoFourAskUSD, ticker.TwoFourAsk, base,
-		// ticker.TwoFourBidUSD, ticker.TwoFourBid, base,
-		ticker.PercentChange,
-		FormatNumShort(ticker.QuoteTokenSupply, 4),
-		FormatNumShort(ticker.QuoteTokenMarketCap, 4),
-		FillOrLimit(base+" "+FormatNumShort(ticker.BaseVolume, 4), " ", 14),
-		FillOrLimit(ticker.QuoteTicker+" "+FormatNumShort(ticker.QuoteVolume, 4), " ", 14),
-		FormatNumShort(ticker.TwoFourVolumeUSD, 4),
+		label[0], ticker.Pair,
+		label[1], l.Num(ticker.LastPriceUSD, 8), l.Num(ticker.Last, 8), base,
+		label[2], percent(l, ticker.PercentChange, 2),
+		label[3], numShort(l, ticker.QuoteTokenSupply, 4),
+		label[4], numShort(l, ticker.QuoteTokenMarketCap, 4),
+		l.T("24H Volume"),
+		padRight(base+" "+numShort(l, ticker.BaseVolume, 4), 14),
+		padRight(ticker.QuoteTicker+" "+numShort(l, ticker.QuoteVolume, 4), 14),
+		numShort(l, ticker.TwoFourVolumeUSD, 4),
 	)
 }
 
 // GetTicker function retrieves available tickers from HaloDEX. Caching enabled.
 func (dex *DEX) GetTicker(symbolQuote, symbolBase string, baseTokenPriceUSD, quoteTokenSupply float64) (ticker Ticker, err error) {
-	// Use cache if available and not expired
+	dex.tickerMutex.Lock()
+	defer dex.tickerMutex.Unlock()
 	pair := strings.ToUpper(fmt.Sprintf("%s/%s", symbolQuote, symbolBase))
-	cachedTicker, available := dex.CachedTickers[pair]
-	if available && time.Now().Sub(dex.CachedTickerLastUpdated).Minutes() < dex.CachedTickerExpireMins {
+	tickers, err := dex.getTickers(pair)
+	if err != nil {
+		return
+	}
+	ticker, found := tickers[pair]
+	if !found {
+		err = fmt.Errorf("Pair %s/%s not available", symbolQuote, symbolBase)
+		return
+	}
+	ticker.LastPriceUSD = ticker.Last * baseTokenPriceUSD
+	ticker.QuoteTokenSupply = quoteTokenSupply
+	ticker.TwoFourVolumeUSD = ticker.QuoteVolume * ticker.LastPriceUSD
+	ticker.QuoteTokenMarketCap = ticker.QuoteTokenSupply * ticker.LastPriceUSD
+	return
+}
+
+// getTickers returns the cached tickers by pair. Tickers are retrieved from HaloDEX if the cache is expired or the
+// pair, if not empty, is not cached. The caller must hold the tickerMutex.
+func (dex *DEX) getTickers(pair string) (tickers map[string]Ticker, err error) {
+	// Use cache if available and not expired
+	_, available := dex.CachedTickers[pair]
+	if (available || (pair == "" && len(dex.CachedTickers) > 0)) &&
+		time.Now().Sub(dex.CachedTickerLastUpdated).Minutes() < dex.CachedTickerExpireMins {
 		log.Println("[DEX] [GetTicker] Using cached tickers")
-		return cachedTicker, nil
+		countCache(CacheDEXTickers, true)
+		return dex.CachedTickers, nil
 	}
+	countCache(CacheDEXTickers, false)
 
-	response := &(http.Response{})
-	response, err = http.Get(dex.BaseURL + "/dex/public/pricing/all")
+	request, err := http.NewRequest("GET", dex.BaseURL+"/dex/public/pricing/all", nil)
 	if err != nil {
 		return
 	}
-	body, err := ioutil.ReadAll(response.Body)
+	response, err := HTTP.Do(ServiceDEX, request, true)
 	if err != nil {
 		return
 	}
 	tickersArr := []Ticker{}
-	err = json.Unmarshal(body, &tickersArr)
+	err = response.DecodeJSON(&tickersArr)
 	if err != nil {
-		if response.StatusCode != http.StatusOK {
-			err = fmt.Errorf("API request failed! Status: %s", response.Status)
-		} else if string(body) == "[]" {
+		if response.StatusCode == http.StatusOK && string(response.Body) == "[]" {
 			// API returns empty Array if not none found!!
 			err = fmt.Errorf("Zero tickers returned from API")
 		}
 		return
 	}
-	tickers := map[string]Ticker{}
-	for _, t := range tickersArr {
-		tickers[t.Pair] = t
-	}
-	dex.CachedTickers = tickers
 	now := time.Now()
-	for key, t := range dex.CachedTickers {
+	tickers = map[string]Ticker{}
+	for _, t := range tickersArr {
 		// // TEMP FIX: switch 24H low and high price appropriately
 		// if t.TwoFourAsk < t.TwoFourBid {
 		// 	t.TwoFourAsk, t.TwoFourBid = t.TwoFourBid, t.TwoFourAsk
 		// }
-		t.LastPriceUSD = t.Last * baseTokenPriceUSD
-		// t.TwoFourAskUSD = t.TwoFourAsk * baseTokenPriceUSD
-		// t.TwoFourBidUSD = t.TwoFourBid * baseTokenPriceUSD
-		t.QuoteTokenSupply = quoteTokenSupply
-		t.TwoFourVolumeUSD = t.QuoteVolume * t.LastPriceUSD
-		t.QuoteTokenMarketCap = t.QuoteTokenSupply * t.LastPriceUSD
 		t.LastUpdated = now
-		dex.CachedTickers[key] = t
-		if key == pair {
-			ticker = t
-		}
+		tickers[t.Pair] = t
 	}
+	dex.CachedTickers = tickers
 	dex.CachedTickerLastUpdated = now
-	if ticker.Pair == "" {
-		err = fmt.Errorf("Pair %s/%s not available", symbolQuote, symbolBase)
-		return
-	}
 	return
 }
 
@@ -296,21 +353,272 @@ type Order struct {
 	FilledPercent float64
 }
 
-// FormatOrders returns orders as a string formatted like a table
-func (dex *DEX) FormatOrders(orders []Order) (s string) {
-	s = "deprecated"
+// setSide sets the side, the amount of the quote token and the filled percentage of an order
+func (order *Order) setSide(buy bool) {
+	order.IsBuy = buy
+	// buyers receive and sellers send the quote token
+	order.Amount = order.AmountSent
+	if buy {
+		order.Amount = order.AmountReceived
+	}
+	order.FilledPercent = 0
+	if order.Amount > 0 {
+		order.FilledPercent = order.FilledAmount / order.Amount * 100
+	}
+}
+
+// Remaining returns the unfilled amount of the quote token
+func (order *Order) Remaining() float64 {
+	return order.Amount - order.FilledAmount
+}
+
+// FormatOrders returns orders as a string formatted like a table with a dash line after each row:
+// side, price, amount of the quote token, filled percentage and age
+func (dex *DEX) FormatOrders(l Localizer, orders []Order) (s string) {
+	if len(orders) == 0 {
+		return l.T("No open orders")
+	}
+	// side labels are padded to the same length
+	sides := labels(l, "Side", "Sell", "Buy")
+	s = "  " + sides[0] + " | " + padRight(l.T("Price"), 10) + " | " + padRight(l.T("Amount"), 8) +
+		" | " + padRight(l.T("Filled"), 7) + " | " + l.T("Age") + "\n" + DashLine
+	for _, order := range orders {
+		sign, side := "- ", sides[1]
+		if order.IsBuy {
+			sign, side = "+ ", sides[2]
+		}
+		s += sign + side + " | " + padRight(l.Num(order.Price, 8), 10) + " | " +
+			padRight(numShort(l, order.Amount, 2), 8) + " | " +
+			padRight(percent(l, order.FilledPercent, 2), 7) + " | " +
+			FormatAge(time.Since(order.Time)) + "\n" + DashLine
+	}
+	return
+}
+
+// FormatAge formats a duration using the two largest units. Eg: 3d 4h, 5h 2m, 12m
+func FormatAge(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
+	}
+	days, hours, mins := int(d/(24*time.Hour)), int(d/time.Hour)%24, int(d/time.Minute)%60
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh", days, hours)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, mins)
+	}
+	return fmt.Sprintf("%dm", mins)
+}
+
+// GetOrders retrieves open HaloDEX orders of a pair by user address, newest first. Filled orders are excluded.
+func (dex *DEX) GetOrders(quoteTicker, baseTicker, address string, limit int64) (orders []Order, err error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	qURL := fmt.Sprintf(
+		"%s/dex/market/orders/%s/%s?user=%s&limit=%d",
+		dex.BaseURL,
+		quoteTicker,
+		baseTicker,
+		strings.ToLower(address),
+		limit,
+	)
+	request, err := http.NewRequest("GET", qURL, nil)
+	if err != nil {
+		return
+	}
+	result := struct {
+		Orders []Order `json:"orders"`
+	}{}
+	err = HTTP.DoJSON(ServiceDEX, request, true, &result)
+	if err != nil {
+		return
+	}
+	for _, order := range result.Orders {
+		order.setSide(strings.ToLower(order.Side) == "buy")
+		if order.Deleted || order.Remaining() <= 0 {
+			continue
+		}
+		orders = append(orders, order)
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].Time.After(orders[j].Time)
+	})
+	return
+}
+
+// GetOrderbook retrieves open HaloDEX orders of a pair on one side of the order book, best price first: buy orders
+// (bids) or sell orders (asks). Filled orders are excluded.
+func (dex *DEX) GetOrderbook(quoteTicker, baseTicker string, limit int64, buy bool) (orders []Order, err error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	side := "sell"
+	if buy {
+		side = "buy"
+	}
+	qURL := fmt.Sprintf(
+		"%s/dex/market/orders/%s/%s?side=%s&limit=%d",
+		dex.BaseURL,
+		quoteTicker,
+		baseTicker,
+		side,
+		limit,
+	)
+	request, err := http.NewRequest("GET", qURL, nil)
+	if err != nil {
+		return
+	}
+	result := struct {
+		Orders []Order `json:"orders"`
+	}{}
+	err = HTTP.DoJSON(ServiceDEX, request, true, &result)
+	if err != nil {
+		return
+	}
+	for _, order := range result.Orders {
+		order.setSide(buy)
+		if order.Deleted || order.Remaining() <= 0 {
+			continue
+		}
+		orders = append(orders, order)
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		if buy {
+			return orders[i].Price > orders[j].Price
+		}
+		return orders[i].Price < orders[j].Price
+	})
 	return
 }
 
-// GetOrders retrieves HaloDEX orders by user address
-func (dex *DEX) GetOrders(quoteAddr, baseAddr, limit, address string) (orders []Order, err error) {
-	err = errors.New("deprecated")
+// OrderbookLevel is the total unfilled amount of the orders at a price and the cumulative depth from the best price
+type OrderbookLevel struct {
+	Price float64
+	// Unfilled amount of the quote token
+	Amount float64
+	Orders int
+	// Cumulative amount of the quote and base tokens from the best price up to and including this level
+	DepthQuote float64
+	DepthBase  float64
+}
+
+// Orderbook describes the bids and asks of a pair aggregated by price level, best price first
+type Orderbook struct {
+	QuoteTicker string
+	BaseTicker  string
+	Bids        []OrderbookLevel
+	Asks        []OrderbookLevel
+	// Number of decimal places of the prices and amounts. See TokenDP.
+	PriceDP  int
+	AmountDP int
+	// USD price of the base token. Depth in USD is not shown if zero.
+	BasePriceUSD float64
+}
+
+// TokenDP returns the number of decimal places to show for a token: the decimals of the token up to 8
+func TokenDP(token Token) int {
+	if token.Decimals < 8 {
+		return int(token.Decimals)
+	}
+	return 8
+}
+
+// AggregateOrders groups orders sorted by best price first into up to depth price levels. Prices are rounded to dp
+// decimal places: down for buy orders and up for sell orders, so that levels never cross the spread.
+func AggregateOrders(orders []Order, dp, depth int) (levels []OrderbookLevel) {
+	depthQuote, depthBase := 0.0, 0.0
+	pow := math.Pow10(dp)
+	for _, order := range orders {
+		price := math.Ceil(order.Price*pow-1e-6) / pow
+		if order.IsBuy {
+			price = math.Floor(order.Price*pow+1e-6) / pow
+		}
+		if n := len(levels); n == 0 || levels[n-1].Price != price {
+			if n == depth {
+				break
+			}
+			levels = append(levels, OrderbookLevel{Price: price})
+		}
+		depthQuote += order.Remaining()
+		depthBase += order.Remaining() * order.Price
+		level := &levels[len(levels)-1]
+		level.Amount += order.Remaining()
+		level.Orders++
+		level.DepthQuote, level.DepthBase = depthQuote, depthBase
+	}
 	return
 }
 
-// GetOrderbook retrieves HaloDEX orderbook buy+sell
-func (dex *DEX) GetOrderbook(quoteAddr, baseAddr, limit string, buy bool) (orders []Order, err error) {
-	err = errors.New("not implemented")
+// Spread returns the difference between the best ask and the best bid and the difference as a percentage of the
+// midpoint price. Ok is false if there are no bids or asks.
+func (ob *Orderbook) Spread() (spread, percent float64, ok bool) {
+	if len(ob.Bids) == 0 || len(ob.Asks) == 0 {
+		return
+	}
+	bid, ask := ob.Bids[0].Price, ob.Asks[0].Price
+	spread = ask - bid
+	if mid := (ask + bid) / 2; mid > 0 {
+		percent = spread / mid * 100
+	}
+	return spread, percent, true
+}
+
+// Format returns the order book as a table: asks with the highest price first, the spread and bids with the highest
+// price first. Depth is the cumulative amount of the quote and base tokens and the USD value from the best price.
+func (ob *Orderbook) Format(l Localizer) (s string) {
+	if len(ob.Bids) == 0 && len(ob.Asks) == 0 {
+		return l.T("No orders available")
+	}
+	amountDP := ob.AmountDP
+	if amountDP > 2 {
+		amountDP = 2
+	}
+	row := func(sign string, level OrderbookLevel) string {
+		usd := "-"
+		if ob.BasePriceUSD > 0 {
+			usd = "$" + numShort(l, level.DepthBase*ob.BasePriceUSD, 2)
+		}
+		return sign + FillOrLimit(l.Num(level.Price, ob.PriceDP), " ", 12) + " | " +
+			FillOrLimit(numShort(l, level.Amount, amountDP), " ", 8) + " | " +
+			FillOrLimit(numShort(l, level.DepthQuote, amountDP), " ", 8) + " | " +
+			FillOrLimit(numShort(l, level.DepthBase, 4), " ", 8) + " | " + usd + "\n"
+	}
+	s = fmt.Sprintf("  %s | %s | %s | %s | %s\n",
+		padRight(l.T("Price"), 12),
+		padRight(l.T("Amount"), 8),
+		padRight(l.T("Depth"), 8),
+		padRight(l.T("Depth"), 8),
+		l.T("Depth USD"),
+	)
+	s += fmt.Sprintf("  %s | %s | %s | %s |\n",
+		FillOrLimit(ob.BaseTicker, " ", 12),
+		FillOrLimit(ob.QuoteTicker, " ", 8),
+		FillOrLimit(ob.QuoteTicker, " ", 8),
+		FillOrLimit(ob.BaseTicker, " ", 8),
+	) + DashLine
+	for i := len(ob.Asks) - 1; i >= 0; i-- {
+		s += row("- ", ob.Asks[i])
+	}
+	s += DashLine
+	if spread, pct, ok := ob.Spread(); ok {
+		s += "  " + l.T("Spread: %s %s (%s)", l.Num(spread, ob.PriceDP), ob.BaseTicker, percent(l, pct, 2)) + "\n"
+	} else {
+		s += "  " + l.T("Spread: -") + "\n"
+	}
+	s += DashLine
+	for _, level := range ob.Bids {
+		s += row("+ ", level)
+	}
+	s += DashLine
+	bestBid, bestAsk := "-", "-"
+	if len(ob.Bids) > 0 {
+		bestBid = l.Num(ob.Bids[0].Price, ob.PriceDP)
+	}
+	if len(ob.Asks) > 0 {
+		bestAsk = l.Num(ob.Asks[0].Price, ob.PriceDP)
+	}
+	s += l.T("Best bid: %s | Best ask: %s %s", bestBid, bestAsk, ob.BaseTicker)
 	return
 }
 
@@ -328,20 +636,22 @@ type Token struct {
 }
 
 // Format formats Token
-func (t *Token) Format() string {
+func (t *Token) Format(l Localizer) string {
+	label := labels(l, "Name", "Ticker", "Type", "Decimals", "Base Chain", "Base Address", "Halo Address")
 	return fmt.Sprintf(""+
-		"Name         : %s\n"+DashLine+
-		"Ticker       : %s\n"+DashLine+
-		"Type         : %s\n"+DashLine+
-		"Decimals     : %d\n"+DashLine+
-		"Base Chain   : %s\n"+DashLine+
-		"Base Address : \n  %s\n"+DashLine+
-		"Halo Address : \n  %s\n"+DashLine,
-		t.Name, t.Ticker, t.Type, t.Decimals, t.BaseChain, t.BaseChainAddress, t.HaloChainAddress)
+		"%s : %s\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : %d\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : \n  %s\n"+DashLine+
+		"%s : \n  %s\n"+DashLine,
+		label[0], t.Name, label[1], t.Ticker, label[2], t.Type, label[3], t.Decimals, label[4], t.BaseChain,
+		label[5], t.BaseChainAddress, label[6], t.HaloChainAddress)
 }
 
 // GetFormattedTokens returns a string with provided tokens or all supported tokens on HaloDEX line by line
-func (dex *DEX) GetFormattedTokens(tokens map[string]Token) (s string, err error) {
+func (dex *DEX) GetFormattedTokens(l Localizer, tokens map[string]Token) (s string, err error) {
 	if len(tokens) == 0 {
 		tokens, err = dex.GetTokens()
 		if err != nil {
@@ -349,7 +659,7 @@ func (dex *DEX) GetFormattedTokens(tokens map[string]Token) (s string, err error
 		}
 	}
 	if len(tokens) == 0 {
-		s = "No tokens found"
+		s = l.T("No tokens found")
 		return
 	}
 	// List token names (with ticker) only
@@ -360,7 +670,7 @@ func (dex *DEX) GetFormattedTokens(tokens map[string]Token) (s string, err error
 	sort.Strings(keys)
 	// TODO: include 24 USD price and volume
 	//Name           | Ticker | Price | 24H Volume
-	s += "Name           | Ticker\n" + DashLine
+	s += padRight(l.T("Name"), 14) + " | " + l.T("Ticker") + "\n" + DashLine
 	for i := 0; i < len(keys); i++ {
 		token := tokens[keys[i]]
 		s += fmt.Sprintf("%s | %s\n", FillOrLimit(token.Name, " ", 14), FillOrLimit(token.Ticker, " ", 6)) + DashLine
@@ -369,36 +679,33 @@ func (dex *DEX) GetFormattedTokens(tokens map[string]Token) (s string, err error
 }
 
 // GetTokens caches and returns HaloDEX tokens.
+// The returned map is shared with other callers and must not be modified.
 func (dex *DEX) GetTokens() (tokens map[string]Token, err error) {
+	dex.tokenMutex.Lock()
+	defer dex.tokenMutex.Unlock()
 	cacheExpired := time.Now().Sub(dex.CachedTokenLastUpdated).Minutes() >= dex.CachedTokenExpireMins
 	if len(dex.CachedTokens) > 0 && !cacheExpired {
 		tokens = dex.CachedTokens
+		countCache(CacheDEXTokens, true)
 		return
 	}
+	countCache(CacheDEXTokens, false)
 	log.Println("[DEX] [GetTokens] updating DEX token cache")
 	request, err := http.NewRequest("GET", dex.BaseURL+"/dex/public/tokens", nil)
 	if err != nil {
 		log.Println("[DEX] [GetTokens] request error", err)
 		return
 	}
-	response, err := (&http.Client{Timeout: time.Second * 30}).Do(request)
-	if err != nil {
-		return
-	}
-
 	result := []Token{}
-	err = json.NewDecoder(response.Body).Decode(&result)
+	err = HTTP.DoJSON(ServiceDEX, request, true, &result)
 	if err != nil {
-		if response.StatusCode != http.StatusOK {
-			err = fmt.Errorf("API request failed! Status: %s", response.Status)
-		}
 		return
 	}
-	dex.CachedTokens = map[string]Token{}
+	tokens = map[string]Token{}
 	for i, token := range result {
-		dex.CachedTokens[token.Ticker] = result[i]
+		tokens[token.Ticker] = result[i]
 	}
-	tokens = dex.CachedTokens
+	dex.CachedTokens = tokens
 	dex.CachedTokenLastUpdated = time.Now()
 	return
 }
@@ -421,41 +728,100 @@ type TokenPair struct {
 
 // GetTokenPairs retrieves available token pairs from HaloDEX
 func (dex *DEX) GetTokenPairs() (pairs []TokenPair, err error) {
-	response, err := http.Get(dex.BaseURL + "/dex/public/available")
-	if err != nil {
-		return
-	}
-	err = json.NewDecoder(response.Body).Decode(&pairs)
-	if err != nil && response.StatusCode != http.StatusOK {
-		err = fmt.Errorf("API request failed! Status: %s", response.Status)
-	}
+	err = HTTP.GetJSON(ServiceDEX, dex.BaseURL+"/dex/public/available", &pairs)
 	return
 }
 
-// Balance ////
-//TODO: deprecated
+// Balance describes the HaloDEX account balance of a token
 type Balance struct {
-	Available float64 `json:"available,string"`
+	Ticker string `json:"ticker"`
+	// Total balance including the amount locked in open orders
 	Balance   float64 `json:"balance,string"`
+	Available float64 `json:"available,string"`
+
+	// External/calculated attributes
+	InOrders float64
+	// Value of the total balance in USD. Zero if the price is unavailable.
+	USD float64
 }
 
 // GetBalance returns single balance of the specified address
-//TODO: deprecated
 func (dex *DEX) GetBalance(userAddress string, tickerStr string) (balance float64, err error) {
-	err = errors.New("Deprecated")
+	ticker := strings.ToUpper(tickerStr)
+	balances, err := dex.GetBalances(userAddress, []string{ticker})
+	if err != nil {
+		return
+	}
+	balance = balances[ticker].Balance
 	return
 }
 
-// GetBalances retrieves DEX account balances for one or more tickers by user address
-//TODO: deprecated
-func (dex *DEX) GetBalances(userAddress string, tickers []string) (balances map[string][]Balance, err error) {
-	err = errors.New("Deprecated")
+// GetBalances retrieves DEX account balances for one or more tickers by user address.
+// Tickers without a balance are included with zero balance.
+func (dex *DEX) GetBalances(userAddress string, tickers []string) (balances map[string]Balance, err error) {
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/dex/account/balances/%s", dex.BaseURL,
+		strings.ToLower(userAddress)), nil)
+	if err != nil {
+		return
+	}
+	result := []Balance{}
+	err = HTTP.DoJSON(ServiceDEX, request, true, &result)
+	if err != nil {
+		return
+	}
+	all := map[string]Balance{}
+	for _, b := range result {
+		b.Ticker = strings.ToUpper(b.Ticker)
+		b.InOrders = b.Balance - b.Available
+		all[b.Ticker] = b
+	}
+	balances = map[string]Balance{}
+	for _, ticker := range tickers {
+		ticker = strings.ToUpper(ticker)
+		b, found := all[ticker]
+		if !found {
+			b = Balance{Ticker: ticker}
+		}
+		balances[ticker] = b
+	}
+	return
+}
+
+// GetPricesUSD derives the USD price of HaloDEX tokens from the last price of their pairs (eg: HALO/ETH) and the USD
+// price of the base tokens. The base tokens are included with the supplied prices. Uses the ticker cache.
+func (dex *DEX) GetPricesUSD(basePricesUSD map[string]float64) (prices map[string]float64, err error) {
+	dex.tickerMutex.Lock()
+	defer dex.tickerMutex.Unlock()
+	tickers, err := dex.getTickers("")
+	if err != nil {
+		return
+	}
+	// sorted by pair, so that the price of a token traded against multiple base tokens does not vary
+	pairs := []string{}
+	for pair := range tickers {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	prices = map[string]float64{}
+	for ticker, usd := range basePricesUSD {
+		prices[ticker] = usd
+	}
+	for _, pair := range pairs {
+		t := tickers[pair]
+		if prices[t.QuoteTicker] > 0 {
+			continue
+		}
+		if usd := basePricesUSD[t.BaseTicker]; usd > 0 && t.Last > 0 {
+			prices[t.QuoteTicker] = t.Last * usd
+		}
+	}
 	return
 }
 
-// GetBalancesFormatted returns formatted balances by user address and ticker symbol
-//TODO: deprecated
-func (dex *DEX) GetBalancesFormatted(address string, tickers []string, showZeroBalance bool) (s string, err error) {
+// GetBalancesFormatted returns formatted balances by user address and ticker symbol: total, available and in orders
+// along with the USD value using the prices, if available. Zero balances are excluded unless showZeroBalance is true.
+func (dex *DEX) GetBalancesFormatted(l Localizer, address string, tickers []string, showZeroBalance bool,
+	pricesUSD map[string]float64) (s string, err error) {
 	if len(tickers) == 0 {
 		err = errors.New("Ticker required")
 		return
@@ -471,27 +837,41 @@ func (dex *DEX) GetBalancesFormatted(address string, tickers []string, showZeroB
 	if err != nil {
 		return
 	}
-	if len(tokenBalances) == 0 {
-		err = errors.New("No balances found")
-		return
-	}
 
-	s = "  Ticker  | Balance        | Available   \n" + DashLine
+	rows, totalUSD := "", 0.0
 	for i := 0; i < len(tickers); i++ {
-		tokenBalance := tokenBalances[tickers[i]]
-		if len(tokenBalance) == 0 {
-			tokenBalance = append(tokenBalance, Balance{Balance: 0, Available: 0})
-		}
-		if !showZeroBalance && tokenBalance[0].Balance < 1e-8 {
+		b := tokenBalances[tickers[i]]
+		if !showZeroBalance && b.Balance < 1e-8 {
 			// Balance is zero
 			continue
 		}
-		s += fmt.Sprintf("  %s| %s | %s\n%s",
-			FillOrLimit(tickers[i], " ", 8),
-			FillOrLimit(FormatNum(tokenBalance[0].Balance, 8), " ", 14),
-			FillOrLimit(FormatNum(tokenBalance[0].Available, 8), " ", 14),
+		usd := "-"
+		if price := pricesUSD[b.Ticker]; price > 0 {
+			b.USD = b.Balance * price
+			totalUSD += b.USD
+			usd = "$" + numShort(l, b.USD, 2)
+		}
+		rows += fmt.Sprintf("  %s| %s | %s | %s | %s\n%s",
+			FillOrLimit(b.Ticker, " ", 8),
+			FillOrLimit(l.Num(b.Balance, 8), " ", 14),
+			FillOrLimit(l.Num(b.Available, 8), " ", 14),
+			FillOrLimit(l.Num(b.InOrders, 8), " ", 14),
+			usd,
 			DashLine,
 		)
 	}
+	if rows == "" {
+		s = l.T("No balances found")
+		return
+	}
+	s = fmt.Sprintf("  %s| %s | %s | %s | USD\n",
+		padRight(l.T("Ticker"), 8),
+		padRight(l.T("Total"), 14),
+		padRight(l.T("Available"), 14),
+		padRight(l.T("In orders"), 14),
+	) + DashLine + rows
+	if totalUSD > 0 {
+		s += l.T("Total value: $%s", l.Num(totalUSD, 2))
+	}
 	return
 }
@@ -1,10 +1,8 @@
 package client
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
 )
 
 // Etherscan handles API requests to http://etherscan.io
@@ -28,19 +26,12 @@ func (etherscan Etherscan) GetEthBalance(address string) (balance float64, err e
 		etherscan.APIKey,
 	)
 	log.Println("[Etherscan] [GetEthBalance] Retrieving ethereum balance from Etherscan")
-	response, err := http.Get(url)
-	if err != nil {
-		return 0, err
-	}
 	result := struct {
 		Balance string `json:"result"`
 	}{}
 
-	err = json.NewDecoder(response.Body).Decode(&result)
+	err = HTTP.GetJSON(ServiceEtherscan, url, &result)
 	if err != nil {
-		if response.StatusCode != http.StatusOK {
-			err = fmt.Errorf("API request failed! Status: %s", response.Status)
-		}
 		return
 	}
 	return WeiHexStrToFloat64(result.Balance)
@@ -2,7 +2,6 @@ package client
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -58,7 +57,6 @@ func (explorer Explorer) GetHaloSupply() (supply float64, err error) {
 	// if supply < 40*1e7 {
 	// 	supply *= 800
 	// }
-	return
 }
 
 // GetHaloBalance retrieves Halo address balance
@@ -75,25 +73,18 @@ func (explorer Explorer) GetHaloBalance(address string) (balance float64, err er
 		address,
 	)
 
-	client := &http.Client{}
 	request, err := http.NewRequest("POST", explorer.MainnetGQL, bytes.NewBuffer([]byte(gqlQueryStr)))
 	if err != nil {
 		return
 	}
 	request.Header.Set("Content-Type", "application/json")
-	response, err := client.Do(request)
-	if err != nil {
-		return
-	}
 	result := struct {
 		Balance string `json:"result"`
 	}{}
 
-	err = json.NewDecoder(response.Body).Decode(&result)
+	// read-only RPC call, safe to retry
+	err = HTTP.DoJSON(ServiceHaloRPC, request, true, &result)
 	if err != nil {
-		if response.StatusCode != http.StatusOK {
-			err = fmt.Errorf("API request failed! Status: %s", response.Status)
-		}
 		return
 	}
 	return WeiHexStrToFloat64(result.Balance)
@@ -0,0 +1,329 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Names of the upstream services used to group HTTP requests for timeouts, circuit breaking and stats
+const (
+	ServiceBlockCypher = "blockcypher"
+	ServiceCMC         = "cmc"
+	ServiceCoinCap     = "coincap"
+	ServiceDEX         = "halodex"
+	ServiceEtherscan   = "etherscan"
+	ServiceExplorer    = "explorer"
+	ServiceHaloRPC     = "halorpc"
+	ServiceMNDApp      = "mndapp"
+)
+
+// ErrCircuitOpen is returned when requests to an upstream service are rejected due to consecutive failures
+var ErrCircuitOpen = errors.New("Service temporarily unavailable")
+
+// HTTP is the shared HTTP executor used by all API clients
+var HTTP = NewHTTPExecutor()
+
+// ServiceConfig describes timeout, retry and circuit breaker settings of an upstream service
+type ServiceConfig struct {
+	// Request timeout in seconds including reading the response body
+	TimeoutSeconds float64 `json:"timeoutseconds"`
+	// Maximum number of retries for idempotent requests. Retries are attempted on network errors, 5xx and 429.
+	// Use -1 to disable retries.
+	MaxRetries int `json:"maxretries"`
+	// Base delay in milliseconds between retries. Doubles on each retry with random jitter.
+	RetryDelayMS int64 `json:"retrydelayms"`
+	// Number of consecutive failures after which requests are rejected without being sent.
+	// Use -1 to disable the circuit breaker.
+	BreakerThreshold int `json:"breakerthreshold"`
+	// Number of seconds requests are rejected before trying again
+	BreakerCooldownSeconds float64 `json:"breakercooldownseconds"`
+}
+
+// DefaultServiceConfig is used for services that are not configured
+var DefaultServiceConfig = ServiceConfig{
+	TimeoutSeconds:         30,
+	MaxRetries:             2,
+	RetryDelayMS:           500,
+	BreakerThreshold:       5,
+	BreakerCooldownSeconds: 60,
+}
+
+// ServiceStats describes request counters of an upstream service
+type ServiceStats struct {
+	// Number of requests sent, including retries
+	Requests int64
+	// Number of failed requests (network errors, 5xx and 429), including retries
+	Errors  int64
+	Retries int64
+	// Number of requests rejected by the circuit breaker
+	Rejected int64
+	// Total duration of all requests sent
+	TotalLatency time.Duration
+	LastError    string
+	LastErrorAt  time.Time
+	CircuitOpen  bool
+}
+
+// AverageLatency returns the average duration of the requests sent
+func (s ServiceStats) AverageLatency() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Requests)
+}
+
+// Response contains the status and the entire body of a HTTP response
+type Response struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+type service struct {
+	config              ServiceConfig
+	stats               ServiceStats
+	consecutiveFailures int
+	openUntil           time.Time
+}
+
+// HTTPExecutor sends HTTP requests with per service timeouts, retries and circuit breakers.
+// Response bodies are always read and closed.
+type HTTPExecutor struct {
+	client   *http.Client
+	mutex    sync.Mutex
+	defaults ServiceConfig
+	services map[string]*service
+}
+
+// NewHTTPExecutor instantiates a HTTPExecutor
+func NewHTTPExecutor() *HTTPExecutor {
+	return &HTTPExecutor{
+		client:   &http.Client{},
+		defaults: DefaultServiceConfig,
+		services: map[string]*service{},
+	}
+}
+
+// Configure sets the settings of services. Missing values are taken from the "default" item, if available, or
+// DefaultServiceConfig otherwise. Counters are kept.
+func (e *HTTPExecutor) Configure(configs map[string]ServiceConfig) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.defaults = mergeServiceConfig(configs["default"], DefaultServiceConfig)
+	for name, s := range e.services {
+		s.config = mergeServiceConfig(configs[name], e.defaults)
+	}
+	for name, c := range configs {
+		if name != "default" {
+			e.getService(name).config = mergeServiceConfig(c, e.defaults)
+		}
+	}
+}
+
+// Stats returns a copy of the counters of all services used so far
+func (e *HTTPExecutor) Stats() map[string]ServiceStats {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	stats := map[string]ServiceStats{}
+	for name, s := range e.services {
+		st := s.stats
+		st.CircuitOpen = time.Now().Before(s.openUntil)
+		stats[name] = st
+	}
+	return stats
+}
+
+// Do sends the request to the service. Idempotent requests are retried on failure.
+// The request body, if any, must be created using http.NewRequest to allow retries.
+func (e *HTTPExecutor) Do(serviceName string, request *http.Request, idempotent bool) (response *Response, err error) {
+	e.mutex.Lock()
+	config := e.getService(serviceName).config
+	e.mutex.Unlock()
+	maxRetries := config.MaxRetries
+	if !idempotent || maxRetries < 0 {
+		maxRetries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			e.mutex.Lock()
+			e.getService(serviceName).stats.Retries++
+			e.mutex.Unlock()
+			time.Sleep(retryDelay(config.RetryDelayMS, attempt))
+			if request.GetBody != nil {
+				body, err := request.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				request.Body = body
+			}
+		}
+		if !e.allow(serviceName) {
+			return nil, fmt.Errorf("%s: %v", serviceName, ErrCircuitOpen)
+		}
+		start := time.Now()
+		response, err = e.send(request, config)
+		e.record(serviceName, time.Since(start), response, err)
+		if !shouldRetry(response, err) || attempt >= maxRetries {
+			return
+		}
+		log.Printf("[%s] [HTTP] Retrying request %s. Attempt: %d, Error: %v\n", serviceName, request.URL.Path, attempt+1,
+			responseError(response, err))
+	}
+}
+
+// Observe records the result of a request sent without using the executor. Eg: by a third-party API client library.
+func (e *HTTPExecutor) Observe(serviceName string, latency time.Duration, err error) {
+	var response *Response
+	if err == nil {
+		response = &Response{StatusCode: http.StatusOK}
+	}
+	e.record(serviceName, latency, response, err)
+}
+
+// DoJSON sends the request to the service and decodes the JSON response into result
+func (e *HTTPExecutor) DoJSON(serviceName string, request *http.Request, idempotent bool, result interface{}) error {
+	response, err := e.Do(serviceName, request, idempotent)
+	if err != nil {
+		return err
+	}
+	return response.DecodeJSON(result)
+}
+
+// GetJSON sends a GET request to the service and decodes the JSON response into result
+func (e *HTTPExecutor) GetJSON(serviceName, url string, result interface{}) error {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	return e.DoJSON(serviceName, request, true, result)
+}
+
+// DecodeJSON decodes the response body into result.
+// Returns the response status as error if decoding fails on an unsuccessful response.
+func (r *Response) DecodeJSON(result interface{}) (err error) {
+	err = json.Unmarshal(r.Body, result)
+	if err != nil && r.StatusCode != http.StatusOK {
+		err = fmt.Errorf("API request failed! Status: %s", r.Status)
+	}
+	return
+}
+
+// send sends a single request and reads the entire response body within the timeout
+func (e *HTTPExecutor) send(request *http.Request, config ServiceConfig) (response *Response, err error) {
+	client := *e.client
+	client.Timeout = time.Duration(config.TimeoutSeconds * float64(time.Second))
+	r, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	response = &Response{StatusCode: r.StatusCode, Status: r.Status, Body: body}
+	return
+}
+
+// allow checks if the circuit breaker allows sending a request. Once the cooldown is over, a single request is
+// allowed to check if the service has recovered.
+func (e *HTTPExecutor) allow(serviceName string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	s := e.getService(serviceName)
+	if s.config.BreakerThreshold <= 0 || s.consecutiveFailures < s.config.BreakerThreshold {
+		return true
+	}
+	now := time.Now()
+	if now.Before(s.openUntil) {
+		s.stats.Rejected++
+		return false
+	}
+	// allow one request until the result is recorded
+	s.openUntil = now.Add(time.Duration(s.config.BreakerCooldownSeconds * float64(time.Second)))
+	return true
+}
+
+// record updates the counters and circuit breaker state of a service
+func (e *HTTPExecutor) record(serviceName string, latency time.Duration, response *Response, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	s := e.getService(serviceName)
+	s.stats.Requests++
+	s.stats.TotalLatency += latency
+	if !shouldRetry(response, err) {
+		s.consecutiveFailures = 0
+		s.openUntil = time.Time{}
+		return
+	}
+	s.stats.Errors++
+	s.stats.LastError = responseError(response, err).Error()
+	s.stats.LastErrorAt = time.Now()
+	s.consecutiveFailures++
+	if s.config.BreakerThreshold > 0 && s.consecutiveFailures >= s.config.BreakerThreshold {
+		if s.consecutiveFailures == s.config.BreakerThreshold {
+			log.Printf("[%s] [HTTP] Circuit open after %d consecutive failures\n", serviceName, s.consecutiveFailures)
+		}
+		s.openUntil = time.Now().Add(time.Duration(s.config.BreakerCooldownSeconds * float64(time.Second)))
+	}
+}
+
+// getService returns the service, creates a new one with the default config if not exists. Mutex must be locked.
+func (e *HTTPExecutor) getService(name string) *service {
+	s, ok := e.services[name]
+	if !ok {
+		s = &service{config: e.defaults}
+		e.services[name] = s
+	}
+	return s
+}
+
+// shouldRetry checks if request failed due to network errors or server side issues
+func shouldRetry(response *Response, err error) bool {
+	return err != nil || response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+}
+
+// responseError returns err or the response status as error
+func responseError(response *Response, err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("Status: %s", response.Status)
+}
+
+// retryDelay returns exponential backoff delay, randomised between half and full delay to avoid retries from
+// concurrent requests being sent at the same time
+func retryDelay(baseMS int64, attempt int) time.Duration {
+	max := baseMS << uint(attempt-1)
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(max/2+rand.Int63n(max/2+1)) * time.Millisecond
+}
+
+// mergeServiceConfig sets the missing (zero) values of c using defaults
+func mergeServiceConfig(c, defaults ServiceConfig) ServiceConfig {
+	if c.TimeoutSeconds <= 0 {
+		c.TimeoutSeconds = defaults.TimeoutSeconds
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = defaults.MaxRetries
+	}
+	if c.RetryDelayMS <= 0 {
+		c.RetryDelayMS = defaults.RetryDelayMS
+	}
+	if c.BreakerThreshold == 0 {
+		c.BreakerThreshold = defaults.BreakerThreshold
+	}
+	if c.BreakerCooldownSeconds <= 0 {
+		c.BreakerCooldownSeconds = defaults.BreakerCooldownSeconds
+	}
+	return c
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestExecutor(config ServiceConfig) *HTTPExecutor {
+	e := NewHTTPExecutor()
+	e.Configure(map[string]ServiceConfig{"test": config})
+	return e
+}
+
+func TestHTTPExecutorRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+	e := newTestExecutor(ServiceConfig{MaxRetries: 2, RetryDelayMS: 1, BreakerThreshold: -1})
+
+	request, _ := http.NewRequest("POST", server.URL, strings.NewReader(`{"id": 1}`))
+	result := struct {
+		ID int `json:"id"`
+	}{}
+	if err := e.DoJSON("test", request, true, &result); err != nil {
+		t.Fatal(err)
+	}
+	// request body must be sent again on retries
+	if result.ID != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	stats := e.Stats()["test"]
+	if stats.Requests != 3 || stats.Errors != 2 || stats.Retries != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// non-idempotent requests must not be retried
+	atomic.StoreInt32(&requests, 0)
+	request, _ = http.NewRequest("POST", server.URL, strings.NewReader(`{"id": 1}`))
+	response, err := e.Do("test", request, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusBadGateway || atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("unexpected response: %d after %d requests", response.StatusCode, requests)
+	}
+}
+
+func TestHTTPExecutorCircuitBreaker(t *testing.T) {
+	var requests int32
+	var down int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	e := newTestExecutor(ServiceConfig{
+		MaxRetries:             -1,
+		BreakerThreshold:       2,
+		BreakerCooldownSeconds: 0.05,
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := e.GetJSON("test", server.URL, &[]string{}); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	err := e.GetJSON("test", server.URL, &[]string{})
+	if err == nil || !strings.Contains(err.Error(), ErrCircuitOpen.Error()) {
+		t.Fatalf("expected circuit to be open, got: %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("expected request to be rejected without being sent, got %d requests", n)
+	}
+	stats := e.Stats()["test"]
+	if !stats.CircuitOpen || stats.Rejected != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// service recovered
+	atomic.StoreInt32(&down, 0)
+	time.Sleep(60 * time.Millisecond)
+	if err = e.GetJSON("test", server.URL, &[]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if e.Stats()["test"].CircuitOpen {
+		t.Fatal("expected circuit to be closed")
+	}
+}
+
+func TestHTTPExecutorTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	e := newTestExecutor(ServiceConfig{TimeoutSeconds: 0.05, MaxRetries: -1})
+	start := time.Now()
+	if err := e.GetJSON("test", server.URL, &[]string{}); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Fatalf("request not timed out: %s", d)
+	}
+	if stats := e.Stats()["test"]; stats.Errors != 1 || stats.LastError == "" {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Localizer translates the labels and formats the numbers and dates of the formatted outputs. Eg: Ticker.Format
+type Localizer interface {
+	// T translates a message and formats it using the arguments, if any
+	T(msg string, args ...interface{}) string
+	// Num formats a number rounded to dp decimal places using the separators of the language
+	Num(num float64, dp int) string
+	// Date formats a date and time using the format of the language
+	Date(t time.Time) string
+}
+
+// English formats the outputs in English using the default number and date formats
+var English Localizer = english{}
+
+type english struct{}
+
+func (english) T(msg string, args ...interface{}) string {
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+func (english) Num(num float64, dp int) string {
+	return FormatNum(num, dp)
+}
+
+func (english) Date(t time.Time) string {
+	return FormatTS(t)
+}
+
+// padRight pads a text with spaces to the number of characters. Longer texts are not truncated.
+func padRight(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// labels translates the labels and pads them to the length of the longest one, so that the values are aligned
+func labels(l Localizer, names ...string) []string {
+	width := 0
+	translated := make([]string, len(names))
+	for i, name := range names {
+		translated[i] = l.T(name)
+		if n := utf8.RuneCountInString(translated[i]); n > width {
+			width = n
+		}
+	}
+	for i := range translated {
+		translated[i] = padRight(translated[i], width)
+	}
+	return translated
+}
+
+// numShort formats a number like FormatNumShort using the number format of the localizer. Eg: 1.50 M
+func numShort(l Localizer, num float64, dp int) string {
+	if dp < 0 {
+		dp = 0
+	}
+	scaled, n := shortScale(num)
+	return l.Num(scaled, dp) + " " + n
+}
+
+// percent formats a percentage using the number format of the localizer. Eg: 1.23%
+func percent(l Localizer, num float64, dp int) string {
+	return l.Num(num, dp) + "%"
+}
+
+// tierTable formats values of the tiers 1 to 4 as a table with a labelled row for each set of values
+func tierTable(l Localizer, rowLabels []string, rows [][4]string) (s string) {
+	label := labels(l, rowLabels...)
+	widths := [4]int{}
+	header := [4]string{}
+	for i := range header {
+		header[i] = l.T("Tier %d", i+1)
+		widths[i] = utf8.RuneCountInString(header[i])
+		for _, row := range rows {
+			if n := utf8.RuneCountInString(row[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	line := func(first string, values [4]string) string {
+		cells := []string{}
+		for i, v := range values {
+			cells = append(cells, padRight(v, widths[i]))
+		}
+		return first + strings.TrimRight(strings.Join(cells, " | "), " ") + "\n"
+	}
+	s = line(strings.Repeat(" ", utf8.RuneCountInString(label[0])+3), header) + DashLine
+	for i, row := range rows {
+		if i > 0 {
+			s += DashLine
+		}
+		s += line(label[i]+" : ", row)
+	}
+	return
+}
+
+// table formats rows as columns padded to the widest value and separated by "| ".
+// The header is followed by a dash line and, if rowLines is true, so is every row.
+func table(header []string, rows [][]string, rowLines bool) (s string) {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, v := range row {
+			if n := utf8.RuneCountInString(v); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	line := func(values []string) string {
+		cells := []string{}
+		for i, v := range values {
+			cells = append(cells, padRight(v, widths[i]+1))
+		}
+		return strings.TrimRight(strings.Join(cells, "| "), " ") + "\n"
+	}
+	s = line(header) + DashLine
+	for _, row := range rows {
+		s += line(row)
+		if rowLines {
+			s += DashLine
+		}
+	}
+	return
+}
@@ -2,12 +2,11 @@ package client
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -31,11 +30,10 @@ type MNDApp struct {
 	TierBlockRewards TierBlockRewards `json:"tierblockrewards"`
 	HostingFeeUSD    float64          `json:"hostingfeeusd"`
 	// Cached data
-	RewardPool         Payout
-	LastPayout         Payout
-	LastAlert          time.Time
 	tierDistCache      map[int]float64
 	tierDistCachedTime time.Time
+	// guards the tier distribution cache. MNDApp must not be copied after first use.
+	tierDistMutex sync.Mutex
 }
 
 // TierBlockRewards block reward distribution per tier
@@ -111,48 +109,43 @@ type Message struct {
 }
 
 // Format returns payout data as strings
-func (p Payout) Format() (s string) {
+func (p Payout) Format(l Localizer) (s string) {
+	label := labels(l, "Time", "Minted", "Service Fees", "Total", "Duration", "Hosting Fee", "Halo Price Used")
 	s = fmt.Sprintf(""+
-		"Time   : %s UTC (approx.)\n"+DashLine+
-		"Minted : %s    | S.Fees : %s\n"+DashLine+
-		"Total  : %s    | Duration : %s\n"+DashLine+
-		"Hosting Fee: $%s (%sH) | $%s/month\n"+DashLine+
-		"Halo Price Used: $%s\n",
-		FillOrLimit(p.Time.UTC().String(), " ", 16),
-		FillOrLimit(FormatNum(p.Minted, 0), " ", 10),
-		FillOrLimit(FormatNum(p.Fees, 0), " ", 10),
-		FillOrLimit(FormatNum(p.Total, 0), " ", 10),
-		p.Duration,
-		FormatNum(p.HostingFeeUSD, 4),
-		FormatNum(p.HostingFeeHalo, 0),
-		FormatNum(p.HostingFeePerMonth, 2),
-		FillOrLimit(p.Price, " ", 10),
+		"%s : %s\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : %s\n"+DashLine+
+		"%s : $%s\n",
+		label[0], l.T("%s UTC (approx.)", l.Date(p.Time.UTC())),
+		label[1], l.Num(p.Minted, 0),
+		label[2], l.Num(p.Fees, 0),
+		label[3], l.Num(p.Total, 0),
+		label[4], p.Duration,
+		label[5], l.T("$%s (%s HALO) | $%s/month", l.Num(p.HostingFeeUSD, 4), l.Num(p.HostingFeeHalo, 0),
+			l.Num(p.HostingFeePerMonth, 2)),
+		label[6], l.Num(p.Price, 8),
 	)
 	return
 }
 
 // FormatAlert returns payout data as string for payout alert
-func (p Payout) FormatAlert(blockURL string) (s string) {
-	s = fmt.Sprintf("Delicious payout is served!```js\n%s"+DashLine+
-		"         Tier 1 | Tier 2 | Tier 3 | Tier 4\n"+DashLine+
-		"Rewards: %s | %s | %s | %s\n"+DashLine+
-		"Nodes  : %s | %s | %s | %s\n```",
-		p.Format(),
-		FillOrLimit(FormatNum(p.Tiers["t1"]-p.HostingFeeHalo, 0), " ", 6),
-		FillOrLimit(FormatNum(p.Tiers["t2"]-p.HostingFeeHalo, 0), " ", 6),
-		FillOrLimit(FormatNum(p.Tiers["t3"]-p.HostingFeeHalo, 0), " ", 6),
-		FillOrLimit(FormatNum(p.Tiers["t4"]-p.HostingFeeHalo, 0), " ", 7),
-		FillOrLimit(FormatNum(p.TierNodes["t1"], 0), " ", 6),
-		FillOrLimit(FormatNum(p.TierNodes["t2"], 0), " ", 6),
-		FillOrLimit(FormatNum(p.TierNodes["t3"], 0), " ", 6),
-		FillOrLimit(FormatNum(p.TierNodes["t4"], 0), " ", 7),
-	)
+func (p Payout) FormatAlert(l Localizer, blockURL string) (s string) {
+	rewards, nodes := [4]string{}, [4]string{}
+	for i := range rewards {
+		tier := fmt.Sprintf("t%d", i+1)
+		rewards[i] = l.Num(p.Tiers[tier]-p.HostingFeeHalo, 0)
+		nodes[i] = l.Num(p.TierNodes[tier], 0)
+	}
+	s = l.T("Delicious payout is served!") + "```js\n" + p.Format(l) + DashLine +
+		tierTable(l, []string{"Rewards", "Nodes"}, [][4]string{rewards, nodes}) + "```"
 	if p.BlockNumber > 0 {
 		s += blockURL
 	}
-	s += "```fix\nDisclaimer: Actual amount received may vary from " +
-		"the amounts displayed due to the tier distribution returned by " +
-		"API includes ineligible node statuses.```"
+	s += "```fix\n" + l.T("Disclaimer: Actual amount received may vary from the amounts displayed due to the tier "+
+		"distribution returned by API includes ineligible node statuses.") + "```"
 	return
 }
 
@@ -162,87 +155,27 @@ func (p Payout) FormatAlert(blockURL string) (s string) {
 // @blockReward   float64             : number of coins minted per minting cycle
 // @blockTimemins float64             : minting cycle duration in minutes
 // @collateral    map[string] float64 : required collateral for each tier
-func (p Payout) FormatROI(blockReward, blockTimeMins float64, collateral map[string]float64) (s string) {
-	// deduct fees
-	t1Reward := p.Tiers["t1"] - p.HostingFeeHalo
-	t2Reward := p.Tiers["t2"] - p.HostingFeeHalo
-	t3Reward := p.Tiers["t3"] - p.HostingFeeHalo
-	t4Reward := p.Tiers["t4"] - p.HostingFeeHalo
-
-	s += fmt.Sprintf(""+
-		"            Tier 1 | Tier 2 | Tier 3 | Tier 4\n"+DashLine+
-		"Halo/MN   : %s | %s | %s | %s\n",
-		FillOrLimit(FormatNum(t1Reward, 0), " ", 6),
-		FillOrLimit(FormatNum(t2Reward, 0), " ", 6),
-		FillOrLimit(FormatNum(t3Reward, 0), " ", 6),
-		FillOrLimit(FormatNum(t4Reward, 0), " ", 6),
-	)
-	// Reward per 400k Halo
-	s += fmt.Sprintf(DashLine+
-		"Halo/400k : %s | %s | %s | %s\n",
-		FillOrLimit(FormatNum(t1Reward, 0), " ", 6),
-		FillOrLimit(FormatNum(t2Reward/2, 0), " ", 6),
-		FillOrLimit(FormatNum(t3Reward/5, 0), " ", 6),
-		FillOrLimit(FormatNum(t4Reward/15, 0), " ", 6),
-	)
+func (p Payout) FormatROI(l Localizer, blockReward, blockTimeMins float64, collateral map[string]float64) (s string) {
+	// Collateral per 400k Halo
+	per400k := map[string]float64{"t1": 1, "t2": 2, "t3": 5, "t4": 15}
 	lastRMins := p.Minted / blockReward * blockTimeMins
-	t1HourlyH := t1Reward / lastRMins * 60
-	t2HourlyH := t2Reward / lastRMins * 60
-	t3HourlyH := t3Reward / lastRMins * 60
-	t4HourlyH := t4Reward / lastRMins * 60
-	// ROI per hour
-	s += fmt.Sprintf(DashLine+
-		"Halo/hour : %s | %s | %s | %s\n",
-		FillOrLimit(t1HourlyH, " ", 6),
-		FillOrLimit(t2HourlyH, " ", 6),
-		FillOrLimit(t3HourlyH, " ", 6),
-		FillOrLimit(t4HourlyH, " ", 6),
-	)
-	t1DailyROI := (t1Reward / lastRMins * 1440) / collateral["t1"] * 100
-	t2DailyROI := (t2Reward / lastRMins * 1440) / collateral["t2"] * 100
-	t3DailyROI := (t3Reward / lastRMins * 1440) / collateral["t3"] * 100
-	t4DailyROI := (t4Reward / lastRMins * 1440) / collateral["t4"] * 100
-	// ROI days
-	s += fmt.Sprintf(DashLine+
-		"Days/100%% : %s | %s | %s | %s\n",
-		FillOrLimit(FormatNum(100/t1DailyROI, 0), " ", 6),
-		FillOrLimit(FormatNum(100/t2DailyROI, 0), " ", 6),
-		FillOrLimit(FormatNum(100/t3DailyROI, 0), " ", 6),
-		FillOrLimit(FormatNum(100/t4DailyROI, 0), " ", 6),
-	)
-	// ROI per day
-	s += fmt.Sprintf(DashLine+
-		"Daily     : %s%% | %s%% | %s%% | %s%%\n",
-		FillOrLimit(t1DailyROI, " ", 5),
-		FillOrLimit(t2DailyROI, " ", 5),
-		FillOrLimit(t3DailyROI, " ", 5),
-		FillOrLimit(t4DailyROI, " ", 5),
-	)
-	// ROI per week
-	s += fmt.Sprintf(DashLine+
-		"Weekly    : %s%% | %s%% | %s%% | %s%%\n",
-		FillOrLimit(t1DailyROI*7, " ", 5),
-		FillOrLimit(t2DailyROI*7, " ", 5),
-		FillOrLimit(t3DailyROI*7, " ", 5),
-		FillOrLimit(t4DailyROI*7, " ", 5),
-	)
-	// ROI per month
-	s += fmt.Sprintf(DashLine+
-		"Monthly   : %s%% | %s%% | %s%% | %s%%\n",
-		FillOrLimit(t1DailyROI*30, " ", 5),
-		FillOrLimit(t2DailyROI*30, " ", 5),
-		FillOrLimit(t3DailyROI*30, " ", 5),
-		FillOrLimit(t4DailyROI*30, " ", 5),
-	)
-	// ROI per year
-	s += fmt.Sprintf(DashLine+
-		"Yearly    : %s%% | %s%% | %s%% | %s%%\n",
-		FillOrLimit(t1DailyROI*365, " ", 5),
-		FillOrLimit(t2DailyROI*365, " ", 5),
-		FillOrLimit(t3DailyROI*365, " ", 5),
-		FillOrLimit(t4DailyROI*365, " ", 5),
-	)
-	return
+	rows := make([][4]string, 8)
+	for i := 0; i < 4; i++ {
+		tier := fmt.Sprintf("t%d", i+1)
+		// deduct fees
+		reward := p.Tiers[tier] - p.HostingFeeHalo
+		dailyROI := (reward / lastRMins * 1440) / collateral[tier] * 100
+		rows[0][i] = l.Num(reward, 0)
+		rows[1][i] = l.Num(reward/per400k[tier], 0)
+		rows[2][i] = l.Num(reward/lastRMins*60, 2)
+		rows[3][i] = l.Num(100/dailyROI, 0)
+		rows[4][i] = percent(l, dailyROI, 3)
+		rows[5][i] = percent(l, dailyROI*7, 2)
+		rows[6][i] = percent(l, dailyROI*30, 2)
+		rows[7][i] = percent(l, dailyROI*365, 2)
+	}
+	return tierTable(l, []string{"Halo/MN", "Halo/400k", "Halo/hour", "Days/100%", "Daily", "Weekly", "Monthly",
+		"Yearly"}, rows)
 }
 
 // CalcReward calculates reward per masternode given minted coins, service fees and tier distribution
@@ -254,7 +187,7 @@ func (p Payout) FormatROI(blockReward, blockTimeMins float64, collateral map[str
 // t2s    float64 : number of active nodes in tier 2
 // t3s    float64 : number of active nodes in tier 3
 // t4s    float64 : number of active nodes in tier 4
-func (m MNDApp) CalcReward(minted, fees, t1s, t2s, t3s, t4s float64) (
+func (m *MNDApp) CalcReward(minted, fees, t1s, t2s, t3s, t4s float64) (
 	t1r, t2r, t3r, t4r float64, duration string) {
 	if t1s > 0 {
 		r, _ := m.TierBlockRewards["t1"]
@@ -305,38 +238,30 @@ func (m Masternode) GetStatusName() string {
 }
 
 // Format formats Masternode into string with cards layout
-func (m Masternode) Format() string {
+func (m Masternode) Format(l Localizer) string {
+	addresses := labels(l, "Owner Address", "Contract Address")
+	left, right := labels(l, "Tier", "Status"), labels(l, "Shares", "Rewards")
 	return fmt.Sprintf(""+
-		"Owner Address   :\n%s\n"+DashLine+
-		"Contract Address:\n%s\n"+DashLine+
-		"Tier   : %d          | Shares  : %s\n"+DashLine+
-		"Status : %s  | Rewards : %s",
-		m.Owner,
-		m.Address,
-		m.Tier,
-		FormatNum(m.Shares, 0),
-		FillOrLimit(m.GetStatusName(), " ", 9),
-		FormatNum(m.RewardBalance, 0),
+		"%s :\n%s\n"+DashLine+
+		"%s :\n%s\n"+DashLine+
+		"%s : %s | %s : %s\n"+DashLine+
+		"%s : %s | %s : %s",
+		addresses[0], m.Owner,
+		addresses[1], m.Address,
+		left[0], padRight(fmt.Sprint(m.Tier), 10), right[0], l.Num(m.Shares, 0),
+		left[1], padRight(l.T(m.GetStatusName()), 10), right[1], l.Num(m.RewardBalance, 0),
 	)
 }
 
 // GetMasternodes retrieves list of masternodes by owner address
 func (m *MNDApp) GetMasternodes(ownerAddress string) (nodes []Masternode, err error) {
-	response, err := http.Get(m.BaseURL + "/owned/" + ownerAddress)
-	if err != nil {
-		return
-	}
-
 	result := struct {
 		Error  string       `json:"error,omitempty"`
 		Result []Masternode `json:"result,omitempty"`
 	}{}
 
-	err = json.NewDecoder(response.Body).Decode(&result)
+	err = HTTP.GetJSON(ServiceMNDApp, m.BaseURL+"/owned/"+ownerAddress, &result)
 	if err != nil {
-		if response.StatusCode != http.StatusOK {
-			err = fmt.Errorf("API request failed! Status: %s", response.Status)
-		}
 		return
 	}
 	nodes = result.Result
@@ -348,10 +273,10 @@ func (m *MNDApp) GetMasternodes(ownerAddress string) (nodes []Masternode, err er
 }
 
 // FormatNodes formats a list of nodes in to table-like string
-func (MNDApp) FormatNodes(nodes []Masternode) (list, summary string) {
+func (*MNDApp) FormatNodes(l Localizer, nodes []Masternode) (list, summary string) {
 	num := len(nodes)
 	if num == 0 {
-		list = "No masternodes available"
+		list = l.T("No masternodes available")
 		return
 	}
 
@@ -360,7 +285,7 @@ func (MNDApp) FormatNodes(nodes []Masternode) (list, summary string) {
 	var inactive float64
 	var rewardBalance float64
 
-	list = "    Address  |T|  Shares | Rewards | Status\n" + DashLine
+	rows := [][]string{}
 	for i := 0; i < num; i++ {
 		n := nodes[i]
 		colorSign := "-"
@@ -369,16 +294,13 @@ func (MNDApp) FormatNodes(nodes []Masternode) (list, summary string) {
 			colorSign = "+"
 		}
 		mlen := len(n.Address)
-		nTxt := fmt.Sprintf(
-			"%s|%s |%d| %s | %s| %s\n",
-			colorSign,
-			n.Address[:5]+".."+n.Address[mlen-3:],
-			n.Tier,
-			FillOrLimit(FormatNum(n.Shares, 0), " ", 7),
-			FillOrLimit(FormatNum(n.RewardBalance, 0), " ", 8),
-			n.GetStatusName(),
-		)
-		list += nTxt + DashLine
+		rows = append(rows, []string{
+			colorSign + "|" + n.Address[:5] + ".." + n.Address[mlen-3:],
+			fmt.Sprint(n.Tier),
+			l.Num(n.Shares, 0),
+			l.Num(n.RewardBalance, 0),
+			l.T(n.GetStatusName()),
+		})
 		tierShares[n.Tier] += n.Shares
 		totalInvested += n.Shares
 		rewardBalance += n.RewardBalance
@@ -386,29 +308,33 @@ func (MNDApp) FormatNodes(nodes []Masternode) (list, summary string) {
 			inactive += n.Shares
 		}
 	}
-
-	summary = "================== Summary ===================\n" +
-		"Invested    | Active      | Inactive    | Nodes\n" + DashLine +
-		fmt.Sprintf("%s| %s| %s| %d\n",
-			FillOrLimit(FormatNumShort(totalInvested, 4), " ", 12),
-			FillOrLimit(FormatNumShort(totalInvested-inactive, 4), " ", 12),
-			FillOrLimit(FormatNumShort(inactive, 4), " ", 12),
-			num)
-	summary += "\nTier 1    | Tier 2    | Tier 3    | Tier 4\n" + DashLine +
-		fmt.Sprintf("%s| %s| %s| %s\n",
-			FillOrLimit(FormatNumShort(tierShares[1], 2), " ", 10),
-			FillOrLimit(FormatNumShort(tierShares[2], 2), " ", 10),
-			FillOrLimit(FormatNumShort(tierShares[3], 2), " ", 10),
-			FillOrLimit(FormatNumShort(tierShares[4], 2), " ", 10),
-		)
+	list = table([]string{"  " + l.T("Address"), "T", l.T("Shares"), l.T("Rewards"), l.T("Status")}, rows, true)
+
+	summary = "================== " + l.T("Summary") + " ===================\n" +
+		table([]string{l.T("Invested"), l.T("Active"), l.T("Inactive"), l.T("Nodes")}, [][]string{{
+			numShort(l, totalInvested, 4),
+			numShort(l, totalInvested-inactive, 4),
+			numShort(l, inactive, 4),
+			fmt.Sprint(num),
+		}}, false)
+	tiers := []string{}
+	for tier := 1; tier <= 4; tier++ {
+		tiers = append(tiers, l.T("Tier %d", tier))
+	}
+	summary += "\n" + table(tiers, [][]string{{
+		numShort(l, tierShares[1], 2),
+		numShort(l, tierShares[2], 2),
+		numShort(l, tierShares[3], 2),
+		numShort(l, tierShares[4], 2),
+	}}, false)
 	if rewardBalance > 0 {
-		summary += fmt.Sprintf("%sRewards Balance: %s", DashLine, FormatNum(rewardBalance, 0))
+		summary += DashLine + l.T("Rewards Balance: %s", l.Num(rewardBalance, 0))
 	}
 	return
 }
 
 // GetMNRewardBalance retrieves masternode reward balance
-func (m MNDApp) GetMNRewardBalance(contractAddr, ownerAddr string) (balance float64, err error) {
+func (m *MNDApp) GetMNRewardBalance(contractAddr, ownerAddr string) (balance float64, err error) {
 	return m.GetETHCallWeiToBalance(
 		contractAddr,
 		"0x13692c4d000000000000000000000000"+strings.TrimPrefix(ownerAddr, "0x"),
@@ -416,7 +342,7 @@ func (m MNDApp) GetMNRewardBalance(contractAddr, ownerAddr string) (balance floa
 }
 
 // GetETHCallWeiToBalance retrieves invokes eth_call to a smart contract and converts retunted wei to balance
-func (m MNDApp) GetETHCallWeiToBalance(contractAddress, data string) (balance float64, err error) {
+func (m *MNDApp) GetETHCallWeiToBalance(contractAddress, data string) (balance float64, err error) {
 	gqlQueryStr := fmt.Sprintf(`{
 		"id": %d,
 		"method": "eth_call",
@@ -438,37 +364,29 @@ func (m MNDApp) GetETHCallWeiToBalance(contractAddress, data string) (balance fl
 	}
 	request.Header.Set("content-type", "application/json")
 
-	response, err := (&http.Client{}).Do(request)
-	if err != nil {
-		return
-	}
-
-	bodyBytes, err := ioutil.ReadAll(response.Body)
 	result := struct {
 		Result string `json:"result"`
 	}{}
-	err = json.Unmarshal(bodyBytes, &result)
+	// read-only RPC call, safe to retry
+	err = HTTP.DoJSON(ServiceHaloRPC, request, true, &result)
 	if err != nil {
-		if response.StatusCode != http.StatusOK {
-			err = fmt.Errorf("API request failed! Status: %s", response.Status)
-		}
 		return
 	}
 	return WeiHexStrToFloat64(result.Result)
 }
 
 // GetServiceFeesBalance retrieves all service fees collected by Halo Platform during the on-going payout cycle
-func (m MNDApp) GetServiceFeesBalance() (fees float64, err error) {
+func (m *MNDApp) GetServiceFeesBalance() (fees float64, err error) {
 	return m.GetETHCallWeiToBalance(m.RewardPoolContract, "0xbc3cde60")
 }
 
 // GetMintedBalance retrieves the total minted pool balance during the on-going payout cycle
-func (m MNDApp) GetMintedBalance() (balance float64, err error) {
+func (m *MNDApp) GetMintedBalance() (balance float64, err error) {
 	return m.GetETHCallWeiToBalance(m.RewardPoolContract, "0x405187f4")
 }
 
 // GetFormattedPoolData returns reward pool data including minting and service pool balances as formatted strings
-func (m *MNDApp) GetFormattedPoolData() (s string, err error) {
+func (m *MNDApp) GetFormattedPoolData(l Localizer) (s string, err error) {
 	minted, err := m.GetMintedBalance()
 	if err != nil {
 		return
@@ -479,21 +397,22 @@ func (m *MNDApp) GetFormattedPoolData() (s string, err error) {
 	}
 	totalMins := (int(minted / m.BlockReward * m.BlockTimeMins))
 	duration := fmt.Sprintf("%02d:%02d", int(totalMins/60), totalMins%60)
+	label := labels(l, "Minted Coins", "Service Fees", "Total", "Duration")
 	s = fmt.Sprintf(""+
-		"Minted Coins : %s\n"+
-		"Service Fees : %s\n"+
-		"Total        : %s\n"+
-		"Duration     : %s",
-		FormatNum(minted, 0),
-		FormatNum(fees, 0),
-		FormatNum(minted+fees, 0),
-		duration,
+		"%s : %s\n"+
+		"%s : %s\n"+
+		"%s : %s\n"+
+		"%s : %s",
+		label[0], l.Num(minted, 0),
+		label[1], l.Num(fees, 0),
+		label[2], l.Num(minted+fees, 0),
+		label[3], duration,
 	)
 	return
 }
 
 // GetTierDistribution retrieves the total number of active MNs for a specific tier
-func (m MNDApp) GetTierDistribution(tierNo int) (filled float64, err error) {
+func (m *MNDApp) GetTierDistribution(tierNo int) (filled float64, err error) {
 	if tierNo < 1 || tierNo > 4 {
 		err = errors.New("Invalid tier")
 		return
@@ -512,8 +431,35 @@ func (m MNDApp) GetTierDistribution(tierNo int) (filled float64, err error) {
 	return
 }
 
+// TierDistCacheUpdatedAt returns the time the cached tier distribution was last updated. Zero if not cached yet.
+func (m *MNDApp) TierDistCacheUpdatedAt() time.Time {
+	m.tierDistMutex.Lock()
+	defer m.tierDistMutex.Unlock()
+	return m.tierDistCachedTime
+}
+
+// CopyCache copies the cached tier distribution from another client. Used when the client is replaced, eg: when the
+// config is reloaded.
+func (m *MNDApp) CopyCache(from *MNDApp) {
+	if from == m {
+		return
+	}
+	from.tierDistMutex.Lock()
+	cache, cachedTime := map[int]float64{}, from.tierDistCachedTime
+	for tier, d := range from.tierDistCache {
+		cache[tier] = d
+	}
+	from.tierDistMutex.Unlock()
+
+	m.tierDistMutex.Lock()
+	defer m.tierDistMutex.Unlock()
+	m.tierDistCache, m.tierDistCachedTime = cache, cachedTime
+}
+
 // GetAllTierDistribution returns number of active masternodes in each of the 4 tiers
 func (m *MNDApp) GetAllTierDistribution() (t1, t2, t3, t4 float64, err error) {
+	m.tierDistMutex.Lock()
+	defer m.tierDistMutex.Unlock()
 	if m.tierDistCache == nil {
 		m.tierDistCache = map[int]float64{}
 	}
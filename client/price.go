@@ -0,0 +1,99 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Price describes the USD price of a token along with where and when it was retrieved
+type Price struct {
+	Symbol string
+	USD    float64
+	// Total supply of the token, if provided by the source
+	TotalSupply float64
+	// Name of the source the price was retrieved from
+	Source string
+	// Time the price was last updated by the source
+	Time time.Time
+}
+
+// Format formats price with source and timestamp into a single line string
+func (p Price) Format(l Localizer) string {
+	return l.T("%s: $%s by %s @ %s UTC", p.Symbol, l.Num(p.USD, 8), p.Source, l.Date(p.Time.UTC()))
+}
+
+// PriceSource retrieves USD price of tokens
+type PriceSource interface {
+	// Name returns the name of the source
+	Name() string
+	// GetPrice retrieves the USD price of a token by symbol
+	GetPrice(symbol string) (Price, error)
+}
+
+// PriceSources is a list of price sources in the order of priority
+type PriceSources []PriceSource
+
+// GetPrice retrieves price from the first source that succeeds. Returns error only if all sources fail.
+func (sources PriceSources) GetPrice(symbol string) (p Price, err error) {
+	if len(sources) == 0 {
+		err = errors.New("No price source available")
+		return
+	}
+	errs := []string{}
+	for _, source := range sources {
+		p, err = source.GetPrice(symbol)
+		if err == nil && p.USD > 0 {
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("Price not available for %s", symbol)
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", source.Name(), err))
+	}
+	err = errors.New(strings.Join(errs, "; "))
+	return
+}
+
+// DEXPrice derives the USD price of HaloDEX tokens using the last price of the token against the base token
+// (eg: HALO/ETH) multiplied by the USD price of the base token retrieved from the base sources.
+type DEXPrice struct {
+	DEX        *DEX
+	BaseTicker string
+	// Sources used to retrieve the base token price
+	BaseSources PriceSources
+}
+
+// Name returns the name of the source
+func (dp *DEXPrice) Name() string {
+	return "HaloDEX"
+}
+
+// GetPrice retrieves the USD price of a HaloDEX token
+func (dp *DEXPrice) GetPrice(symbol string) (p Price, err error) {
+	symbol = strings.ToUpper(symbol)
+	if symbol == dp.BaseTicker {
+		err = fmt.Errorf("Cannot derive price of the base token %s", symbol)
+		return
+	}
+	base, err := dp.BaseSources.GetPrice(dp.BaseTicker)
+	if err != nil {
+		return
+	}
+	ticker, err := dp.DEX.GetTicker(symbol, dp.BaseTicker, base.USD, 0)
+	if err != nil {
+		return
+	}
+	p = Price{
+		Symbol: symbol,
+		USD:    ticker.Last * base.USD,
+		Source: fmt.Sprintf("%s (%s by %s)", dp.Name(), dp.BaseTicker, base.Source),
+		Time:   ticker.LastUpdated,
+	}
+	if base.Time.Before(p.Time) {
+		// price is only as recent as the oldest of the two
+		p.Time = base.Time
+	}
+	return
+}
@@ -74,6 +74,12 @@ func FormatNumShort(num float64, dp int) string {
 	if dp < 0 {
 		dp = 0
 	}
+	scaled, n := shortScale(num)
+	return fmt.Sprintf("%."+fmt.Sprint(dp)+"f %s", scaled, n)
+}
+
+// shortScale scales a large number down and returns the initial of the number name. Eg: 1500000 => 1.5, "M"
+func shortScale(num float64) (float64, string) {
 	e, n := 0, ""
 	switch {
 	case num < 1e3:
@@ -94,7 +100,7 @@ func FormatNumShort(num float64, dp int) string {
 		e, n = 15, "Q"
 		break
 	}
-	return fmt.Sprintf("%."+fmt.Sprint(dp)+"f %s", num/math.Pow10(e), n)
+	return num / math.Pow10(e), n
 }
 
 // FormatTimeReverse formats time to string in the following format: HH:MM:SS DD-Mon
@@ -135,13 +141,19 @@ func WriteFile(destinationPath string, text string, permission os.FileMode) erro
 	return ioutil.WriteFile(destinationPath, []byte(text), permission)
 }
 
-// SaveJSONFile writes supplied data as foratted JSON
+// SaveJSONFile writes supplied data as foratted JSON. The file is replaced atomically by writing to a temporary
+// file first, so that a failed write does not leave the file corrupted.
 func SaveJSONFile(filename string, data interface{}) (err error) {
 	dataBytes, err := json.MarshalIndent(data, "", "    ")
 	if err != nil {
 		return
 	}
-	return ioutil.WriteFile(filename, dataBytes, 0644)
+	tmpFilename := filename + ".tmp"
+	err = ioutil.WriteFile(tmpFilename, dataBytes, 0644)
+	if err != nil {
+		return
+	}
+	return os.Rename(tmpFilename, filename)
 }
 
 // SaveJSONFileLarge writes supplied data as foratted JSON. Create file if not exists.
@@ -150,9 +162,8 @@ func SaveJSONFileLarge(filename string, data interface{}) (err error) {
 	if err != nil {
 		return
 	}
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0666)
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
-		fmt.Println("create failed")
 		return
 	}
 	defer file.Close()
@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"sort"
 	"strings"
-
-	"github.com/bwmarrin/discordgo"
 )
 
 // Commands Command list with command name as key
@@ -32,15 +30,20 @@ type Command struct {
 	// 1. first argument "name" is a single-word variable text and it is a required argument
 	// 2. second argument "email" is a keyword argument where the value MUST be exactly as typed, without the curly braces.
 	// 3. third argument "address" is optional. Being the last argument it's value is not restricted to a single word.
+	// Built-in commands may also specify argument types, names of keyword groups and repeated arguments, which are
+	// validated by the argument parser and omitted when displayed. See parseArgSpec.
+	// Example 2: <action:{add}|{remove}> [limit:int(1,50)] [address:address...]
 	ArgumentsText string `json:"argumentstext"`
 	// Whether the command can be used in public channels/groups.
 	// If true, the command can only be invoked by texting the "bot user" privately
 	IsPublic bool `json:"ispublic"`
 	// Whether this command can only be executed by an admin when in a public channel.
-	// Irrelevant for private messages/channels.
+	// Only root users can execute it in private messages/channels.
 	IsAdminOnly bool `json:"isadminonly"`
 	// An example of how to use the command
 	Example string `json:"example"`
+	// Alternative names of built-in commands
+	Aliases []string `json:"aliases,omitempty"`
 	// For Info/Custom commands
 	Arguments Arguments `json:"arguments"`
 	Message   string    `json:"message"`
@@ -55,8 +58,21 @@ type Argument struct {
 	Description string `json:"description"`
 }
 
+// helpLegend explains the notation of the command arguments
+const helpLegend = "\n<argument> => required" +
+	"\n[argument] => optional" +
+	"\n{argument} => indicates exact value" +
+	"\nargument... => one or more values" +
+	"\n\nDefaults where applicable:\n - Base ticker => ETH,\n - Quote ticker => Halo\n" +
+	" - Address(es) => first/all item(s) saved on address book, if available"
+
 // Generate text for the help command
-func generateHelpText(commands Commands, publicOnly bool) (s string) {
+func generateHelpText(commands Commands, prefix string, publicOnly bool) (s string) {
+	return strings.Join(helpLines(commands, prefix, publicOnly), "") + helpLegend
+}
+
+// helpLines returns a line per command for the help command
+func helpLines(commands Commands, prefix string, publicOnly bool) (lines []string) {
 	cmdNames := []string{}
 	for name := range commands {
 		if commands[name].Type == "text" && commands[name].Message == "" {
@@ -72,65 +88,82 @@ func generateHelpText(commands Commands, publicOnly bool) (s string) {
 		if (publicOnly && !command.IsPublic) || (!publicOnly && command.IsAdminOnly) {
 			continue
 		}
-		s += fmt.Sprintf("!%s %s\n", name, command.ArgumentsText)
+		lines = append(lines, fmt.Sprintf("%s%s %s\n", prefix, name, command.ArgumentsText))
 	}
-	s += "\n<argument> => required"
-	s += "\n[argument] => optional"
-	s += "\n{argument} => indicates exact value"
-	s += "\n\nDefaults where applicable:\n - Base ticker => ETH,\n - Quote ticker => Halo\n" +
-		" - Address(es) => first/all item(s) saved on address book, if available"
 	return
 }
 
-// commandHelpText returns help text for a specific command
-func commandHelpText(commands Commands, commandName string) (s string) {
+// commandHelpText returns help text for a specific command in the language, using the translated description and
+// example if available. Commands mentioned in the description and examples are rendered with prefix.
+func commandHelpText(commands Commands, prefix, lang, commandName string) (s string) {
+	commandName = strings.ToLower(commandName)
+	if _, found := commands[commandName]; !found && commandAliases[commandName] != "" {
+		commandName = commandAliases[commandName]
+	}
 	for cmdName, command := range commands {
-		if cmdName != strings.ToLower(commandName) {
+		if cmdName != commandName {
 			continue
 		}
 		if command.Type == "text" && command.Message == "" {
 			return
 		}
-		s += fmt.Sprintf("!%s %s: \n  - %s \n", cmdName, command.ArgumentsText, command.Description)
+		if text, found := state.Catalog(lang).Commands[cmdName]; found {
+			if text.Description != "" {
+				command.Description = text.Description
+			}
+			if text.Example != "" {
+				command.Example = text.Example
+			}
+		}
+		s += fmt.Sprintf("%s%s %s: \n  - %s \n", prefix, cmdName, command.ArgumentsText,
+			withPrefix(command.Description, prefix))
 		if command.Example != "" {
 			seperator := "\n           "
-			exampleF := seperator + strings.Join(strings.Split(command.Example, "OR, "), seperator)
+			exampleF := seperator + strings.Join(strings.Split(withPrefix(command.Example, prefix), "OR, "), seperator)
 			if exampleF != "" {
-				s += fmt.Sprintf("  - Example: %s\n", exampleF)
+				s += tr(lang, "  - Example: %s\n", exampleF)
 			}
 		}
+		if len(command.Aliases) > 0 {
+			s += tr(lang, "  - Aliases: %s\n", prefix+strings.Join(command.Aliases, ", "+prefix))
+		}
 		if command.IsAdminOnly {
-			s += "  - Guild admin command. Only available in guilds and with user role: ButlerAdmin\n"
+			s += tr(lang, "  - Guild admin command. Only available in guilds to admins. See: %sperms\n", prefix)
 		}
 		if !command.IsPublic {
-			s += "  - Private command. Only available by PMing the bot.\n"
+			s += tr(lang, "  - Private command. Only available by PMing the bot.\n")
 		}
 		s += "\n"
 	}
 	if s == "" {
-		s = commandName + " is not a valid command"
+		s = tr(lang, "%s is not a valid command", commandName)
 	}
 	return
 }
 
-func helpHanlder(discord *discordgo.Session, channelID, guildID, debugTag string, isPrivateMsg bool, cmdArgs []string, numArgs int) {
+func helpHanlder(discord Messenger, channelID, guildID, prefix, lang, debugTag string, isPrivateMsg bool,
+	args commandArgs) {
 	txt := ""
+	cmdName := args.String("command-name", "")
 	isGuild := guildID != ""
-	guildHasCmd := guildCommands[guildID] != nil
-	fmt.Println("gID", guildID, txt)
-	if numArgs > 0 && (!isGuild || !guildHasCmd) {
-		txt = commandHelpText(commands, cmdArgs[0])
-	} else if numArgs > 0 && isGuild {
-		txt = commandHelpText(guildCommands[guildID], cmdArgs[0])
-	} else if isPrivateMsg && isGuild {
-		txt = generateHelpText(guildCommands[guildID], false)
-	} else if isPrivateMsg {
-		txt = generateHelpText(commands, false)
-	} else if isGuild && guildHasCmd {
-		txt = generateHelpText(guildCommands[guildID], true)
-	} else {
-		txt = generateHelpText(commands, true)
+	commands := state.Commands()
+	guildCommands, guildHasCmd := state.GuildCommands(guildID)
+	if cmdName != "" && (!isGuild || !guildHasCmd) {
+		txt = commandHelpText(commands, prefix, lang, cmdName)
+	} else if cmdName != "" && isGuild {
+		txt = commandHelpText(guildCommands, prefix, lang, cmdName)
+	}
+	if txt != "" {
+		_, err := discordSend(discord, channelID, "css\n"+txt, true)
+		logErrorTS(debugTag, err)
+		return
+	}
+
+	// list of commands is sent in pages with the legend on every page
+	if isGuild && (isPrivateMsg || guildHasCmd) {
+		commands = guildCommands
 	}
-	_, err := discordSend(discord, channelID, "css\n"+txt, true)
+	pages := textPages("css\n", helpLines(commands, prefix, !isPrivateMsg), rowsPerPage, tr(lang, helpLegend))
+	err := sendPages(discord, channelID, lang, 1, len(pages), staticPages(pages))
 	logErrorTS(debugTag, err)
 }
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alien45/halo-info-bot/client"
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandRequest describes a command invocation received from Discord
+type commandRequest struct {
+	Discord Messenger
+	Message *discordgo.MessageCreate
+	// Name of the command after resolving aliases
+	Name      string
+	GuildID   string
+	ChannelID string
+	Username  string
+	// Command prefix of the guild
+	Prefix string
+	// Language of the replies. See State.Language.
+	Lang string
+	// Whether the message was sent privately or on a privacy exception channel
+	IsPrivateMsg bool
+	// Arguments validated against the argument specification of the command
+	Args          commandArgs
+	UserAddresses []string
+	DebugTag      string
+}
+
+// builtinCommand describes a command implemented by the bot
+type builtinCommand struct {
+	Name    string
+	Aliases []string
+	// Default description and example. Can be overridden using the commands file.
+	Description string
+	Example     string
+	// Construct and types of the supported arguments. See Command.ArgumentsText and parseArgSpec.
+	ArgumentsText string
+	argSpec       argSpec
+	// Whether the command can be used in public channels
+	IsPublic bool
+	// Whether the command can only be executed by admins or the root user
+	IsAdminOnly bool
+	Handler     func(r *commandRequest)
+}
+
+// commandText contains the text of a built-in command that can be overridden using the commands file
+type commandText struct {
+	Description string `json:"description"`
+	Example     string `json:"example"`
+}
+
+var (
+	// builtinCommands lists the commands implemented by the bot in the order registered
+	builtinCommands []*builtinCommand
+	// commandAliases maps aliases to command names
+	commandAliases = map[string]string{}
+)
+
+// registerCommand adds a built-in command to the registry.
+// Panics if name or alias is already registered or the argument specification is invalid.
+func registerCommand(c builtinCommand) {
+	spec, err := parseArgSpec(c.ArgumentsText)
+	if err != nil {
+		panic(fmt.Sprintf("Command %s: %v", c.Name, err))
+	}
+	c.argSpec = spec
+	for _, name := range append([]string{c.Name}, c.Aliases...) {
+		if findBuiltinCommand(name) != nil {
+			panic("Command already registered: " + name)
+		}
+	}
+	builtinCommands = append(builtinCommands, &c)
+	for _, alias := range c.Aliases {
+		commandAliases[alias] = c.Name
+	}
+}
+
+// findBuiltinCommand returns the built-in command by name or alias. Nil if not found.
+func findBuiltinCommand(name string) *builtinCommand {
+	if cmdName, isAlias := commandAliases[name]; isAlias {
+		name = cmdName
+	}
+	for _, c := range builtinCommands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// loadCommandTexts reads the text overrides of the built-in commands from the commands file.
+// Returns an error if the file contains unknown commands.
+func loadCommandTexts(filename string) (texts map[string]commandText, err error) {
+	texts = map[string]commandText{}
+	str, err := client.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal([]byte(str), &texts); err != nil {
+		return
+	}
+	unknown := []string{}
+	for name := range texts {
+		if c := findBuiltinCommand(name); c == nil || c.Name != name {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		err = fmt.Errorf("Unknown commands in %s: %s", filename, strings.Join(unknown, ", "))
+	}
+	return
+}
+
+// builtinCommandList generates the list of built-in commands with text overridden where available
+func builtinCommandList(texts map[string]commandText) Commands {
+	commands := Commands{}
+	for _, c := range builtinCommands {
+		command := Command{
+			Type:          "complex",
+			Description:   c.Description,
+			ArgumentsText: c.argSpec.String(),
+			IsPublic:      c.IsPublic,
+			IsAdminOnly:   c.IsAdminOnly,
+			Example:       c.Example,
+			Aliases:       c.Aliases,
+		}
+		if text, ok := texts[c.Name]; ok {
+			if text.Description != "" {
+				command.Description = text.Description
+			}
+			if text.Example != "" {
+				command.Example = text.Example
+			}
+		}
+		commands[c.Name] = command
+	}
+	return commands
+}
+
+func init() {
+	registerCommand(builtinCommand{
+		Name:          "address",
+		Aliases:       []string{"addresses"},
+		Description:   "Add, remove and get list of saved addresses.",
+		ArgumentsText: "[action:{add}|{remove}|{delete}] [address...]",
+		Example:       "!address OR, !address add 0x1234 OR, !address remove 0x1234",
+		Handler: func(r *commandRequest) {
+			cmdAddress(r.Discord, r.ChannelID, r.Username, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "alert",
+		Description: "Enable/disable automatic alerts. Alert types: payout, trades, price. " +
+			"Actions:on, off, status, send, update, hostingfee, list, remove. " +
+			"Only root user can use 'send' to trigger payout alert manually. " +
+			"Trade alerts are sent for HaloDEX trades of the pair worth at least the minimum USD value " +
+			"(default: $5,000). Use 'off' without a pair to turn off all trade alerts of the channel. " +
+			"Price alerts are sent by private message when the price (default: USD) goes above or below the value " +
+			"or moves by the percentage within the window. Use 'repeat' to keep the alert after it is sent.",
+		ArgumentsText: "<type:{payout}|{trades}|{price}> " +
+			"[action:{on}|{off}|{status}|{send}|{update}|{hostingfee}|{list}|{remove}] " +
+			"[quote-ticker:ticker] [condition:{above}|{below}|{move}] [base-ticker:ticker] [value:number...] " +
+			"[unit:{usd}|{eth}] [window:{15m}|{30m}|{1h}|{4h}|{12h}|{24h}] [mode:{once}|{repeat}]",
+		Example: "!alert payout on OR, !alert payout status OR, !alert payout send 99999 99 OR, " +
+			"!alert payout update 10000 100 OR, !alert payout hostingfee 19.99 OR, !alert trades on halo eth 10000 OR, " +
+			"!alert trades off OR, !alert price halo above 0.02 OR, !alert price halo below 0.00005 eth repeat OR, " +
+			"!alert price halo move 5 1h OR, !alert price list OR, !alert price remove 1",
+		IsPublic: true,
+		Handler: func(r *commandRequest) {
+			cmdAlert(r.Discord, r.Message, r.ChannelID, r.Username, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "audit",
+		Description: "Show the most recent privileged actions in the guild: who did what, where, and the values " +
+			"before and after the change. Use on/off to send new entries to the current channel. " +
+			"Root users can also view other guilds, private messages (private) or all (all).",
+		ArgumentsText: "[action:{on}|{off}] [guild] [count:int(1,100)]",
+		Example:       "!audit OR, !audit 20 OR, !audit on OR, !audit all 50",
+		IsPublic:      true,
+		IsAdminOnly:   true,
+		Handler: func(r *commandRequest) {
+			cmdAudit(r.Discord, r.Message, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "balance",
+		Description: "Check your account balance. Supported addresses/chains: BTC, Dash, ETH, Halo and  LTC. " +
+			"Address keywords: 'reward-pool', 'charity', 'h-eth', 'dex-halo'. " +
+			"If no address supplied, the first item of user's address book will be used. " +
+			"To get balance of a specific item from address book just type the index number of the address.",
+		ArgumentsText: "[address:wallet] [ticker:{btc}|{dash}|{eth}|{halo}|{ltc}]",
+		Example: "!balance 0x1234567890abcdef OR, !balance dex-halo OR, !balance OR, " +
+			"!balance 2 (for 2nd item in the address book)",
+		IsPublic: true,
+		Handler: func(r *commandRequest) {
+			cmdBalance(r.Discord, r.ChannelID, r.Lang, r.DebugTag, r.Args, r.UserAddresses)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name:          "cmc",
+		Description:   "Fetch CoinMarketCap ticker information. Alternatively, use the ticker itself as command.",
+		ArgumentsText: "<ticker>",
+		Example:       "!cmc powr, OR, !cmc power ledger, OR, !powr (shorthand for '!cmc powr')",
+		IsPublic:      true,
+		Handler: func(r *commandRequest) {
+			nameOrSymbol := strings.ToUpper(r.Args.String("ticker", ""))
+			ticker, err := state.CMC().GetTicker(nameOrSymbol)
+			if commandErrorIf(err, r.Discord, r.ChannelID, tr(r.Lang, "Ticker not found or query failed."), r.DebugTag) {
+				return
+			}
+			_, err = sendFormatted(r.Discord, r.GuildID, r.ChannelID, "js\n"+ticker.Format(localizer(r.Lang)),
+				cmcTickerEmbed(r.Lang, ticker))
+			logErrorTS(r.DebugTag, err)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "dexbalance",
+		Description: "Shows user's HaloDEX balances: total, available, in orders and USD value. " +
+			"USE YOUR HALO CHAIN ADDRESS FOR ALL TOKEN BALANCES WITHIN DEX. Zero balances are hidden unless tickers supplied. " +
+			"If no address supplied, will use user's first address book item when available.",
+		ArgumentsText: "[address:address] [ticker:ticker...]",
+		Example:       "!dexbalance 0x1234 OR, !dexbalance 0x1234 ETH OR, !dexbalance",
+		Handler: func(r *commandRequest) {
+			cmdDexBalance(r.Discord, r.ChannelID, r.Lang, r.DebugTag, r.Args, r.UserAddresses)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: guildCMD,
+		Description: "Add guild-specific custom commands. Supported actions: add, remove, update.\n" +
+			"Adding a command name same as built-in commands will override it. " +
+			"To remove an existing command from the guild add the intended command with empty message. " +
+			"Example: !guildcmd add balance.\nTo restore deleted built-in command: !guildcmd remove balance",
+		ArgumentsText: "<action:{add}|{update}|{remove}|{delete}> <command-name> [message]",
+		Example:       "!guildcmd add sayhello Hello Discord OR, !guildcmd remove sayhello",
+		IsPublic:      true,
+		IsAdminOnly:   true,
+		Handler: func(r *commandRequest) {
+			guildCMDHandler(r.Discord, r.Message, r.Lang, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "halo",
+		Description: "Get a digest of information about Halo including ticker info from DEX, reward pool and " +
+			"recent trades.",
+		IsPublic: true,
+		Handler: func(r *commandRequest) {
+			cmdDexTicker(r.Discord, r.GuildID, r.ChannelID, r.Lang, r.DebugTag, commandArgs{})
+			txt, err := state.MNDApp().GetFormattedPoolData(localizer(r.Lang))
+			if err == nil {
+				_, err = discordSend(r.Discord, r.ChannelID, "js\n"+txt, true)
+			}
+			logErrorTS(r.DebugTag, err)
+			cmdDexTrades(r.Discord, r.ChannelID, r.Lang, r.DebugTag, commandArgs{"limit": {"5"}})
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "help",
+		Description: "Prints list of commands and supported arguments. " +
+			"If argument 'command' is provided will display detailed information about the command along with examples.",
+		ArgumentsText: "[command-name]",
+		Example:       "!help OR, !help balance",
+		IsPublic:      true,
+		Handler: func(r *commandRequest) {
+			helpHanlder(r.Discord, r.ChannelID, r.GuildID, r.Prefix, r.Lang, r.DebugTag, r.IsPrivateMsg, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "language",
+		Description: "Show or change the language of the replies. Your language overrides the server language. " +
+			"Guild admins can change the server language using 'guild'. Use 'reset' to remove the language.",
+		ArgumentsText: "[scope:{guild}] [language]",
+		Example:       "!language OR, !language es OR, !language reset OR, !language guild es",
+		IsPublic:      true,
+		Handler: func(r *commandRequest) {
+			cmdLanguage(r.Discord, r.Message, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name:          "mn",
+		Description:   "Get information about masternodes, payouts etc.",
+		ArgumentsText: "[topic:{collateral}|{nodes}|{payout}|{pool}|{roi}]",
+		Example:       "!mn OR, !mn payout OR, !mn roi OR, !mn collateral",
+		IsPublic:      true,
+		Handler: func(r *commandRequest) {
+			cmdMN(r.Discord, r.ChannelID, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "nodes",
+		Description: "Lists masternodes owned by a specific address. " +
+			"If no address supplied, will use user's first address book item when available.",
+		ArgumentsText: "[mode:{full}] [address:address...]",
+		Example:       "!nodes 0x1234 OR, !nodes OR, !nodes full 0x123 0x324 0x234",
+		Handler: func(r *commandRequest) {
+			cmdNodes(r.Discord, r.GuildID, r.ChannelID, r.Lang, r.DebugTag, r.Args, r.UserAddresses)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "orderbook",
+		Description: "HaloDEX order book aggregated by price level with the cumulative depth in both tokens and USD, " +
+			"the best bid and ask and the spread.",
+		ArgumentsText: "[quote-ticker:ticker] [base-ticker:ticker] [depth:int(1,50)]",
+		Example:       "!orderbook OR, !orderbook halo eth 20 OR, !orderbook vet eth",
+		IsPublic:      true,
+		Handler: func(r *commandRequest) {
+			cmdDexOrderbook(r.Discord, r.ChannelID, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "orders",
+		Description: "Open HaloDEX orders of an address: side, price, amount, filled percentage and age. " +
+			"If no address supplied, will use user's first address book item when available.",
+		ArgumentsText: "[quote-ticker:ticker] [base-ticker:ticker] [address:address]",
+		Example:       "!orders halo eth 0x1234567890abcdef OR, !orders OR, !orders vet eth 2",
+		Handler: func(r *commandRequest) {
+			cmdDexOrders(r.Discord, r.ChannelID, r.Lang, r.DebugTag, r.Args, r.UserAddresses)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "output",
+		Description: "Show or change how tickers, tokens, masternodes and payout alerts are displayed in the guild: " +
+			"as embeds or code blocks. Default: codeblock",
+		ArgumentsText: "[style:{embed}|{codeblock}]",
+		Example:       "!output OR, !output embed OR, !output codeblock",
+		IsPublic:      true,
+		IsAdminOnly:   true,
+		Handler: func(r *commandRequest) {
+			cmdOutput(r.Discord, r.Message, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "perms",
+		Description: "Show or change the roles granting admin permissions and the permission required to use " +
+			"commands in the guild: everyone, admin, root or a role. Admins can use all commands except root only.",
+		ArgumentsText: "[action:{addadmin}|{removeadmin}|{set}|{reset}] [target] [level]",
+		Example: "!perms OR, !perms addadmin @Moderators OR, !perms set nodes @Members OR, " +
+			"!perms set halo admin OR, !perms reset nodes",
+		IsPublic:    true,
+		IsAdminOnly: true,
+		Handler: func(r *commandRequest) {
+			cmdPerms(r.Discord, r.Message, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "prefix",
+		Description: "Show or change the command prefix of the guild. " +
+			"The bot also responds to commands starting with a mention of the bot, eg: @HaloButler ticker vet.",
+		ArgumentsText: "[action:{set}|{reset}] [new-prefix]",
+		Example:       "!prefix OR, !prefix set ? OR, !prefix reset",
+		IsPublic:      true,
+		IsAdminOnly:   true,
+		Handler: func(r *commandRequest) {
+			cmdPrefix(r.Discord, r.Message, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name: "reload",
+		Description: "Reload config, commands, message catalogs and/or Discord data files without restarting the " +
+			"bot. Reloads all if no target supplied. Root user only.",
+		ArgumentsText: "[target:{config}|{commands}|{locales}|{data}]",
+		Example:       "!reload OR, !reload commands",
+		IsPublic:      true,
+		IsAdminOnly:   true,
+		Handler: func(r *commandRequest) {
+			cmdReload(r.Discord, r.Message, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name:          "ticker",
+		Description:   "Get ticker information from HaloDEX.",
+		ArgumentsText: "[quote-ticker:ticker] [base-ticker:ticker]",
+		Example:       "!ticker OR, !ticker vet OR, !ticker dbet eth",
+		IsPublic:      true,
+		Handler: func(r *commandRequest) {
+			cmdDexTicker(r.Discord, r.GuildID, r.ChannelID, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name:          "tokens",
+		Description:   "Lists all tokens supported on HaloDEX",
+		ArgumentsText: "[ticker:ticker]",
+		Example:       "!tokens OR, !tokens halo",
+		IsPublic:      true,
+		Handler: func(r *commandRequest) {
+			cmdDexTokens(r.Discord, r.GuildID, r.ChannelID, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+	registerCommand(builtinCommand{
+		Name:          "trades",
+		Description:   "Recent trades from HaloDEX",
+		ArgumentsText: "[quote-ticker:ticker] [base-ticker:ticker] [limit:int(1,50)] [page-no:int(1,1000)]",
+		Example:       "!trades halo eth 10 OR, !trades eth halo OR, !trades",
+		IsPublic:      true,
+		Handler: func(r *commandRequest) {
+			cmdDexTrades(r.Discord, r.ChannelID, r.Lang, r.DebugTag, r.Args)
+		},
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommandRegistry(t *testing.T) {
+	fake := setupCommandTest(t)
+	// every built-in command must be listed with the registered visibility
+	for _, c := range builtinCommands {
+		if c.Handler == nil || c.Description == "" {
+			t.Errorf("%s: handler and description required", c.Name)
+		}
+		if state.IsPrivateCommand(c.Name) == c.IsPublic {
+			t.Errorf("%s: unexpected visibility", c.Name)
+		}
+	}
+	reply := send(fake, testGuildID, testChannelID, "alice", "!dexbalance 0x1234")
+	if !strings.Contains(reply, "Private commands are not allowed") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!help")
+	if !strings.Contains(reply, "!dexbalance [address] [ticker...]") || !strings.Contains(reply, "!orders [quote-ticker]") {
+		t.Fatalf("private help should list all registered commands: %q", reply)
+	}
+
+	// aliases
+	reply = send(fake, "", testDMChannelID, "alice", "!addresses")
+	if !strings.Contains(reply, "No addresses available!") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!help addresses")
+	if !strings.Contains(reply, "!address [{add}|{remove}|{delete}] [address...]") || !strings.Contains(reply, "Aliases: !addresses") {
+		t.Fatalf("unexpected command help: %q", reply)
+	}
+}
+
+func TestCommandTextOverrides(t *testing.T) {
+	fake := setupCommandTest(t)
+	prevCommandsFile := commandsFile
+	defer func() { commandsFile = prevCommandsFile }()
+	commandsFile = filepath.Join(filepath.Dir(dataFile), "commands.json")
+
+	// only text can be overridden
+	overrides := `{"balance": {"description": "Custom description", "argumentstext": "<x>", "ispublic": false}}`
+	if err := ioutil.WriteFile(commandsFile, []byte(overrides), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := generateCommandLists(); err != nil {
+		t.Fatal(err)
+	}
+	reply := send(fake, testGuildID, testChannelID, "alice", "!help balance")
+	if !strings.Contains(reply, "!balance [address] [{btc}|{dash}|{eth}|{halo}|{ltc}]: \n  - Custom description") {
+		t.Fatalf("unexpected command help: %q", reply)
+	}
+	if state.IsPrivateCommand("balance") {
+		t.Fatal("visibility must not be overridden")
+	}
+
+	if err := ioutil.WriteFile(commandsFile, []byte(`{"addresses": {}, "foo": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := generateCommandLists()
+	if err == nil || !strings.Contains(err.Error(), "addresses, foo") {
+		t.Fatalf("expected unknown commands error, got: %v", err)
+	}
+}
@@ -2,227 +2,298 @@ package main
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/alien45/halo-info-bot/client"
-	"github.com/bwmarrin/discordgo"
 )
 
-func cmdDexTokens(discord *discordgo.Session, channelID, debugTag string, cmdArgs []string, numArgs int) {
-	txt := "Invalid/unsupported token."
+const (
+	// number of price levels shown on each side of the order book by default
+	defaultOrderbookDepth = 10
+	// maximum number of orders retrieved on each side of the order book
+	orderbookFetchLimit = 500
+	// maximum number of open orders of an address retrieved
+	ordersFetchLimit = 200
+)
+
+func cmdDexTokens(discord Messenger, guildID, channelID, lang, debugTag string, args commandArgs) {
+	txt := tr(lang, "Invalid/unsupported token.")
 	ticker := ""
 	token := client.Token{}
 	found := false
+	dex := state.DEX()
 	tokens, err := dex.GetTokens()
-	if numArgs == 0 {
-		txt, err = dex.GetFormattedTokens(tokens)
+	if !args.Has("ticker") {
+		txt, err = dex.GetFormattedTokens(localizer(lang), tokens)
 		if logErrorTS(debugTag, err) {
-			txt = "Failed to retrieve tokens"
+			txt = tr(lang, "Failed to retrieve tokens")
+			goto SendMessage
 		}
-		goto SendMessage
+		header, rows := tableRows("js\n" + txt)
+		pages := textPages(header, rows, rowsPerPage, "")
+		err = sendPages(discord, channelID, lang, 1, len(pages), staticPages(pages))
+		logErrorTS(debugTag, err)
+		return
 	}
 	if logErrorTS(debugTag, err) {
-		txt = "Failed to retrieve tokens"
+		txt = tr(lang, "Failed to retrieve tokens")
 		goto SendMessage
 	}
 
 	// ticker supplied
-	ticker = strings.ToUpper(cmdArgs[0])
+	ticker = args.String("ticker", "")
 	if token, found = tokens[ticker]; found {
-		txt = token.Format()
+		_, err = sendFormatted(discord, guildID, channelID, "js\n"+token.Format(localizer(lang)), tokenEmbed(lang, token))
+		logErrorTS(debugTag, err)
+		return
 	}
 SendMessage:
 	discordSend(discord, channelID, "js\n"+txt, true)
 }
 
-func cmdDexBalance(discord *discordgo.Session, channelID, debugTag string, cmdArgs, addresses []string, numArgs, numAddresses int) {
+// cmdDexBalance shows the HaloDEX account balances of an address along with the USD value derived from the DEX
+// tickers. Zero balances are hidden unless tickers are supplied.
+func cmdDexBalance(discord Messenger, channelID, lang, debugTag string, args commandArgs, addresses []string) {
 	txt := ""
 	var err error
-	address := ""
+	// address book item numbers are resolved by the argument parser
+	address := strings.ToLower(args.String("address", ""))
+	tickers := args.List("ticker")
+	tickerSupplied := len(tickers) > 0
 	showZeroBalances := true
-	if numArgs == 0 {
-		cmdArgs = []string{""}
-	}
-	address = strings.ToLower(cmdArgs[0])
-	tickerSupplied := numArgs >= 2 && cmdArgs[1] != "0"
-	tickers := cmdArgs[1:]
-	if address == "" || !strings.HasPrefix(address, "0x") {
-		// Invalid address supplied
-		i, err := strconv.ParseInt(address, 10, 64)
-		if err != nil {
-			// Use first address from user's addressbook, if available
-			i = 1
-		}
-		if numAddresses == 0 || i < 1 || numAddresses < int(i) {
-			// No/invalid address supplied and user has no address saved
-			txt = "Valid address or address book item number required."
+	dex := state.DEX()
+	var tokens map[string]client.Token
+	if address == "" {
+		if len(addresses) == 0 {
+			// No address supplied and user has no address saved
+			txt = tr(lang, "Valid address or address book item number required.")
 			goto SendMessage
 		}
-		i--
-
-		address = addresses[i]
+		// Use first address from user's addressbook
+		address = addresses[0]
 	}
 
+	tokens, err = dex.GetTokens()
+	if err != nil {
+		txt = tr(lang, "Failed to retrieve tokens")
+		logErrorTS(debugTag, err)
+		goto SendMessage
+	}
 	if !tickerSupplied {
 		// No ticker supplied, show all tickers' non-zero balances
 		showZeroBalances = false
-		tokens, err := dex.GetTokens()
-		if err != nil {
-			txt = "Failed to retrieve tokens"
-			logErrorTS(debugTag, err)
-			goto SendMessage
-		}
 		for ticker := range tokens {
 			tickers = append(tickers, ticker)
 		}
 	}
+	for _, ticker := range tickers {
+		if _, found := tokens[ticker]; !found {
+			txt = tr(lang, "Invalid/unsupported token.")
+			goto SendMessage
+		}
+	}
 	logTS(debugTag, "Address: "+address)
-	txt, err = dex.GetBalancesFormatted(address, tickers, showZeroBalances)
+	txt, err = dex.GetBalancesFormatted(localizer(lang), address, tickers, showZeroBalances,
+		dexPricesUSD(tokens, debugTag))
 	if err != nil {
-		txt = "Failed to retrieve balance."
+		txt = tr(lang, "Failed to retrieve balance.")
 		logErrorTS(debugTag, err)
 	}
 SendMessage:
 	discordSend(discord, channelID, "js\n"+txt, true)
 }
 
-func cmdDexTicker(discord *discordgo.Session, channelID, debugTag string, cmdArgs []string, numArgs int) {
-	symbolQuote := "HALO"
-	symbolBase := "ETH"
-	if numArgs > 0 {
-		symbolQuote = strings.ToUpper(cmdArgs[0])
+// dexPricesUSD returns the USD price of the HaloDEX tokens derived from the DEX tickers and the price of the base
+// tokens. Tokens without a price are omitted.
+func dexPricesUSD(tokens map[string]client.Token, debugTag string) map[string]float64 {
+	basePrices := map[string]float64{}
+	for ticker, token := range tokens {
+		if strings.ToUpper(token.Type) != "BASE" {
+			continue
+		}
+		if price, err := state.Prices().GetPrice(ticker); !logErrorTS(debugTag, err) {
+			basePrices[ticker] = price.USD
+		}
 	}
-	if numArgs > 1 {
-		symbolBase = strings.ToUpper(cmdArgs[1])
+	prices, err := state.DEX().GetPricesUSD(basePrices)
+	if logErrorTS(debugTag, err) {
+		return basePrices
 	}
+	return prices
+}
 
+func cmdDexTicker(discord Messenger, guildID, channelID, lang, debugTag string, args commandArgs) {
+	symbolQuote := args.String("quote-ticker", "HALO")
+	symbolBase := args.String("base-ticker", "ETH")
+
+	prices := state.Prices()
+	dex := state.DEX()
 	tokens, err := dex.GetTokens()
-	if commandErrorIf(err, discord, channelID, "Failed to retrieve tokens", debugTag) {
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve tokens"), debugTag) {
 		return
 	}
 
 	baseToken, existsB := tokens[symbolBase]
 	quoteToken, existsQ := tokens[symbolQuote]
 	if !existsB || !existsQ {
-		_, err = discordSend(discord, channelID, "Invalid/unsupported token", true)
-		commandErrorIf(err, discord, channelID, "Something went wrong!", debugTag)
+		_, err = discordSend(discord, channelID, tr(lang, "Invalid/unsupported token."), true)
+		logErrorTS(debugTag, err)
+		return
 	}
 
 	if strings.ToUpper(quoteToken.Type) == "BASE" && strings.ToUpper(baseToken.Type) == "TOKEN" {
 		// Tokens are in wrong direction. Swap 'em
-		fmt.Println("swap tokens ", symbolBase, symbolQuote)
+		logger.Debug("Swapping tokens", "tag", formatDebugTag(debugTag), "base", symbolBase, "quote", symbolQuote)
 		tempB := symbolBase
 		symbolBase = symbolQuote
 		symbolQuote = tempB
 	}
 
 	// Get base token price
-	cmcTicker, err := cmc.GetTicker(symbolBase)
-	if commandErrorIf(err, discord, channelID, "Failed to retrieve retrieve price of "+symbolBase, debugTag) {
+	basePrice, err := prices.GetPrice(symbolBase)
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve price of %s", symbolBase),
+		debugTag) {
 		return
 	}
-	basePriceUSD := cmcTicker.Quote["USD"].Price
-	var quoteSupply float64
 
-	quoteTicker, err := cmc.GetTicker(symbolQuote)
+	// Quote token supply is only used for the market cap
+	quotePrice, err := prices.GetPrice(symbolQuote)
 	logErrorTS(debugTag, err)
-	if commandErrorIf(err, discord, channelID, "Failed to retrieve quote ticker", debugTag) {
-		return
-	}
-	quoteSupply = quoteTicker.TotalSupply
 
-	ticker, err := dex.GetTicker(symbolQuote, symbolBase, basePriceUSD, quoteSupply)
-	if commandErrorIf(err, discord, channelID, "Failed to retrieve ticker", debugTag) {
+	ticker, err := dex.GetTicker(symbolQuote, symbolBase, basePrice.USD, quotePrice.TotalSupply)
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve ticker"), debugTag) {
 		return
 	}
 	logTS(debugTag, fmt.Sprintf("%s/%s ticker received: %s", symbolBase, symbolQuote, ticker.Pair))
 
-	_, err = discordSend(discord, channelID, "js\n"+ticker.Format(), true)
-	commandErrorIf(err, discord, channelID, "Something went wrong!", debugTag)
+	l := localizer(lang)
+	_, err = sendFormatted(discord, guildID, channelID, "js\n"+ticker.Format(l)+"\n"+client.DashLine+basePrice.Format(l),
+		tickerEmbed(lang, ticker, basePrice))
+	commandErrorIf(err, discord, channelID, tr(lang, "Something went wrong!"), debugTag)
 }
 
-func cmdDexTrades(discord *discordgo.Session, channelID, debugTag string, cmdArgs, userAddresses []string, numArgs, numAddresses int, command string) {
-	//TODO: add argument for timezone or allow user to save timezone??
-	allTokens, err := dex.GetTokens()
-	if commandErrorIf(err, discord, channelID, "Failed to retrieve tokens", debugTag) {
+// cmdDexOrderbook shows the bids and asks of a pair aggregated by price level along with the cumulative depth and
+// the spread
+func cmdDexOrderbook(discord Messenger, channelID, lang, debugTag string, args commandArgs) {
+	dex := state.DEX()
+	tokens, err := dex.GetTokens()
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve tokens"), debugTag) {
 		return
 	}
-	quoteTicker := "halo"
-	baseTicker := "eth"
-	var limit, pageNo int64 = 10, 1
-
-	if numArgs > 0 {
-		// Token symbol supplied
-		quote, _ := allTokens[strings.ToUpper(cmdArgs[0])]
-		quoteTicker = quote.Ticker
+	quote := tokens[args.String("quote-ticker", "HALO")]
+	base := tokens[args.String("base-ticker", "ETH")]
+	if quote.Ticker == "" || base.Ticker == "" {
+		_, err := discordSend(discord, channelID, tr(lang, "Invalid pair supplied: %s/%s",
+			args.String("quote-ticker", "HALO"), args.String("base-ticker", "ETH")), true)
+		logErrorTS(debugTag, err)
+		return
+	}
+	depth := int(args.Int("depth", defaultOrderbookDepth))
+	ob := client.Orderbook{
+		QuoteTicker: quote.Ticker,
+		BaseTicker:  base.Ticker,
+		PriceDP:     client.TokenDP(base),
+		AmountDP:    client.TokenDP(quote),
+	}
+	bids, err := dex.GetOrderbook(quote.Ticker, base.Ticker, orderbookFetchLimit, true)
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve orderbook"), debugTag) {
+		return
+	}
+	asks, err := dex.GetOrderbook(quote.Ticker, base.Ticker, orderbookFetchLimit, false)
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve orderbook"), debugTag) {
+		return
 	}
+	ob.Bids = client.AggregateOrders(bids, ob.PriceDP, depth)
+	ob.Asks = client.AggregateOrders(asks, ob.PriceDP, depth)
+	// depth in USD is omitted if the price is unavailable
+	if basePrice, err := state.Prices().GetPrice(base.Ticker); !logErrorTS(debugTag, err) {
+		ob.BasePriceUSD = basePrice.USD
+	}
+	_, err = discordSend(discord, channelID, "diff\n"+ob.Format(localizer(lang)), true)
+	logErrorTS(debugTag, err)
+}
 
-	if numArgs > 1 {
-		base, _ := allTokens[strings.ToUpper(cmdArgs[1])]
-		baseTicker = base.Ticker
+func cmdDexTrades(discord Messenger, channelID, lang, debugTag string, args commandArgs) {
+	//TODO: add argument for timezone or allow user to save timezone??
+	dex := state.DEX()
+	allTokens, err := dex.GetTokens()
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve tokens"), debugTag) {
+		return
 	}
+	quote := allTokens[args.String("quote-ticker", "HALO")]
+	base := allTokens[args.String("base-ticker", "ETH")]
+	quoteTicker := quote.Ticker
+	baseTicker := base.Ticker
+	limit := args.Int("limit", 10)
+	pageNo := args.Int("page-no", 1)
 	if quoteTicker == "" || baseTicker == "" {
-		_, err := discordSend(discord, channelID, fmt.Sprint("Invalid pair supplied: ", strings.Join(cmdArgs, "/")), true)
+		_, err := discordSend(discord, channelID, tr(lang, "Invalid pair supplied: %s/%s",
+			args.String("quote-ticker", "HALO"), args.String("base-ticker", "ETH")), true)
 		logErrorTS(debugTag, err)
 		return
 	}
-	if numArgs > 2 {
-		// limit argument is set
-		if l, err := strconv.ParseInt(cmdArgs[2], 10, 64); err == nil && l <= 50 {
-			limit = l
-		} else {
-			_, err = discordSend(discord, channelID, "Limit must be a valid number and max 50.", true)
-			logErrorTS(debugTag, err)
+	basePrice, priceErr := state.Prices().GetPrice(baseTicker)
+	logErrorTS(debugTag, priceErr)
+	// each page of trades is retrieved when requested
+	err = sendPages(discord, channelID, lang, int(pageNo), 0, func(pageNo int) (p page, hasNext bool, err error) {
+		trades, err := dex.GetTrades(quoteTicker, baseTicker, limit, int64(pageNo), basePrice.USD)
+		if err != nil {
 			return
 		}
-	}
-
-	if numArgs > 3 {
-		if p, err := strconv.ParseInt(cmdArgs[3], 10, 64); err == nil {
-			pageNo = p
+		p.Text = "diff\n" + dex.FormatTrades(localizer(lang), trades)
+		if priceErr == nil {
+			p.Text += client.DashLine + basePrice.Format(localizer(lang))
 		}
+		hasNext = int64(len(trades)) == limit
+		return
+	})
+	commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve trades"), debugTag)
+}
+
+// cmdDexOrders shows the open orders of an address on a pair. Uses the first address book item if no address
+// supplied.
+func cmdDexOrders(discord Messenger, channelID, lang, debugTag string, args commandArgs, userAddresses []string) {
+	txt := ""
+	dex := state.DEX()
+	// address book item numbers are resolved by the argument parser
+	address := args.String("address", "")
+	tokens, err := dex.GetTokens()
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve tokens"), debugTag) {
+		return
+	}
+	quote := tokens[args.String("quote-ticker", "HALO")]
+	base := tokens[args.String("base-ticker", "ETH")]
+	var orders []client.Order
+	if quote.Ticker == "" || base.Ticker == "" {
+		txt = tr(lang, "Invalid pair supplied: %s/%s", args.String("quote-ticker", "HALO"),
+			args.String("base-ticker", "ETH"))
+		goto SendMessage
 	}
-	dataStr := ""
-	if command == "orders" {
-		// if numArgs > 3 {
-		// 	address = strings.ToLower(cmdArgs[3])
-		// }
-		// if !strings.HasPrefix(address, "0x") {
-		// 	// Invalid address supplied
-		// 	i, err := strconv.ParseInt(address, 10, 64)
-		// 	if err != nil {
-		// 		// Use first address from user's addressbook, if available
-		// 		i = 1
-		// 	}
-		// 	if numAddresses == 0 || i < 1 || numAddresses < int(i) {
-		// 		// No/invalid address supplied and user has no address saved
-		// 		discordSend(discord, channelID, "Valid address or address book item number required.", true)
-		// 		return
-		// 	}
-		// 	i--
-		// 	address = userAddresses[i]
-		// }
-
-		// orders, err := dex.GetOrders(quoteAddr, baseAddr, limit, address)
-		// logErrorTS(debugTag, err)
-		// dataStr = dex.FormatOrders(orders)
-	} else if command == "orderbook" {
-		// orderbook, err := dex.GetOrderbook(quoteAddr, baseAddr, limit, true)
-		// logErrorTS(debugTag, err)
-		// dataStr = dex.FormatOrders(orderbook)
-	} else {
-		var basePriceUSD float64
-		if baseCMC, err := cmc.GetTicker(baseTicker); err == nil {
-			basePriceUSD = baseCMC.Quote["USD"].Price
+	if address == "" {
+		if len(userAddresses) == 0 {
+			// No address supplied and user has no address saved
+			txt = tr(lang, "Valid address or address book item number required.")
+			goto SendMessage
 		}
-		trades, err := dex.GetTrades(quoteTicker, baseTicker, limit, pageNo, basePriceUSD)
-		logErrorTS(debugTag, err)
-		dataStr = "diff\n" + dex.FormatTrades(trades)
+		// Use first address from user's addressbook
+		address = userAddresses[0]
 	}
-	if commandErrorIf(err, discord, channelID, "Failed to retrieve "+command, debugTag) {
+	orders, err = dex.GetOrders(quote.Ticker, base.Ticker, address, ordersFetchLimit)
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve orders for %s", address), debugTag) {
 		return
 	}
-	_, err = discordSend(discord, channelID, dataStr, true)
+	if len(orders) == 0 {
+		txt = tr(lang, "No open %s/%s orders found for %s", quote.Ticker, base.Ticker, address)
+		goto SendMessage
+	}
+	{
+		header, rows := tableRows("diff\n" + dex.FormatOrders(localizer(lang), orders))
+		pages := textPages(fmt.Sprintf("%s/%s %s\n", quote.Ticker, base.Ticker, address)+header, rows, rowsPerPage, "")
+		err = sendPages(discord, channelID, lang, 1, len(pages), staticPages(pages))
+		logErrorTS(debugTag, err)
+	}
+	return
+SendMessage:
+	_, err = discordSend(discord, channelID, txt, true)
 	logErrorTS(debugTag, err)
 }
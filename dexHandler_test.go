@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOrderbook(t *testing.T) {
+	fake := setupCommandTest(t)
+	server := newFakeAPIServer()
+	defer server.Close()
+	c := state.Config()
+	c.Client.CMC.BaseURL = server.URL
+	c.Client.CMC.APIKEY = "test"
+	c.Client.CMC.DailyCreditLimit = 333
+	c.Client.DEX.BaseURL = server.URL
+	state.SetConfig(c)
+
+	reply := send(fake, testGuildID, testChannelID, "alice", "!orderbook halo eth")
+	for _, wants := range []string{
+		// partially filled orders at the same price are aggregated and deleted orders excluded
+		"+ 0.00004950   | 2.00 K   | 2.00 K   | 0.0990   | $19.8",
+		"+ 0.00004800   | 1.00 K   | 3.00 K   | 0.1470   | $29.4",
+		"- 0.00005100   | 3.00 K   | 4.00 K   | 0.2035   | $40.7",
+		"Spread: 0.00000100 ETH (2.00%)",
+		"Best bid: 0.00004950 | Best ask: 0.00005050 ETH",
+	} {
+		if !strings.Contains(reply, wants) {
+			t.Fatalf("expected %q in reply: %s", wants, reply)
+		}
+	}
+	// asks are listed with the highest price first. Filled orders are excluded.
+	if strings.Index(reply, "- 0.00005100") > strings.Index(reply, "- 0.00005050") || strings.Contains(reply, "0.00006") {
+		t.Fatalf("unexpected asks: %s", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "!orderbook halo eth 1")
+	if strings.Contains(reply, "0.00004800") || strings.Contains(reply, "0.00005100") {
+		t.Fatalf("expected a single price level per side: %s", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "!orderbook halo xyz")
+	if !strings.Contains(reply, "Invalid pair supplied: HALO/XYZ") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+}
+
+func TestOrders(t *testing.T) {
+	fake := setupCommandTest(t)
+	server := newFakeAPIServer()
+	defer server.Close()
+	c := state.Config()
+	c.Client.DEX.BaseURL = server.URL
+	state.SetConfig(c)
+
+	reply := send(fake, "", testDMChannelID, "alice", "!orders")
+	if !strings.Contains(reply, "Valid address or address book item number required.") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	// the first address book item is used if no address supplied
+	send(fake, "", testDMChannelID, "alice", "!address add 0x1234 0xABCDEF")
+	reply = send(fake, "", testDMChannelID, "alice", "!orders")
+	if !strings.Contains(reply, "No open HALO/ETH orders found for 0x1234") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!orders halo eth 2")
+	for _, wants := range []string{
+		"HALO/ETH 0xABCDEF",
+		"- Sell | 0.00005100 | 3.00 K   | 0.00%   | 1d 2h",
+		"+ Buy  | 0.00004800 | 1.00 K   | 25.00%  | 1h 30m",
+	} {
+		if !strings.Contains(reply, wants) {
+			t.Fatalf("expected %q in reply: %s", wants, reply)
+		}
+	}
+	// newest first. Filled orders are excluded.
+	if strings.Index(reply, "+ Buy") > strings.Index(reply, "- Sell") || strings.Contains(reply, "0.00006") {
+		t.Fatalf("unexpected orders: %s", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "!orders")
+	if !strings.Contains(reply, "Private commands are not allowed in public channels.") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+}
+
+func TestDexBalance(t *testing.T) {
+	fake := setupCommandTest(t)
+	server := newFakeAPIServer()
+	defer server.Close()
+	c := state.Config()
+	c.Client.CMC.BaseURL = server.URL
+	c.Client.CMC.APIKEY = "test"
+	c.Client.CMC.DailyCreditLimit = 333
+	c.Client.DEX.BaseURL = server.URL
+	state.SetConfig(c)
+
+	reply := send(fake, "", testDMChannelID, "alice", "!dexbalance")
+	if !strings.Contains(reply, "Valid address or address book item number required.") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	send(fake, "", testDMChannelID, "alice", "!address add 0x1234 0xABCDEF")
+	// zero balances are hidden unless tickers are supplied. USD value is derived from the HALO/ETH ticker.
+	reply = send(fake, "", testDMChannelID, "alice", "!dexbalance 2")
+	if !strings.Contains(reply, "HALO    | 1,000.00000000 | 750.00000000   | 250.00000000   | $10.00") ||
+		strings.Contains(reply, "ETH ") || !strings.Contains(reply, "Total value: $10.00") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	if state.DEX().TickerCacheUpdatedAt().IsZero() {
+		t.Fatal("USD prices should be derived from the cached tickers")
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!dexbalance 2 eth halo")
+	if !strings.Contains(reply, "ETH     | 0.00000000     |") || !strings.Contains(reply, "HALO    |") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	// the first address book item is used if no address supplied
+	if reply = send(fake, "", testDMChannelID, "alice", "!dexbalance"); !strings.Contains(reply, "No balances found") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!dexbalance 2 xyz")
+	if !strings.Contains(reply, "Invalid/unsupported token.") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+}
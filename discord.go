@@ -3,40 +3,58 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-func commandHandler(discord *discordgo.Session, message *discordgo.MessageCreate, commandPrefix string) {
+// commandHandler handles messages starting with the command prefix of the guild or a mention of the bot.
+// The command prefix is not required on private messages and privacy exception channels.
+func commandHandler(discord Messenger, message *discordgo.MessageCreate) {
 	user := message.Author
 	channelID := message.ChannelID
-	isPrivateMsg := message.GuildID == "" || data.PrivacyExceptions[channelID] != ""
-	hasPrefix := strings.HasPrefix(message.Content, commandPrefix)
+	isPrivateMsg := message.GuildID == "" || state.IsPrivacyException(channelID)
+	commandPrefix := state.CommandPrefix(message.GuildID)
+	content, isMention := trimBotMention(message.Content)
+	hasPrefix := isMention || strings.HasPrefix(content, commandPrefix)
 	if user.ID == botID || user.Bot || (!isPrivateMsg && !hasPrefix) {
 		// Ignore messages from any bot or messages that are not commands
 		return
 	}
 
 	username := fmt.Sprint(message.Author)
-	userAddresses := data.AddressBook[username]
-	numAddresses := len(userAddresses)
+	userAddresses := state.AddressBook(username)
 	debugTag := "commandHandler"
+	lang := state.Language(message.GuildID, user.ID)
 
-	cmdArgs := strings.Split(message.Content, " ")
-	cmdName := strings.ToLower(strings.TrimPrefix(cmdArgs[0], commandPrefix))
-	cmdArgs = cmdArgs[1:]
-	numArgs := len(cmdArgs)
-	cmcTicker, err := cmc.FindTicker(cmdName)
-	cmds := commands
-	if gCMDs, ok := guildCommands[message.GuildID]; ok {
+	cmdName, line := tokenize(content).shift()
+	if !isMention {
+		cmdName = strings.TrimPrefix(cmdName, commandPrefix)
+	}
+	cmdName = strings.ToLower(cmdName)
+	if isMention && cmdName == "" {
+		_, err := discordSend(discord, channelID, tr(lang, "Need help? Use the following command:```%shelp```",
+			commandPrefix), false)
+		logErrorTS(debugTag, err)
+		return
+	}
+	numArgs := len(line.Args)
+	cmcTicker, err := state.CMC().FindTicker(cmdName)
+	cmds := state.Commands()
+	if gCMDs, ok := state.GuildCommands(message.GuildID); ok {
 		cmds = gCMDs
 	}
 	command, found := cmds[cmdName]
+	if alias, isAlias := commandAliases[cmdName]; !found && isAlias {
+		// guild and global info commands take precedence over aliases
+		cmdName = alias
+		command, found = cmds[cmdName]
+	}
 	if !found {
 		// Ignore invalid commands on public channels
 		if isPrivateMsg && err != nil && message.GuildID == "" {
 			_, err = discordSend(discord, channelID,
-				"Invalid command! Need help? Use the following command:```!help```", false)
+				tr(lang, "Invalid command! Need help? Use the following command:```%shelp```", commandPrefix), false)
 			logErrorTS(debugTag, err)
 			return
 		} else if cmcTicker.Symbol == "" || numArgs > 0 {
@@ -45,91 +63,123 @@ func commandHandler(discord *discordgo.Session, message *discordgo.MessageCreate
 		}
 		// CMC ticker command invoked | !eth, !btc....
 		cmdName = "cmc"
-		cmdArgs = []string{cmcTicker.Symbol}
-		numArgs = 1
+		command = cmds[cmdName]
+		line = tokenize(cmcTicker.Symbol)
 	}
 
-	if numArgs == 0 {
-		cmdArgs = []string{}
-	}
-	if _, found := privateCmds[cmdName]; found && !isPrivateMsg {
+	runCommand(&commandRequest{
+		Discord:       discord,
+		Message:       message,
+		Name:          cmdName,
+		GuildID:       message.GuildID,
+		ChannelID:     channelID,
+		Username:      username,
+		Prefix:        commandPrefix,
+		Lang:          lang,
+		IsPrivateMsg:  isPrivateMsg,
+		UserAddresses: userAddresses,
+		DebugTag:      debugTag,
+	}, command, line.Args, func(spec argSpec) (commandArgs, error) {
+		return spec.Parse(line, userAddresses)
+	})
+}
+
+// runCommand executes a text or built-in command. The arguments of built-in commands are parsed using parseArgs.
+func runCommand(r *commandRequest, command Command, textArgs []string, parseArgs func(argSpec) (commandArgs, error)) {
+	cmdName, channelID, debugTag := r.Name, r.ChannelID, r.DebugTag
+	if state.IsPrivateCommand(cmdName) && !r.IsPrivateMsg {
 		// Private command requested from a channel/server
-		_, err := discordSend(discord, channelID, "Private commands are not allowed in public channels.", true)
+		_, err := discordSend(r.Discord, channelID, tr(r.Lang, "Private commands are not allowed in public channels."),
+			true)
 		logErrorTS(debugTag, err)
+		countCommand(cmdName, r.GuildID, "denied")
 		return
 	}
 
-	debugTag = "cmd] [" + cmdName
-	logTS(debugTag, fmt.Sprintf("Author: %s, GuildID: %s, ChannelID: %s, Message: %s", message.Author, message.GuildID, message.ChannelID, message.Content))
-	if command.Type == "text" {
-		textCmdHandler(discord, message.GuildID, channelID, debugTag, command, cmdArgs, numArgs)
+	builtin := findBuiltinCommand(cmdName)
+	if command.Type != "text" && builtin == nil {
 		return
 	}
-	switch cmdName {
-	case "address":
-		cmdAddress(discord, channelID, fmt.Sprint(message.Author), debugTag, cmdArgs, numArgs)
-		break
-	case "alert":
-		cmdAlert(discord, message.GuildID, channelID, message.Author.ID, username, debugTag, cmdArgs, numArgs)
-		break
-	case "balance":
-		cmdBalance(discord, channelID, debugTag, cmdArgs, userAddresses, numArgs, numAddresses)
-		break
-	case "cmc":
-		// Handle CoinMarketCap related commands
-		nameOrSymbol := strings.ToUpper(strings.Join(cmdArgs, " "))
-		ticker, err := cmc.GetTicker(nameOrSymbol)
-		if commandErrorIf(err, discord, channelID, "Ticker not found or query failed.", debugTag) {
+	// denied commands and commands with invalid arguments are not run, therefore, not charged
+	if !hasPermission(r.Discord, r.Message, commandPermission(r.GuildID, cmdName, command)) {
+		_, err := discordSend(r.Discord, channelID, tr(r.Lang, "You do not have permission to use this command"), true)
+		logErrorTS(debugTag, err)
+		countCommand(cmdName, r.GuildID, "denied")
+		return
+	}
+	var args commandArgs
+	if command.Type != "text" {
+		var err error
+		if args, err = parseArgs(builtin.argSpec); err != nil {
+			_, err = discordSend(r.Discord, channelID, commandUsage(r.Lang, r.Prefix, cmdName, builtin.argSpec, err),
+				true)
+			result := "invalid"
+			if logErrorTS(debugTag, err) {
+				result = "error"
+			}
+			countCommand(cmdName, r.GuildID, result)
 			return
 		}
-		_, err = discordSend(discord, channelID, "js\n"+ticker.Format(), true)
-		logErrorTS(debugTag, err)
-		break
-	case "dexbalance": // Private Command
-		cmdDexBalance(discord, channelID, debugTag, cmdArgs, userAddresses, numArgs, numAddresses)
-		break
-	case "guildcmd":
-		guildCMDHandler(discord, message)
-		break
-	case "halo":
-		cmdDexTicker(discord, channelID, debugTag, []string{}, 0)
-		txt, err := mndapp.GetFormattedPoolData()
-		if err == nil {
-			_, err = discordSend(discord, channelID, "js\n"+txt, true)
+	}
+	rateLimit := state.Config().RateLimit
+	keys := rateLimit.rateLimitKeys(r)
+	cost := rateLimit.commandCost(cmdName)
+	if limited, wait, warn := limiter.allow(keys, cost); limited != nil {
+		if !isRateLimitExempt(r) {
+			logger.Info("Command throttled", "tag", "cmd", "command", cmdName, "guild", r.GuildID,
+				"channel", channelID, "user", r.Username, "scope", limited.Scope)
+			countCommand(cmdName, r.GuildID, "throttled")
+			if warn {
+				_, err := discordSend(r.Discord, channelID, slowDownMessage(r.Lang, limited.Scope, wait), false)
+				logErrorTS(debugTag, err)
+			}
+			return
 		}
-		logErrorTS(debugTag, err)
-		cmdDexTrades(discord, channelID, debugTag, []string{"halo", "eth", "5"}, userAddresses, 3, numAddresses, "trades")
-		break
-	case "help":
-		helpHanlder(discord, channelID, message.GuildID, debugTag, isPrivateMsg, cmdArgs, numArgs)
-		break
-	case "mn":
-		cmdMN(discord, channelID, debugTag, cmdArgs, numArgs)
-		break
-	case "nodes": // Private Command
-		cmdNodes(discord, channelID, debugTag, cmdArgs, userAddresses, numArgs, numAddresses)
-		break
-	case "orders":
-		fallthrough
-	case "orderbook":
-		fallthrough
-	case "trades":
-		cmdDexTrades(discord, channelID, debugTag, cmdArgs, userAddresses, numArgs, numAddresses, cmdName)
-		break
-	case "ticker":
-		cmdDexTicker(discord, channelID, debugTag, cmdArgs, numArgs)
-		break
-	case "tokens":
-		cmdDexTokens(discord, channelID, debugTag, cmdArgs, numArgs)
-		break
+		// exempted users are not charged
+		keys = nil
+	}
+	r.DebugTag = "cmd] [" + cmdName
+	logger.Info("Command received", "tag", "cmd", "command", cmdName, "guild", r.GuildID,
+		"channel", channelID, "user", r.Username, "message", r.Message.Content)
+	start := time.Now()
+	recorder := &commandRecorder{Messenger: r.Discord}
+	r.Discord = recorder
+	defer func() { observeCommand(cmdName, r.GuildID, recorder.result(), start) }()
+	if command.Type == "text" {
+		textCmdHandler(r.Discord, r.GuildID, channelID, r.DebugTag, command, textArgs, len(textArgs))
+		return
 	}
+	r.Args = args
+	if addresses := len(args.List("address")); addresses > 1 {
+		// each additional address costs as much as the command
+		limiter.charge(keys, cost*float64(addresses-1))
+	}
+	builtin.Handler(r)
+}
+
+// isRateLimitExempt checks if the user is the root user or a guild admin
+func isRateLimitExempt(r *commandRequest) bool {
+	return isGuildAdmin(r.Discord, r.Message)
+}
+
+// commandUsage returns the argument error along with the usage of the command
+func commandUsage(lang, prefix, cmdName string, spec argSpec, err error) string {
+	message := fmt.Sprint(err)
+	if e, ok := err.(*argError); ok {
+		message = e.Translate(lang)
+	}
+	return message + "\n" + tr(lang, "Usage: %s%s %s\nFor more details: %shelp %s", prefix, cmdName, spec, prefix,
+		cmdName)
 }
 
 // commandErrorIf prints and sends error as message, if not nil
-func commandErrorIf(err error, discord *discordgo.Session, channelID, message, debugTag string) (hasError bool) {
+func commandErrorIf(err error, discord Messenger, channelID, message, debugTag string) (hasError bool) {
 	if !logErrorTS(debugTag, err) {
 		return
 	}
+	if recorder, ok := discord.(*commandRecorder); ok {
+		recorder.setFailed()
+	}
 	discordSend(discord, channelID, fmt.Sprintf("%s```%s```", message, err), false)
 	return true
 }
@@ -137,7 +187,7 @@ func commandErrorIf(err error, discord *discordgo.Session, channelID, message, d
 // discordSend sends a message to the supplied Discord channel. If the message is larger than Discord limit (2000
 // characters), it will split the text and send multiple messages by recursively spliting on the last line break
 // within the first 2000 character range. If line break is not existant within the range will use 2000.
-func discordSend(discord *discordgo.Session, channelID, message string, codeBlock bool) (newMessage *discordgo.Message, err error) {
+func discordSend(discord Messenger, channelID, message string, codeBlock bool) (newMessage *discordgo.Message, err error) {
 	debugTag := "discordSend"
 	messageLimit := 2000
 	if len(strings.TrimSpace(message)) == 0 {
@@ -177,25 +227,3 @@ func discordSend(discord *discordgo.Session, channelID, message string, codeBloc
 	logErrorTS(debugTag, err)
 	return
 }
-
-// userHasRole checks if a user has a specific role on a server/guild
-func userHasRole(discord *discordgo.Session, guildID, userID, roleName string) bool {
-	debugTag := "userHasRole"
-	roles, err := discord.GuildRoles(guildID)
-	member, err2 := discord.GuildMember(guildID, userID)
-	if err != nil || logErrorTS(debugTag, err2) {
-		return false
-	}
-	roleID := ""
-	for _, role := range roles {
-		if strings.ToLower(role.Name) == roleName {
-			roleID = role.ID
-		}
-	}
-	for _, mRoleID := range member.Roles {
-		if mRoleID == roleID {
-			return true
-		}
-	}
-	return false
-}
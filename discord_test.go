@@ -0,0 +1,227 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPrefix = "!"
+const testGuildID = "guild-1"
+const testChannelID = "channel-1"
+const testDMChannelID = "dm-1"
+
+const testDataJSON = `{
+	"addressbook": {},
+	"alerts": { "payout": {} },
+	"privacyexceptions": {}
+}`
+
+// setupCommandTest loads commands using temporary JSON storage and returns a fake messenger
+func setupCommandTest(t *testing.T) *fakeMessenger {
+	dir, err := ioutil.TempDir("", "halo-info-bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dataFile = "./discord.json"
+		os.RemoveAll(dir)
+	})
+	dataFile = filepath.Join(dir, "discord.json")
+	if err = ioutil.WriteFile(dataFile, []byte(testDataJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	botID = "id-bot"
+	limiter = newRateLimiter()
+	c := &Config{}
+	c.Client.DiscordBot.Prefix = testPrefix
+	c.Client.DiscordBot.RootUser = "root#0001"
+	state = &State{}
+	state.SetConfig(c)
+	state.SetStorage(newJSONStorage(
+		dataFile,
+		filepath.Join(dir, "payout-log.json"),
+		filepath.Join(dir, "payouts.json"),
+		filepath.Join(dir, "audit-log.jsonl"),
+	))
+	if err = loadData(); err != nil {
+		t.Fatal(err)
+	}
+	if err = generateCommandLists(); err != nil {
+		t.Fatal(err)
+	}
+	return newFakeMessenger()
+}
+
+// send simulates a message received from Discord
+func send(fake *fakeMessenger, guildID, channelID, username, content string) string {
+	commandHandler(fake, newMessageCreate(guildID, channelID, username, content))
+	return fake.LastMessage(channelID)
+}
+
+func TestCommandHandlerIgnoresChatterAndBots(t *testing.T) {
+	fake := setupCommandTest(t)
+	send(fake, testGuildID, testChannelID, "alice", "hello there")
+	send(fake, testGuildID, testChannelID, "alice", "!notacommand")
+	msg := newMessageCreate(testGuildID, testChannelID, "otherbot", "!help")
+	msg.Author.Bot = true
+	commandHandler(fake, msg)
+	if n := len(fake.Sent); n != 0 {
+		t.Fatalf("expected no replies, got %d: %v", n, fake.Messages(testChannelID))
+	}
+}
+
+func TestCommandHandlerInvalidPrivateCommand(t *testing.T) {
+	fake := setupCommandTest(t)
+	reply := send(fake, "", testDMChannelID, "alice", "!notacommand")
+	if !strings.HasPrefix(reply, "Invalid command!") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestCommandHandlerPrivateCommandInPublicChannel(t *testing.T) {
+	fake := setupCommandTest(t)
+	reply := send(fake, testGuildID, testChannelID, "alice", "!address")
+	if !strings.Contains(reply, "Private commands are not allowed in public channels.") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestCommandHandlerHelp(t *testing.T) {
+	fake := setupCommandTest(t)
+	reply := send(fake, testGuildID, testChannelID, "alice", "!help")
+	if !strings.Contains(reply, "!ticker") || strings.Contains(reply, "!address") {
+		t.Fatalf("public help should list public commands only: %q", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!help")
+	if !strings.Contains(reply, "!address") {
+		t.Fatalf("private help should list private commands: %q", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!help balance")
+	if !strings.Contains(reply, "!balance [address] [{btc}|{dash}|{eth}|{halo}|{ltc}]") {
+		t.Fatalf("unexpected command help: %q", reply)
+	}
+}
+
+func TestCommandHandlerAddressBook(t *testing.T) {
+	fake := setupCommandTest(t)
+	reply := send(fake, "", testDMChannelID, "alice", "!address")
+	if !strings.Contains(reply, "No addresses available!") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!address add 0x1234 0x5678")
+	if !strings.Contains(reply, "Changes saved") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!address")
+	if !strings.Contains(reply, "1. 0x1234") || !strings.Contains(reply, "2. 0x5678") {
+		t.Fatalf("unexpected address list: %q", reply)
+	}
+	// other users' address books must not be affected
+	if n := len(state.AddressBook("bob#0001")); n != 0 {
+		t.Fatalf("expected empty address book for bob, got %d items", n)
+	}
+}
+
+func TestGuildCMD(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "ButlerAdmin", "id-admin")
+
+	reply := send(fake, testGuildID, testChannelID, "alice", "!guildcmd add sayhello Hello Discord")
+	if !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("non-admin should not be allowed to add commands: %q", reply)
+	}
+
+	reply = send(fake, testGuildID, testChannelID, "admin", "!guildcmd add sayhello Hello Discord")
+	if !strings.Contains(reply, "added") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "!sayhello")
+	if reply != "Hello Discord" {
+		t.Fatalf("unexpected guild command reply: %q", reply)
+	}
+
+	// guild commands must not leak into other guilds
+	fake.Reset()
+	send(fake, "guild-2", "channel-2", "alice", "!sayhello")
+	if n := len(fake.Sent); n != 0 {
+		t.Fatalf("expected no reply from another guild, got: %v", fake.Messages("channel-2"))
+	}
+
+	reply = send(fake, testGuildID, testChannelID, "root", "!guildcmd remove sayhello")
+	if !strings.Contains(reply, "removed") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	fake.Reset()
+	send(fake, testGuildID, testChannelID, "alice", "!sayhello")
+	if n := len(fake.Sent); n != 0 {
+		t.Fatalf("removed command should be ignored, got: %v", fake.Messages(testChannelID))
+	}
+}
+
+func TestAlertPayoutSubscription(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "butleradmin", "id-admin")
+
+	reply := send(fake, testGuildID, testChannelID, "alice", "!alert payout on")
+	if !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!alert payout on")
+	if !strings.Contains(reply, "Payout alert is turned on") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if _, ok := state.PayoutAlertChannels()[testChannelID]; !ok {
+		t.Fatal("channel not subscribed to payout alerts")
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "!alert payout status")
+	if !strings.Contains(reply, "Payout alert is turned on") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!alert payout off")
+	if !strings.Contains(reply, "Payout alert is turned off") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestSendPayoutAlerts(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.FailChannels["channel-3"] = true
+	channels := map[string]string{"channel-1": "", "channel-2": "", "channel-3": ""}
+	total, success, fail := sendPayoutAlerts(fake, state.LastPayout(), channels)
+	if total != 3 || success != 2 || fail != 1 {
+		t.Fatalf("unexpected result. Total: %d, Success: %d, Fail: %d", total, success, fail)
+	}
+
+	chMsgIDs := map[string]string{}
+	for _, msg := range state.LastPayout().AlertData.Messages {
+		chMsgIDs[msg.ChannelID] = msg.ID
+	}
+	total, success, fail = updatePayoutAlerts(fake, state.LastPayout(), chMsgIDs)
+	if total != 3 || success != 2 || fail != 1 || len(fake.Edited) != 2 {
+		t.Fatalf("unexpected result. Total: %d, Success: %d, Fail: %d", total, success, fail)
+	}
+}
+
+func TestDiscordSendSplitsLongMessages(t *testing.T) {
+	fake := newFakeMessenger()
+	line := strings.Repeat("a", 99) + "\n"
+	_, err := discordSend(fake, testChannelID, strings.Repeat(line, 50), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := fake.Messages(testChannelID)
+	if len(msgs) < 3 {
+		t.Fatalf("expected message to be split into at least 3 messages, got %d", len(msgs))
+	}
+	for _, msg := range msgs {
+		if len(msg) > 2000 {
+			t.Fatalf("message exceeds Discord limit: %d characters", len(msg))
+		}
+		if !strings.HasPrefix(msg, "```") || !strings.HasSuffix(msg, "```") {
+			t.Fatalf("code block not preserved: %q", msg)
+		}
+	}
+}
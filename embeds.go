@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alien45/halo-info-bot/client"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Embed colours
+const (
+	colorUp      = 0x2ecc71
+	colorDown    = 0xe74c3c
+	colorNeutral = 0x3498db
+	colorPayout  = 0xf1c40f
+)
+
+// cmcLogoURL is the URL of the CoinMarketCap logo of a ticker by CMC ID
+const cmcLogoURL = "https://s2.coinmarketcap.com/static/img/coins/64x64/%d.png"
+
+// useEmbeds returns whether the guild prefers embeds over code blocks
+func useEmbeds(guildID string) bool {
+	return guildID != "" && state.GuildSettings(guildID).Embeds
+}
+
+// sendFormatted sends the embed if the guild prefers embeds. Otherwise, sends the text as a code block.
+// Text may start with the language of the code block. Eg: "js\n".
+func sendFormatted(discord Messenger, guildID, channelID, text string, embed *discordgo.MessageEmbed) (
+	*discordgo.Message, error) {
+	if !useEmbeds(guildID) {
+		return discordSend(discord, channelID, text, true)
+	}
+	return discord.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}})
+}
+
+// changeColor returns the colour of a price change
+func changeColor(percentChange float64) int {
+	if percentChange > 0 {
+		return colorUp
+	}
+	if percentChange < 0 {
+		return colorDown
+	}
+	return colorNeutral
+}
+
+// formatChange formats a price change with an arrow indicating the direction. Eg: "▲ 1.23%"
+func formatChange(lang string, percentChange float64) string {
+	arrow := "▲"
+	if percentChange < 0 {
+		arrow = "▼"
+	}
+	return fmt.Sprintf("%s %s%%", arrow, formatNumber(lang, percentChange, 2))
+}
+
+// explorerURL returns the URL of a Halo Explorer page. Eg: explorerURL("address", "0x1234")
+func explorerURL(page string, id interface{}) string {
+	homepage := strings.TrimSuffix(state.Explorer().Homepage, "/")
+	if homepage == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%v", homepage, page, id)
+}
+
+// explorerLink returns a markdown link to the Halo Explorer page if available
+func explorerLink(page, id string) string {
+	if url := explorerURL(page, id); url != "" {
+		return fmt.Sprintf("[%s](%s)", id, url)
+	}
+	return id
+}
+
+// cmcLogo returns the logo URL of a ticker, if cached
+func cmcLogo(symbol string) *discordgo.MessageEmbedThumbnail {
+	ticker, err := state.CMC().FindTicker(symbol)
+	if err != nil || ticker.ID == 0 {
+		return nil
+	}
+	return &discordgo.MessageEmbedThumbnail{URL: fmt.Sprintf(cmcLogoURL, ticker.ID)}
+}
+
+// inlineField returns a field displayed side by side with other inline fields. Discord requires a value.
+func inlineField(name, value string) *discordgo.MessageEmbedField {
+	if value == "" {
+		value = "-"
+	}
+	return &discordgo.MessageEmbedField{Name: name, Value: value, Inline: true}
+}
+
+// tickerEmbed renders a HaloDEX ticker along with the price of the base token
+func tickerEmbed(lang string, ticker client.Ticker, basePrice client.Price) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:     ticker.Pair,
+		Color:     changeColor(ticker.PercentChange),
+		Thumbnail: cmcLogo(ticker.QuoteTicker),
+		Fields: []*discordgo.MessageEmbedField{
+			inlineField(tr(lang, "Last Price"), fmt.Sprintf("$%s\n%s %s", formatNumber(lang, ticker.LastPriceUSD, 8),
+				formatNumber(lang, ticker.Last, 8), ticker.BaseTicker)),
+			inlineField(tr(lang, "24H Change"), formatChange(lang, ticker.PercentChange)),
+			inlineField(tr(lang, "Supply"), formatNumberShort(lang, ticker.QuoteTokenSupply, 4)),
+			inlineField(tr(lang, "Market Cap"), "$"+formatNumberShort(lang, ticker.QuoteTokenMarketCap, 4)),
+			inlineField(tr(lang, "24H Volume"), fmt.Sprintf("%s %s\n%s %s\n$%s",
+				formatNumberShort(lang, ticker.BaseVolume, 4), ticker.BaseTicker,
+				formatNumberShort(lang, ticker.QuoteVolume, 4), ticker.QuoteTicker,
+				formatNumberShort(lang, ticker.TwoFourVolumeUSD, 4))),
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: basePrice.Format(localizer(lang))},
+	}
+}
+
+// cmcTickerEmbed renders a CoinMarketCap ticker
+func cmcTickerEmbed(lang string, ticker client.CMCTicker) *discordgo.MessageEmbed {
+	quote := ticker.Quote["USD"]
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("%s (%s)", ticker.Name, ticker.Symbol),
+		URL:   "https://coinmarketcap.com/currencies/" + ticker.Slug + "/",
+		Color: changeColor(quote.PercentChange24H),
+		Fields: []*discordgo.MessageEmbedField{
+			inlineField(tr(lang, "Price"), "$"+formatNumber(lang, quote.Price, 8)),
+			inlineField(tr(lang, "24H Change"), formatChange(lang, quote.PercentChange24H)),
+			inlineField(tr(lang, "24H Volume"), "$"+formatNumberShort(lang, quote.Volume24H, 4)),
+			inlineField(tr(lang, "Market Cap"), "$"+formatNumberShort(lang, quote.MarketCap, 4)),
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: "CoinMarketCap"},
+	}
+	if ticker.ID > 0 {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: fmt.Sprintf(cmcLogoURL, ticker.ID)}
+	}
+	if !ticker.LastUpdated.IsZero() {
+		embed.Timestamp = ticker.LastUpdated.UTC().Format(time.RFC3339)
+	}
+	return embed
+}
+
+// payoutEmbed renders a payout alert. Tier rewards are shown after deducting the hosting fee.
+func payoutEmbed(lang string, p client.Payout) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: tr(lang, "Delicious payout is served!"),
+		Color: colorPayout,
+		Fields: []*discordgo.MessageEmbedField{
+			inlineField(tr(lang, "Minted"), formatNumber(lang, p.Minted, 0)),
+			inlineField(tr(lang, "Service Fees"), formatNumber(lang, p.Fees, 0)),
+			inlineField(tr(lang, "Total"), formatNumber(lang, p.Total, 0)),
+			inlineField(tr(lang, "Duration"), p.Duration),
+			inlineField(tr(lang, "Hosting Fee"), tr(lang, "$%s (%s HALO) | $%s/month",
+				formatNumber(lang, p.HostingFeeUSD, 4), formatNumber(lang, p.HostingFeeHalo, 0),
+				formatNumber(lang, p.HostingFeePerMonth, 2))),
+			inlineField(tr(lang, "Halo Price Used"), "$"+formatNumber(lang, p.Price, 8)),
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: tr(lang, "Disclaimer: Actual amount received may vary from the amounts displayed due to the tier "+
+				"distribution returned by API includes ineligible node statuses."),
+		},
+	}
+	if !p.Time.IsZero() {
+		embed.Timestamp = p.Time.UTC().Format(time.RFC3339)
+	}
+	for i := 1; i <= 4; i++ {
+		tier := fmt.Sprintf("t%d", i)
+		embed.Fields = append(embed.Fields, inlineField(tr(lang, "Tier %d", i), tr(lang, "%s HALO\n%s nodes",
+			formatNumber(lang, p.Tiers[tier]-p.HostingFeeHalo, 0), formatNumber(lang, p.TierNodes[tier], 0))))
+	}
+	if p.BlockNumber > 0 {
+		embed.URL = explorerURL("block", p.BlockNumber)
+	}
+	return embed
+}
+
+// masternodeEmbed renders a masternode with links to the owner and contract addresses
+func masternodeEmbed(lang string, m client.Masternode) *discordgo.MessageEmbed {
+	color := colorNeutral
+	if m.State == 3 {
+		// active
+		color = colorUp
+	}
+	return &discordgo.MessageEmbed{
+		Title: tr(lang, "Tier %d Masternode", m.Tier),
+		URL:   explorerURL("address", m.Address),
+		Color: color,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: tr(lang, "Owner Address"), Value: explorerLink("address", m.Owner)},
+			{Name: tr(lang, "Contract Address"), Value: explorerLink("address", m.Address)},
+			inlineField(tr(lang, "Status"), tr(lang, m.GetStatusName())),
+			inlineField(tr(lang, "Shares"), formatNumber(lang, m.Shares, 0)),
+			inlineField(tr(lang, "Rewards"), formatNumber(lang, m.RewardBalance, 0)),
+		},
+	}
+}
+
+// tokenEmbed renders a HaloDEX token
+func tokenEmbed(lang string, t client.Token) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("%s (%s)", t.Name, t.Ticker),
+		Description: t.Description,
+		Color:       colorNeutral,
+		Thumbnail:   cmcLogo(t.Ticker),
+		Fields: []*discordgo.MessageEmbedField{
+			inlineField(tr(lang, "Type"), t.Type),
+			inlineField(tr(lang, "Decimals"), fmt.Sprint(t.Decimals)),
+			inlineField(tr(lang, "Base Chain"), t.BaseChain),
+		},
+	}
+	if t.BaseChainAddress != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  tr(lang, "Base Address"),
+			Value: t.BaseChainAddress,
+		})
+	}
+	if t.HaloChainAddress != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  tr(lang, "Halo Address"),
+			Value: explorerLink("address", t.HaloChainAddress),
+		})
+	}
+	return embed
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alien45/halo-info-bot/client"
+)
+
+func TestOutputStyle(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "ButlerAdmin", "id-admin")
+	state.CMC().CachedTickers = map[string]client.CMCTicker{
+		"BTC": {
+			ID: 1, Name: "Bitcoin", Symbol: "BTC", Slug: "bitcoin",
+			Quote: map[string]client.CMCQuote{"USD": {Price: 10000, PercentChange24H: -2.5}},
+		},
+	}
+
+	reply := send(fake, testGuildID, testChannelID, "alice", "!output embed")
+	if !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!output embed")
+	if !strings.Contains(reply, "Output style changed to embed") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	send(fake, testGuildID, testChannelID, "alice", "!cmc btc")
+	msg := fake.Sent[len(fake.Sent)-1]
+	if msg.Content != "" || len(msg.Embeds) != 1 {
+		t.Fatalf("expected embed, got: %+v", msg)
+	}
+	embed := msg.Embeds[0]
+	if embed.Title != "Bitcoin (BTC)" || embed.Color != colorDown || embed.Thumbnail == nil ||
+		embed.Fields[1].Value != "▼ -2.50%" {
+		t.Fatalf("unexpected embed: %+v", embed)
+	}
+
+	// other guilds and private messages use code blocks
+	reply = send(fake, "guild-2", "channel-2", "alice", "!cmc btc")
+	if !strings.HasPrefix(reply, "```js\nTicker           : Bitcoin (BTC)") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!output")
+	if !strings.Contains(reply, "Current output style: embed") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestPayoutAlertEmbeds(t *testing.T) {
+	fake := setupCommandTest(t)
+	err := state.UpdateGuildSettings(testGuildID, func(settings *GuildSettings) { settings.Embeds = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	channels := map[string]string{
+		"channel-embed": testGuildID + "#channel-embed@admin#0001|id-admin",
+		"channel-text":  "guild-2#channel-text@admin#0001|id-admin",
+	}
+	p := client.Payout{
+		Minted:    100000,
+		Time:      time.Now(),
+		Tiers:     map[string]float64{"t1": 100, "t2": 200, "t3": 300, "t4": 400},
+		TierNodes: map[string]float64{"t1": 10, "t2": 20, "t3": 30, "t4": 40},
+	}
+	if _, success, _ := sendPayoutAlerts(fake, p, channels); success != 2 {
+		t.Fatalf("expected 2 alerts sent, got %d", success)
+	}
+	msgIDs := map[string]string{}
+	for _, msg := range fake.Sent {
+		msgIDs[msg.ChannelID] = msg.ID
+		switch msg.ChannelID {
+		case "channel-embed":
+			if len(msg.Embeds) != 1 || msg.Embeds[0].Fields[len(msg.Embeds[0].Fields)-1].Value != "400 HALO\n40 nodes" {
+				t.Fatalf("unexpected payout embed: %+v", msg.Embeds)
+			}
+		case "channel-text":
+			if !strings.HasPrefix(msg.Content, "Delicious payout is served!") || len(msg.Embeds) != 0 {
+				t.Fatalf("unexpected payout alert: %+v", msg)
+			}
+		}
+	}
+
+	state.Update(func(data *DiscordData) error {
+		for channelID, name := range channels {
+			data.Alerts.Payout[channelID] = name
+		}
+		return nil
+	})
+	p.Minted = 200000
+	if _, success, _ := updatePayoutAlerts(fake, p, msgIDs); success != 2 {
+		t.Fatalf("expected 2 alerts updated, got %d", success)
+	}
+	for _, msg := range fake.Edited {
+		if msg.ChannelID == "channel-embed" && (msg.Content != "" || msg.Embeds[0].Fields[0].Value != "200,000") {
+			t.Fatalf("unexpected updated embed: %+v", msg.Embeds[0].Fields[0])
+		}
+		if msg.ChannelID == "channel-text" && (!strings.Contains(msg.Content, "200,000") || len(msg.Embeds) != 0) {
+			t.Fatalf("unexpected updated alert: %+v", msg)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeMessenger is an in-memory Messenger that records sent and edited messages and fakes guild roles
+type fakeMessenger struct {
+	mu     sync.Mutex
+	lastID int
+	// Sent messages in the order they were sent
+	Sent []*discordgo.Message
+	// Edited messages in the order they were edited
+	Edited []*discordgo.Message
+	// key: guild ID
+	Roles map[string][]*discordgo.Role
+	// key: guild ID, value: map of user ID and IDs of roles assigned to the user
+	MemberRoles map[string]map[string][]string
+	// FailChannels messages sent to these channels will fail. Key: channel ID
+	FailChannels map[string]bool
+	// Interaction responses in the order they were sent
+	Responses []*discordgo.InteractionResponse
+	// Flags of the follow-up messages. Key: message ID
+	Flags map[string]discordgo.MessageFlags
+}
+
+func newFakeMessenger() *fakeMessenger {
+	return &fakeMessenger{
+		Roles:        map[string][]*discordgo.Role{},
+		MemberRoles:  map[string]map[string][]string{},
+		FailChannels: map[string]bool{},
+		Flags:        map[string]discordgo.MessageFlags{},
+	}
+}
+
+// ChannelMessageSend records the message
+func (f *fakeMessenger) ChannelMessageSend(channelID, content string, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.FailChannels[channelID] {
+		return nil, errors.New("HTTP 403 Forbidden, Missing Access")
+	}
+	f.lastID++
+	msg := &discordgo.Message{
+		ID:        fmt.Sprint(f.lastID),
+		ChannelID: channelID,
+		Content:   content,
+		Timestamp: time.Now(),
+	}
+	f.Sent = append(f.Sent, msg)
+	return msg, nil
+}
+
+// ChannelMessageSendComplex records the message including embeds and components
+func (f *fakeMessenger) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend,
+	_ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	msg, err := f.ChannelMessageSend(channelID, data.Content)
+	if err == nil {
+		f.mu.Lock()
+		msg.Embeds = data.Embeds
+		msg.Components = data.Components
+		f.mu.Unlock()
+	}
+	return msg, err
+}
+
+// ChannelMessageEditComplex records the edit including embeds and components
+func (f *fakeMessenger) ChannelMessageEditComplex(edit *discordgo.MessageEdit,
+	_ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	content := ""
+	if edit.Content != nil {
+		content = *edit.Content
+	}
+	msg, err := f.ChannelMessageEdit(edit.Channel, edit.ID, content)
+	if err == nil {
+		f.mu.Lock()
+		msg.Embeds = edit.Embeds
+		msg.Components = edit.Components
+		f.mu.Unlock()
+	}
+	return msg, err
+}
+
+// ChannelMessageEdit records the edit. Fails if the message has not been sent previously.
+func (f *fakeMessenger) ChannelMessageEdit(channelID, messageID, content string,
+	_ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, sent := range f.Sent {
+		if sent.ID != messageID || sent.ChannelID != channelID {
+			continue
+		}
+		msg := &discordgo.Message{ID: messageID, ChannelID: channelID, Content: content}
+		f.Edited = append(f.Edited, msg)
+		return msg, nil
+	}
+	return nil, errors.New("HTTP 404 Not Found, Unknown Message")
+}
+
+// GuildRoles returns roles added using AddRole
+func (f *fakeMessenger) GuildRoles(guildID string, _ ...discordgo.RequestOption) ([]*discordgo.Role, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Roles[guildID], nil
+}
+
+// GuildMember returns a member with roles assigned using AddRole
+func (f *fakeMessenger) GuildMember(guildID, userID string, _ ...discordgo.RequestOption) (*discordgo.Member, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &discordgo.Member{
+		GuildID: guildID,
+		User:    &discordgo.User{ID: userID},
+		Roles:   f.MemberRoles[guildID][userID],
+	}, nil
+}
+
+// UserChannelCreate returns a private message channel with the ID "dm-" followed by the user ID
+func (f *fakeMessenger) UserChannelCreate(recipientID string, _ ...discordgo.RequestOption) (*discordgo.Channel,
+	error) {
+	return &discordgo.Channel{ID: "dm-" + recipientID, Type: discordgo.ChannelTypeDM}, nil
+}
+
+// InteractionRespond records the response
+func (f *fakeMessenger) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse,
+	_ ...discordgo.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Responses = append(f.Responses, resp)
+	return nil
+}
+
+// FollowupMessageCreate records the follow-up message as sent to the channel of the interaction
+func (f *fakeMessenger) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool,
+	data *discordgo.WebhookParams, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	msg, err := f.ChannelMessageSendComplex(interaction.ChannelID, &discordgo.MessageSend{
+		Content:    data.Content,
+		Embeds:     data.Embeds,
+		Components: data.Components,
+	})
+	if err == nil {
+		f.mu.Lock()
+		f.Flags[msg.ID] = data.Flags
+		f.mu.Unlock()
+	}
+	return msg, err
+}
+
+// FollowupMessageEdit records the edit of the follow-up message
+func (f *fakeMessenger) FollowupMessageEdit(interaction *discordgo.Interaction, messageID string,
+	data *discordgo.WebhookEdit, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	edit := &discordgo.MessageEdit{ID: messageID, Channel: interaction.ChannelID, Content: data.Content}
+	if data.Embeds != nil {
+		edit.Embeds = *data.Embeds
+	}
+	if data.Components != nil {
+		edit.Components = *data.Components
+	}
+	return f.ChannelMessageEditComplex(edit)
+}
+
+// AddRole creates a guild role (if not exists) and assigns it to the users
+func (f *fakeMessenger) AddRole(guildID, roleName string, userIDs ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var role *discordgo.Role
+	for _, r := range f.Roles[guildID] {
+		if r.Name == roleName {
+			role = r
+		}
+	}
+	if role == nil {
+		role = &discordgo.Role{ID: fmt.Sprintf("role-%s-%d", guildID, len(f.Roles[guildID])), Name: roleName}
+		f.Roles[guildID] = append(f.Roles[guildID], role)
+	}
+	if f.MemberRoles[guildID] == nil {
+		f.MemberRoles[guildID] = map[string][]string{}
+	}
+	for _, userID := range userIDs {
+		f.MemberRoles[guildID][userID] = append(f.MemberRoles[guildID][userID], role.ID)
+	}
+}
+
+// Messages returns contents of all messages sent to a channel
+func (f *fakeMessenger) Messages(channelID string) (contents []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, msg := range f.Sent {
+		if msg.ChannelID == channelID {
+			contents = append(contents, msg.Content)
+		}
+	}
+	return
+}
+
+// LastMessage returns content of the last message sent to a channel
+func (f *fakeMessenger) LastMessage(channelID string) string {
+	msgs := f.Messages(channelID)
+	if len(msgs) == 0 {
+		return ""
+	}
+	return msgs[len(msgs)-1]
+}
+
+// Reset clears all sent and edited messages
+func (f *fakeMessenger) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Sent = nil
+	f.Edited = nil
+	f.Responses = nil
+}
+
+// newMessageCreate constructs a MessageCreate event as received from Discord.
+// Leave guildID empty for private messages.
+func newMessageCreate(guildID, channelID, username, content string) *discordgo.MessageCreate {
+	return &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ID:        fmt.Sprint(time.Now().UnixNano()),
+			GuildID:   guildID,
+			ChannelID: channelID,
+			Content:   content,
+			Author: &discordgo.User{
+				ID:            "id-" + strings.ToLower(username),
+				Username:      username,
+				Discriminator: "0001",
+			},
+		},
+	}
+}
@@ -7,37 +7,24 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
-func guildCMDHandler(discord *discordgo.Session, message *discordgo.MessageCreate) {
+func guildCMDHandler(discord Messenger, message *discordgo.MessageCreate, lang string, args commandArgs) {
 	if message.GuildID == "" {
 		// ignore if not from a guild
 		return
 	}
 	text := ""
-	args := strings.Split(message.Content, " ")[1:]
-	numArgs := len(args)
-	userID := message.Author.ID
 	guildID := message.GuildID
 	exists := false
-	notExistsTxt := "Guild command not found!"
-	cmdName, action := "", ""
+	notExistsTxt := tr(lang, "Guild command not found!")
+	action := args.String("action", "")
+	cmdName := args.String("command-name", "")
+	msg := args.String("message", "")
+	before := Command{}
 	var err error
-	if !userHasRole(discord, guildID, userID, guildAdminRole) &&
-		fmt.Sprint(message.Author) != conf.Client.DiscordBot.RootUser {
-		text = "You do not have permission to manage guild commands"
-		goto SendMessage
-	}
-	if numArgs < 1 {
-		text = "Action required"
-		goto SendMessage
-	}
-	if numArgs < 2 {
-		text = "Command name required"
-		goto SendMessage
+	if gCMDs, found := state.GuildCommands(guildID); found {
+		before, exists = gCMDs[cmdName]
 	}
-	action = args[0]
-	cmdName = args[1]
-	_, exists = guildCommands[guildID][cmdName]
-	switch strings.ToLower(action) {
+	switch action {
 	case "update":
 		if !exists {
 			text = notExistsTxt
@@ -45,17 +32,16 @@ func guildCMDHandler(discord *discordgo.Session, message *discordgo.MessageCreat
 		}
 		fallthrough
 	case "add":
-		if !exists && numArgs < 3 {
-			text = "Message required"
+		if !exists && msg == "" {
+			text = tr(lang, "Message required")
 			goto SendMessage
 		}
 		if strings.ToLower(cmdName) == guildCMD {
-			text = "This command cannot be overridden."
+			text = tr(lang, "This command cannot be overridden.")
 			goto SendMessage
 		}
-		msg := strings.Join(args[2:], " ")
 		if len(msg) > 500 {
-			text = "Message cannot be more than 500 characters"
+			text = tr(lang, "Message cannot be more than 500 characters")
 			goto SendMessage
 		}
 		err = addGuildCommand(guildID, strings.ToLower(cmdName), msg)
@@ -66,20 +52,32 @@ func guildCMDHandler(discord *discordgo.Session, message *discordgo.MessageCreat
 			goto SendMessage
 		}
 		err = removeGuildCommand(guildID, cmdName)
+		msg = ""
 		break
 	default:
-		text = "Invalid action"
+		text = tr(lang, "Invalid action")
 		goto SendMessage
 	}
 
-	text = "Action failed"
+	text = tr(lang, "Action failed")
 	if !logErrorTS(guildCMD, err) {
-		text = action + "d"
-		if action == "add" {
-			text = "added"
+		switch action {
+		case "add":
+			text = tr(lang, "added")
+			break
+		case "update":
+			text = tr(lang, "updated")
+			break
+		case "delete":
+			text = tr(lang, "deleted")
+			break
+		default:
+			text = tr(lang, "removed")
+			break
 		}
 		// generate list of commands
 		generateCommandLists()
+		audit(discord, message, guildCMD+" "+action, strings.ToLower(cmdName), before.Message, msg)
 	}
 SendMessage:
 	discordSend(discord, message.ChannelID, text, true)
@@ -90,28 +88,32 @@ func addGuildCommand(guildID, name, message string) (err error) {
 		err = fmt.Errorf("Command name required")
 		return
 	}
-	if data.GuildInfoCommands == nil {
-		data.GuildInfoCommands = GuildCommands{}
-	}
-	if data.GuildInfoCommands[guildID] == nil {
-		data.GuildInfoCommands[guildID] = Commands{}
-	}
-	data.GuildInfoCommands[guildID][name] = Command{
-		Type:        "text",
-		IsPublic:    true,
-		Message:     strings.Replace(message, `"`, "'", 0),
-		Description: "Text-only command",
-	}
-	return saveDataFile()
+	return state.Update(func(data *DiscordData) error {
+		if data.GuildInfoCommands == nil {
+			data.GuildInfoCommands = GuildCommands{}
+		}
+		if data.GuildInfoCommands[guildID] == nil {
+			data.GuildInfoCommands[guildID] = Commands{}
+		}
+		data.GuildInfoCommands[guildID][name] = Command{
+			Type:        "text",
+			IsPublic:    true,
+			Message:     strings.Replace(message, `"`, "'", 0),
+			Description: "Text-only command",
+		}
+		return nil
+	}, Record{bucketGuildCommands, guildID})
 }
 
 func removeGuildCommand(guildID, name string) (err error) {
-	if data.GuildInfoCommands == nil {
-		data.GuildInfoCommands = GuildCommands{}
-	}
-	if data.GuildInfoCommands[guildID] == nil {
-		data.GuildInfoCommands[guildID] = Commands{}
-	}
-	delete(data.GuildInfoCommands[guildID], name)
-	return saveDataFile()
+	return state.Update(func(data *DiscordData) error {
+		if data.GuildInfoCommands == nil {
+			data.GuildInfoCommands = GuildCommands{}
+		}
+		if data.GuildInfoCommands[guildID] == nil {
+			data.GuildInfoCommands[guildID] = Commands{}
+		}
+		delete(data.GuildInfoCommands[guildID], name)
+		return nil
+	}, Record{bucketGuildCommands, guildID})
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const maxPrefixLength = 5
+
+// matches the default command prefix used in the command descriptions and examples
+var defaultPrefixRegex = regexp.MustCompile(`(^|[\s'(,])!([a-z])`)
+
+// withPrefix replaces the default prefix "!" of the commands mentioned in text with prefix
+func withPrefix(text, prefix string) string {
+	if prefix == "!" {
+		return text
+	}
+	return defaultPrefixRegex.ReplaceAllString(text, "${1}"+strings.Replace(prefix, "$", "$$", -1)+"${2}")
+}
+
+// trimBotMention removes the bot mention (<@botID> or <@!botID>) from the start of the text.
+// Returns false if text does not start with a bot mention.
+func trimBotMention(text string) (string, bool) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	for _, mention := range []string{"<@" + botID + ">", "<@!" + botID + ">"} {
+		if botID != "" && strings.HasPrefix(text, mention) {
+			return strings.TrimPrefix(text, mention), true
+		}
+	}
+	return text, false
+}
+
+// validatePrefix checks if prefix can be used as a command prefix
+func validatePrefix(prefix string) *argError {
+	if prefix == "" || len([]rune(prefix)) > maxPrefixLength {
+		return argErrorf("Prefix must be between 1 and %d characters", maxPrefixLength)
+	}
+	if strings.IndexFunc(prefix, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '“' || r == '`'
+	}) >= 0 {
+		return argErrorf("Prefix cannot contain whitespaces, quotes or backticks")
+	}
+	if strings.HasPrefix(prefix, "<@") {
+		return argErrorf("Prefix cannot be a mention")
+	}
+	return nil
+}
+
+func cmdPrefix(discord Messenger, message *discordgo.MessageCreate, lang, debugTag string, args commandArgs) {
+	guildID := message.GuildID
+	if guildID == "" {
+		// ignore if not from a guild
+		return
+	}
+	text := ""
+	prefix := args.String("new-prefix", "")
+	before := state.GuildSettings(guildID).Prefix
+	var err error
+	switch args.String("action", "") {
+	case "set":
+		if e := validatePrefix(prefix); e != nil {
+			text = e.Translate(lang)
+			goto SendMessage
+		}
+		err = state.UpdateGuildSettings(guildID, func(settings *GuildSettings) {
+			settings.Prefix = prefix
+		})
+		if commandErrorIf(err, discord, message.ChannelID, tr(lang, "Failed to save prefix"), debugTag) {
+			return
+		}
+		audit(discord, message, "prefix set", "", before, prefix)
+		text = tr(lang, "Command prefix changed to %s. Example: %shelp", prefix, prefix)
+		break
+	case "reset":
+		err = state.UpdateGuildSettings(guildID, func(settings *GuildSettings) {
+			settings.Prefix = ""
+		})
+		if commandErrorIf(err, discord, message.ChannelID, tr(lang, "Failed to reset prefix"), debugTag) {
+			return
+		}
+		audit(discord, message, "prefix reset", "", before, "")
+		prefix = state.CommandPrefix(guildID)
+		text = tr(lang, "Command prefix reset to %s", prefix)
+		break
+	default:
+		text = tr(lang, "Current command prefix: %s", state.CommandPrefix(guildID))
+	}
+SendMessage:
+	discordSend(discord, message.ChannelID, text, true)
+}
+
+func cmdOutput(discord Messenger, message *discordgo.MessageCreate, lang, debugTag string, args commandArgs) {
+	guildID := message.GuildID
+	if guildID == "" {
+		// ignore if not from a guild
+		return
+	}
+	text := ""
+	style := args.String("style", "")
+	before := "codeblock"
+	if useEmbeds(guildID) {
+		before = "embed"
+	}
+	var err error
+	if style == "" {
+		text = tr(lang, "Current output style: %s", before)
+		goto SendMessage
+	}
+	err = state.UpdateGuildSettings(guildID, func(settings *GuildSettings) {
+		settings.Embeds = style == "embed"
+	})
+	if commandErrorIf(err, discord, message.ChannelID, tr(lang, "Failed to save output style"), debugTag) {
+		return
+	}
+	audit(discord, message, "output", "", before, style)
+	text = tr(lang, "Output style changed to %s", style)
+SendMessage:
+	discordSend(discord, message.ChannelID, text, true)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGuildPrefix(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "ButlerAdmin", "id-admin")
+
+	reply := send(fake, testGuildID, testChannelID, "alice", "!prefix set ?")
+	if !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	for _, invalid := range []string{"toolong", "`"} {
+		reply = send(fake, testGuildID, testChannelID, "admin", "!prefix set "+invalid)
+		if !strings.HasPrefix(reply, "```Prefix") {
+			t.Fatalf("%s: expected invalid prefix, got: %q", invalid, reply)
+		}
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!prefix set ?")
+	if !strings.Contains(reply, "Command prefix changed to ?") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if p := state.CommandPrefix(testGuildID); p != "?" {
+		t.Fatalf("expected guild prefix ?, got %q", p)
+	}
+	if p := state.CommandPrefix("guild-2"); p != "!" {
+		t.Fatalf("other guilds must use the configured prefix, got %q", p)
+	}
+
+	// the configured prefix is ignored in the guild
+	n := len(fake.Sent)
+	send(fake, testGuildID, testChannelID, "alice", "!help")
+	if len(fake.Sent) != n {
+		t.Fatalf("expected no reply, got: %q", fake.LastMessage(testChannelID))
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "?help")
+	if !strings.Contains(reply, "?ticker [quote-ticker]") || strings.Contains(reply, "!ticker") {
+		t.Fatalf("help must use the guild prefix: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "?help addresses")
+	if !strings.Contains(reply, "?address add 0x1234") || !strings.Contains(reply, "Aliases: ?addresses") {
+		t.Fatalf("examples must use the guild prefix: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "?trades halo eth 10 x")
+	if !strings.Contains(reply, "Usage: ?trades") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	reply = send(fake, testGuildID, testChannelID, "admin", "?prefix reset")
+	if !strings.Contains(reply, "Command prefix reset to !") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if !state.GuildSettings(testGuildID).isEmpty() {
+		t.Fatal("empty guild settings should be removed")
+	}
+}
+
+func TestBotMention(t *testing.T) {
+	fake := setupCommandTest(t)
+	reply := send(fake, testGuildID, testChannelID, "alice", "<@id-bot> help help")
+	if !strings.Contains(reply, "!help [command-name]") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "<@!id-bot>  help help")
+	if !strings.Contains(reply, "!help [command-name]") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "<@id-bot>")
+	if !strings.Contains(reply, "!help") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	n := len(fake.Sent)
+	send(fake, testGuildID, testChannelID, "alice", "<@id-other> help")
+	if len(fake.Sent) != n {
+		t.Fatalf("expected no reply, got: %q", fake.LastMessage(testChannelID))
+	}
+}
+
+func TestWithPrefix(t *testing.T) {
+	text := withPrefix("!cmc powr, OR, !powr (shorthand for '!cmc powr') Wow! ok", "$")
+	if text != "$cmc powr, OR, $powr (shorthand for '$cmc powr') Wow! ok" {
+		t.Fatalf("unexpected text: %q", text)
+	}
+}
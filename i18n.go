@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alien45/halo-info-bot/client"
+	"github.com/bwmarrin/discordgo"
+)
+
+// defaultLanguage is the language of the messages in the source code. Used if no language is configured.
+const defaultLanguage = "en"
+
+// localesDir is a variable to allow tests to use a temporary directory
+var localesDir = "./locales"
+
+// Plural rules. Determine the plural form of a message for a quantity.
+const (
+	// one: 1, other: everything else. Eg: English, Spanish, German
+	pluralOneOther = "one-other"
+	// one: 0 and 1, other: everything else. Eg: French, Portuguese (Brazil)
+	pluralFrench = "french"
+	// one: 1, 21, 31..., few: 2-4, 22-24..., many: everything else. Eg: Russian, Ukrainian
+	pluralSlavic = "slavic"
+	// other: everything. Eg: Chinese, Japanese, Korean
+	pluralNone = "none"
+)
+
+// formatVerbRegex matches the formatting verbs of a message, except for escaped percent signs. Eg: %s, %.2f
+var formatVerbRegex = regexp.MustCompile(`%[-+# 0]*(\[\d+\])?\d*(\.\d+)?[a-zA-Z]`)
+
+// Locale describes the formatting of numbers and dates and the plural rule of a language
+type Locale struct {
+	// Name of the language in the language itself. Eg: Español
+	Name string `json:"name"`
+	// Default: "."
+	DecimalSeparator string `json:"decimal"`
+	// Default: ","
+	ThousandsSeparator string `json:"thousands"`
+	// Go time layout. Default: 2006-01-02 15:04:05
+	DateFormat string `json:"dateformat"`
+	// Valid rules: one-other (default), french, slavic, none
+	PluralRule string `json:"plural"`
+}
+
+// pluralForm returns the plural form used for a quantity: one, few, many or other
+func (l Locale) pluralForm(n int64) string {
+	if n < 0 {
+		n = -n
+	}
+	switch l.PluralRule {
+	case pluralFrench:
+		if n <= 1 {
+			return "one"
+		}
+		return "other"
+	case pluralSlavic:
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		}
+		return "many"
+	case pluralNone:
+		return "other"
+	}
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+// translation contains the plural forms of a translated message: one, few, many and/or other.
+// A translation without plural forms may be specified as a string, which is used as the "other" form.
+type translation map[string]string
+
+// UnmarshalJSON decodes a translation from a string or an object of plural forms
+func (t *translation) UnmarshalJSON(b []byte) error {
+	s := ""
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = translation{"other": s}
+		return nil
+	}
+	forms := map[string]string{}
+	if err := json.Unmarshal(b, &forms); err != nil {
+		return err
+	}
+	*t = forms
+	return nil
+}
+
+// Catalog contains the locale and the translated messages and commands of a language
+type Catalog struct {
+	Locale Locale `json:"locale"`
+	// Translated messages. Key: English message as used in the source code or, for messages with plural forms,
+	// the English "other" form.
+	Messages map[string]translation `json:"messages"`
+	// Translated description and example of the built-in and info commands. Key: command name
+	Commands map[string]commandText `json:"commands"`
+}
+
+// englishCatalog is used for the default language, unless a catalog is supplied, and for unknown languages
+var englishCatalog = &Catalog{Locale: Locale{Name: "English"}}
+
+// loadCatalogs reads the message catalogs from the locales directory. One file per language named using the
+// language code. Eg: es.json. Returns an error if a translation uses different formatting verbs than the message.
+func loadCatalogs(dir string) (catalogs map[string]*Catalog, err error) {
+	catalogs = map[string]*Catalog{}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return catalogs, nil
+	}
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		lang := strings.ToLower(strings.TrimSuffix(file.Name(), ".json"))
+		str, err := client.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		c := &Catalog{}
+		if err = json.Unmarshal([]byte(str), c); err != nil {
+			return nil, fmt.Errorf("%s: %v", file.Name(), err)
+		}
+		if err = c.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", file.Name(), err)
+		}
+		if c.Locale.Name == "" {
+			c.Locale.Name = lang
+		}
+		catalogs[lang] = c
+	}
+	return
+}
+
+// validate checks the plural rule and that every translation uses the same formatting verbs as the message
+func (c *Catalog) validate() error {
+	switch c.Locale.PluralRule {
+	case "", pluralOneOther, pluralFrench, pluralSlavic, pluralNone:
+		break
+	default:
+		return fmt.Errorf("Invalid plural rule: %s", c.Locale.PluralRule)
+	}
+	invalid := []string{}
+	for msg, t := range c.Messages {
+		for form, s := range t {
+			if !sameFormatVerbs(msg, s) {
+				invalid = append(invalid, fmt.Sprintf("%q (%s)", msg, form))
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("Formatting verbs do not match the message: %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// sameFormatVerbs checks if two messages use the same formatting verbs in the same order
+func sameFormatVerbs(a, b string) bool {
+	a, b = strings.Replace(a, "%%", "", -1), strings.Replace(b, "%%", "", -1)
+	return strings.Join(formatVerbRegex.FindAllString(a, -1), " ") ==
+		strings.Join(formatVerbRegex.FindAllString(b, -1), " ")
+}
+
+// tr translates a message to the language and formats it using the arguments, if any.
+// Returns the message as is if not translated.
+func tr(lang, msg string, args ...interface{}) string {
+	if s := state.Catalog(lang).Messages[msg]["other"]; s != "" {
+		msg = s
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// trn translates a message with plural forms to the language and formats it using the arguments. The form is
+// chosen for the quantity n using the plural rule of the language. Eg:
+// trn(lang, n, "%d channel", "%d channels", n)
+func trn(lang string, n int64, one, other string, args ...interface{}) string {
+	c := state.Catalog(lang)
+	msg := other
+	if n == 1 || n == -1 {
+		msg = one
+	}
+	if t, found := c.Messages[other]; found {
+		if s := t[c.Locale.pluralForm(n)]; s != "" {
+			msg = s
+		} else if t["other"] != "" {
+			msg = t["other"]
+		}
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// formatNumber formats a number with the decimal and thousands separators of the language
+func formatNumber(lang string, num float64, dp int) string {
+	l := state.Catalog(lang).Locale
+	decimal, thousands := l.DecimalSeparator, l.ThousandsSeparator
+	if decimal == "" {
+		decimal = "."
+	}
+	if thousands == "" {
+		thousands = ","
+	}
+	return strings.NewReplacer(",", thousands, ".", decimal).Replace(client.FormatNum(num, dp))
+}
+
+// formatNumberShort formats a large number using the initial of the number name and the decimal separator of the
+// language. Eg: 1,50 M
+func formatNumberShort(lang string, num float64, dp int) string {
+	if decimal := state.Catalog(lang).Locale.DecimalSeparator; decimal != "" {
+		return strings.Replace(client.FormatNumShort(num, dp), ".", decimal, 1)
+	}
+	return client.FormatNumShort(num, dp)
+}
+
+// formatDate formats a time using the date format of the language
+func formatDate(lang string, t time.Time) string {
+	if layout := state.Catalog(lang).Locale.DateFormat; layout != "" {
+		return t.Format(layout)
+	}
+	return client.FormatTS(t)
+}
+
+// localizer formats the outputs of the client package, eg: Ticker.Format, in the language it is set to
+type localizer string
+
+// T translates a message. See tr.
+func (lang localizer) T(msg string, args ...interface{}) string {
+	return tr(string(lang), msg, args...)
+}
+
+// Num formats a number. See formatNumber.
+func (lang localizer) Num(num float64, dp int) string {
+	return formatNumber(string(lang), num, dp)
+}
+
+// Date formats a time. See formatDate.
+func (lang localizer) Date(t time.Time) string {
+	return formatDate(string(lang), t)
+}
+
+// formatLanguage returns the name and code of a language. Eg: Español (es)
+func formatLanguage(lang string) string {
+	return fmt.Sprintf("%s (%s)", state.Catalog(lang).Locale.Name, lang)
+}
+
+// cmdLanguage shows and changes the language of the user or, for guild admins, the language of the guild.
+// The language of the user overrides the language of the guild.
+func cmdLanguage(discord Messenger, message *discordgo.MessageCreate, lang, debugTag string, args commandArgs) {
+	guildID, userID := message.GuildID, message.Author.ID
+	isGuild := args.Has("scope")
+	language := strings.ToLower(args.String("language", ""))
+	text := ""
+	before := state.UserSettings(userID).Language
+	var err error
+	if isGuild {
+		before = state.GuildSettings(guildID).Language
+	}
+	switch {
+	case isGuild && guildID == "":
+		text = tr(lang, "Server language is only available in guilds")
+		goto SendMessage
+	case language == "":
+		text = tr(lang, "Your language: %s\n", formatLanguage(lang))
+		if guildID != "" {
+			text += tr(lang, "Server language: %s\n", formatLanguage(state.Language(guildID, "")))
+		}
+		languages := []string{}
+		for _, code := range state.Languages() {
+			languages = append(languages, formatLanguage(code))
+		}
+		text += tr(lang, "Available languages: %s", strings.Join(languages, ", "))
+		goto SendMessage
+	case isGuild && !isGuildAdmin(discord, message):
+		text = tr(lang, "You do not have permission to change the server language")
+		goto SendMessage
+	case language == "reset":
+		language = ""
+		break
+	case !state.HasLanguage(language):
+		text = tr(lang, "Unsupported language: %s", language)
+		goto SendMessage
+	}
+
+	if isGuild {
+		err = state.UpdateGuildSettings(guildID, func(settings *GuildSettings) {
+			settings.Language = language
+		})
+	} else {
+		err = state.UpdateUserSettings(userID, func(settings *UserSettings) {
+			settings.Language = language
+		})
+	}
+	if commandErrorIf(err, discord, message.ChannelID, tr(lang, "Failed to save language"), debugTag) {
+		return
+	}
+	lang = state.Language(guildID, userID)
+	if isGuild {
+		audit(discord, message, "language guild", "", before, language)
+		text = tr(lang, "Server language changed to %s", formatLanguage(state.Language(guildID, "")))
+		goto SendMessage
+	}
+	text = tr(lang, "Your language changed to %s", formatLanguage(lang))
+SendMessage:
+	_, err = discordSend(discord, message.ChannelID, text, true)
+	logErrorTS(debugTag, err)
+}
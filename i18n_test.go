@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPluralForms(t *testing.T) {
+	tests := []struct {
+		rule  string
+		n     int64
+		wants string
+	}{
+		{"", 1, "one"},
+		{pluralOneOther, 0, "other"},
+		{pluralOneOther, 2, "other"},
+		{pluralFrench, 0, "one"},
+		{pluralFrench, 2, "other"},
+		{pluralSlavic, 21, "one"},
+		{pluralSlavic, 11, "many"},
+		{pluralSlavic, 3, "few"},
+		{pluralSlavic, 13, "many"},
+		{pluralSlavic, 25, "many"},
+		{pluralNone, 1, "other"},
+	}
+	for _, test := range tests {
+		if form := (Locale{PluralRule: test.rule}).pluralForm(test.n); form != test.wants {
+			t.Errorf("%s %d: expected %q, got %q", test.rule, test.n, test.wants, form)
+		}
+	}
+}
+
+func TestLoadCatalogs(t *testing.T) {
+	// shipped catalogs must be valid
+	catalogs, err := loadCatalogs(localesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalogs["es"] == nil || catalogs["es"].Locale.Name != "Español" {
+		t.Fatalf("es catalog not loaded: %+v", catalogs)
+	}
+
+	dir, err := ioutil.TempDir("", "halo-info-bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "ru.json"), []byte(`{
+		"locale": { "name": "Русский", "plural": "slavic" },
+		"messages": { "Try again in %d seconds.": { "one": "Повторите через %d секунду.", "few": "Повторите через %s секунды." } }
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loadCatalogs(dir); err == nil || !strings.Contains(err.Error(), "(few)") {
+		t.Fatalf("expected formatting verbs error, got: %v", err)
+	}
+	if catalogs, err = loadCatalogs(filepath.Join(dir, "missing")); err != nil || len(catalogs) != 0 {
+		t.Fatalf("missing directory should be ignored: %v", err)
+	}
+}
+
+func TestTranslation(t *testing.T) {
+	setupCommandTest(t)
+	state.SetCatalogs(map[string]*Catalog{
+		"ru": {
+			Locale: Locale{Name: "Русский", PluralRule: pluralSlavic, DecimalSeparator: ",", ThousandsSeparator: " ",
+				DateFormat: "02.01.2006"},
+			Messages: map[string]translation{
+				"Try again in %d seconds.": {"one": "через %d секунду", "few": "через %d секунды", "many": "через %d секунд"},
+			},
+		},
+	})
+	for n, wants := range map[int64]string{1: "через 1 секунду", 3: "через 3 секунды", 11: "через 11 секунд"} {
+		if s := trn("ru", n, "Try again in %d second.", "Try again in %d seconds.", n); s != wants {
+			t.Errorf("expected %q, got %q", wants, s)
+		}
+	}
+	// untranslated messages and unknown languages use the English text
+	if s := trn("xx", 1, "Try again in %d second.", "Try again in %d seconds.", 1); s != "Try again in 1 second." {
+		t.Errorf("unexpected message: %q", s)
+	}
+	if s := tr("ru", "Page %d", 2); s != "Page 2" {
+		t.Errorf("unexpected message: %q", s)
+	}
+	if s := formatNumber("ru", 1234567.891, 2); s != "1 234 567,89" {
+		t.Errorf("unexpected number: %q", s)
+	}
+	if s := formatNumber("en", -1234.5, 1); s != "-1,234.5" {
+		t.Errorf("unexpected number: %q", s)
+	}
+	if s := formatDate("ru", time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)); s != "04.03.2020" {
+		t.Errorf("unexpected date: %q", s)
+	}
+}
+
+func TestLanguageCommand(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "ButlerAdmin", "id-admin")
+	catalogs, err := loadCatalogs(localesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetCatalogs(catalogs)
+
+	reply := send(fake, "", testDMChannelID, "alice", "!language fr")
+	if !strings.Contains(reply, "Unsupported language: fr") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!language es")
+	if !strings.Contains(reply, "Tu idioma se cambió a Español (es)") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if reply = send(fake, "", testDMChannelID, "alice", "!balance"); !strings.Contains(reply, "Se requiere una dirección.") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!help address")
+	if !strings.Contains(reply, "Añade, elimina y lista") || !strings.Contains(reply, "Alias: !addresses") {
+		t.Fatalf("help should be translated: %q", reply)
+	}
+	if reply = send(fake, "", testDMChannelID, "alice", "!help"); !strings.Contains(reply, "<argumento> => obligatorio") {
+		t.Fatalf("help legend should be translated: %q", reply)
+	}
+	if reply = send(fake, "", testDMChannelID, "alice", "!trades halo eth 10 x"); !strings.Contains(reply,
+		"page-no no válido: x. Se esperaba un número entero entre 1 y 1000") {
+		t.Fatalf("argument errors should be translated: %q", reply)
+	}
+	if reply = send(fake, "", testDMChannelID, "alice", "!mn roi"); !strings.Contains(reply, "Nivel 1") ||
+		!strings.Contains(reply, "Diario") {
+		t.Fatalf("formatted outputs should be translated: %q", reply)
+	}
+
+	// the language of the user overrides the language of the guild
+	reply = send(fake, testGuildID, testChannelID, "bob", "!language guild es")
+	if !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!language guild es")
+	if !strings.Contains(reply, "El idioma del servidor se cambió a Español (es)") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "bob", "!nodes")
+	if !strings.Contains(reply, "Los comandos privados no están permitidos en canales públicos.") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if reply = send(fake, "", testDMChannelID, "bob", "!nodes"); !strings.Contains(reply, "Owner address required") {
+		t.Fatalf("guild language should not apply to private messages: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!prefix set <@bot")
+	if !strings.Contains(reply, "El prefijo no puede ser una mención") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	send(fake, testGuildID, testChannelID, "alice", "!language reset")
+	send(fake, "", testDMChannelID, "alice", "!language en")
+	if reply = send(fake, testGuildID, testChannelID, "alice", "!language"); !strings.Contains(reply, "Your language: English (en)") ||
+		!strings.Contains(reply, "Server language: Español (es)") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if settings := state.UserSettings("id-alice"); settings.Language != "en" {
+		t.Fatalf("unexpected user settings: %+v", settings)
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+// Log levels
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string {
+	if l < levelDebug || l > levelError {
+		return "unknown"
+	}
+	return logLevelNames[l]
+}
+
+// parseLogLevel returns the log level by name. Returns defaultLevel if name is empty.
+func parseLogLevel(name string, defaultLevel logLevel) (logLevel, error) {
+	if name == "" {
+		return defaultLevel, nil
+	}
+	for i, n := range logLevelNames {
+		if n == strings.ToLower(name) {
+			return logLevel(i), nil
+		}
+	}
+	return defaultLevel, fmt.Errorf("Invalid log level: %s", name)
+}
+
+// LogConfig describes log output, rotation and debug channel settings
+type LogConfig struct {
+	// Log file path. Default: ./debug.log
+	File string `json:"file"`
+	// Output format. Valid formats: logfmt (default), json
+	Format string `json:"format"`
+	// Minimum level to log. Valid levels: debug, info (default), warn, error
+	Level string `json:"level"`
+	// Maximum size of the log file in megabytes before it is rotated. Default: 10
+	MaxSizeMB float64 `json:"maxsizemb"`
+	// Maximum age of the log file in days before it is rotated. Default: 7
+	MaxAgeDays float64 `json:"maxagedays"`
+	// Number of rotated log files to keep. Default: 5
+	MaxBackups int `json:"maxbackups"`
+	// Minimum level of entries to send to the debug channel. Default: error
+	DebugChannelLevel string `json:"debugchannellevel"`
+	// Interval in minutes between digests of repeated entries sent to the debug channel. Default: 10
+	DigestIntervalMins float64 `json:"digestintervalmins"`
+}
+
+// Logger writes structured and levelled log entries. Fields are key/value pairs. Eg: "guild", guildID.
+type Logger struct {
+	fields []interface{}
+	core   *logCore
+}
+
+// logCore is shared between a logger and all of it's child loggers
+type logCore struct {
+	mutex        sync.Mutex
+	out          io.Writer
+	json         bool
+	level        logLevel
+	channelLevel logLevel
+	// repeated entries sent to the debug channel. Key: tag and message
+	digest map[string]*digestItem
+}
+
+type digestItem struct {
+	level   logLevel
+	tag     string
+	msg     string
+	repeats int
+	last    time.Time
+}
+
+// logger is the application logger
+var logger = newLogger(os.Stdout, false, levelInfo, levelError)
+
+func newLogger(out io.Writer, jsonFormat bool, level, channelLevel logLevel) *Logger {
+	return &Logger{
+		core: &logCore{
+			out:          out,
+			json:         jsonFormat,
+			level:        level,
+			channelLevel: channelLevel,
+			digest:       map[string]*digestItem{},
+		},
+	}
+}
+
+// With returns a child logger that includes the supplied fields in every entry
+func (l *Logger) With(fields ...interface{}) *Logger {
+	return &Logger{
+		fields: append(append([]interface{}{}, l.fields...), fields...),
+		core:   l.core,
+	}
+}
+
+// Debug logs a debug entry
+func (l *Logger) Debug(msg string, fields ...interface{}) { l.log(levelDebug, true, msg, fields) }
+
+// Info logs an info entry
+func (l *Logger) Info(msg string, fields ...interface{}) { l.log(levelInfo, true, msg, fields) }
+
+// Warn logs a warning entry
+func (l *Logger) Warn(msg string, fields ...interface{}) { l.log(levelWarn, true, msg, fields) }
+
+// Error logs an error entry
+func (l *Logger) Error(msg string, fields ...interface{}) { l.log(levelError, true, msg, fields) }
+
+// SetLevels sets the minimum levels to log and to send to the debug channel
+func (l *Logger) SetLevels(level, channelLevel logLevel) {
+	l.core.mutex.Lock()
+	defer l.core.mutex.Unlock()
+	l.core.level = level
+	l.core.channelLevel = channelLevel
+}
+
+func (l *Logger) log(level logLevel, mirror bool, msg string, fields []interface{}) {
+	c := l.core
+	c.mutex.Lock()
+	if level < c.level {
+		c.mutex.Unlock()
+		return
+	}
+	now := time.Now().UTC()
+	allFields := append(append([]interface{}{"time", now.Format(time.RFC3339), "level", level.String(), "msg", msg},
+		l.fields...), fields...)
+	if c.json {
+		fmt.Fprintln(c.out, formatJSON(allFields))
+	} else {
+		fmt.Fprintln(c.out, formatLogfmt(allFields))
+	}
+	send := mirror && level >= c.channelLevel && c.addToDigest(level, fieldValue(allFields, "tag"), msg, now)
+	c.mutex.Unlock()
+	if send {
+		sendToDebugChannel(fmt.Sprintf("%s [%s] [%s] %s", now.Format(time.RFC3339), strings.ToUpper(level.String()),
+			fieldValue(allFields, "tag"), msg))
+	}
+}
+
+// addToDigest adds an entry to the digest. Returns true, if it is the first occurrence of the entry since the last
+// digest and should be sent immediately. Mutex must be locked.
+func (c *logCore) addToDigest(level logLevel, tag, msg string, t time.Time) (first bool) {
+	key := tag + "|" + msg
+	if item, ok := c.digest[key]; ok {
+		item.repeats++
+		item.last = t
+		return false
+	}
+	c.digest[key] = &digestItem{level: level, tag: tag, msg: msg, last: t}
+	return true
+}
+
+// FlushDigest sends the repeated entries to the debug channel and starts a new digest
+func (l *Logger) FlushDigest() {
+	c := l.core
+	c.mutex.Lock()
+	items := []*digestItem{}
+	for _, item := range c.digest {
+		if item.repeats > 0 {
+			items = append(items, item)
+		}
+	}
+	c.digest = map[string]*digestItem{}
+	c.mutex.Unlock()
+	if len(items) == 0 {
+		return
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].repeats > items[j].repeats })
+	txt := "Repeated log entries:\n"
+	for _, item := range items {
+		txt += fmt.Sprintf("%dx [%s] [%s] %s (last: %s)\n", item.repeats, strings.ToUpper(item.level.String()),
+			item.tag, item.msg, item.last.Format(time.RFC3339))
+	}
+	sendToDebugChannel(txt)
+}
+
+// runDigest periodically flushes the digest
+func (l *Logger) runDigest(interval time.Duration) {
+	for range time.Tick(interval) {
+		l.FlushDigest()
+	}
+}
+
+// sendToDebugChannel sends text to the debug channel, if configured and connected to Discord.
+// Failures are logged without being sent to avoid recursion.
+func sendToDebugChannel(txt string) {
+	session := state.Session()
+	c := state.Config()
+	if session == nil || c == nil || c.DebugChannelID == "" {
+		return
+	}
+	if len(txt) > 1994 {
+		txt = txt[:1994]
+	}
+	_, err := session.ChannelMessageSend(c.DebugChannelID, "```"+txt+"```")
+	if err != nil {
+		logger.log(levelError, false, err.Error(), []interface{}{"tag", "sendToDebugChannel"})
+	}
+}
+
+// fieldValue returns the value of a field as string
+func fieldValue(fields []interface{}, key string) string {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == key {
+			return fmt.Sprint(fields[i+1])
+		}
+	}
+	return ""
+}
+
+// formatLogfmt formats fields as logfmt. Eg: level=info msg="hello world"
+func formatLogfmt(fields []interface{}) string {
+	parts := []string{}
+	for i := 0; i < len(fields); i += 2 {
+		var value interface{} = "(missing)"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		v := fmt.Sprint(value)
+		if v == "" || strings.ContainsAny(v, " =\"\n\t") {
+			v = strconv.Quote(v)
+		}
+		parts = append(parts, fmt.Sprintf("%v=%s", fields[i], v))
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatJSON formats fields as a JSON object keeping the order of the fields
+func formatJSON(fields []interface{}) string {
+	parts := []string{}
+	for i := 0; i < len(fields); i += 2 {
+		var value interface{} = "(missing)"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		k, _ := json.Marshal(fmt.Sprint(fields[i]))
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		parts = append(parts, string(k)+":"+string(v))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// stdLogPattern matches the standard log lines written by the API clients. Eg: [CMC] [GetTicker] Using cached tickers
+var stdLogPattern = regexp.MustCompile(`^\[([^\]]+)\] \[([^\]]+)\]:? ?(.*)$`)
+
+// stdLogWriter converts the standard log lines into structured entries with the upstream and tag fields
+type stdLogWriter struct {
+	logger *Logger
+}
+
+func (w stdLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSpace(string(p))
+	if m := stdLogPattern.FindStringSubmatch(line); m != nil {
+		w.logger.Info(m[3], "upstream", m[1], "tag", m[2])
+	} else {
+		w.logger.Info(line)
+	}
+	return len(p), nil
+}
+
+// rotatingFile is a log file that is rotated when it exceeds the maximum size or age
+type rotatingFile struct {
+	mutex      sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	openedAt   time.Time
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (f *rotatingFile, err error) {
+	f = &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err = f.open(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (f *rotatingFile) open() (err error) {
+	f.file, err = os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return
+	}
+	info, err := f.file.Stat()
+	if err != nil {
+		return
+	}
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	if f.size > 0 {
+		// appending to an existing file. Its age is kept across restarts, otherwise it would never be rotated by age
+		// if the bot restarts often.
+		if t, ok := firstEntryTime(f.path); ok {
+			f.openedAt = t
+		}
+	}
+	return
+}
+
+// logTimePattern matches the timestamp at the start of a log entry in either format. Eg: time=2019-01-01T00:00:00Z
+var logTimePattern = regexp.MustCompile(`^(?:\{"time":"|time=)([^" ]+)`)
+
+// firstEntryTime returns the timestamp of the first entry of the log file, ie: when the file was created.
+// Returns false if the file does not start with a log entry.
+func firstEntryTime(path string) (t time.Time, ok bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	buf := make([]byte, 64)
+	n, _ := io.ReadFull(file, buf)
+	m := logTimePattern.FindSubmatch(buf[:n])
+	if m == nil {
+		return
+	}
+	t, err = time.Parse(time.RFC3339, string(m[1]))
+	return t, err == nil
+}
+
+func (f *rotatingFile) Write(p []byte) (n int, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.size > 0 && ((f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize) ||
+		(f.maxAge > 0 && time.Since(f.openedAt) > f.maxAge)) {
+		if err = f.rotate(); err != nil {
+			return
+		}
+	}
+	n, err = f.file.Write(p)
+	f.size += int64(n)
+	return
+}
+
+// rotate renames the current file using the current timestamp, opens a new file and removes the oldest backups
+func (f *rotatingFile) rotate() (err error) {
+	if err = f.file.Close(); err != nil {
+		return
+	}
+	backup := f.path + "." + time.Now().UTC().Format("20060102-150405.000")
+	for i := 1; fileExists(backup); i++ {
+		backup = fmt.Sprintf("%s.%s.%d", f.path, time.Now().UTC().Format("20060102-150405.000"), i)
+	}
+	if err = os.Rename(f.path, backup); err != nil {
+		return
+	}
+	if err = f.open(); err != nil {
+		return
+	}
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil || f.maxBackups <= 0 || len(backups) <= f.maxBackups {
+		return
+	}
+	// timestamp suffix sorts oldest first
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(name)
+	}
+	return
+}
+
+// setupLogger configures the application logger to write to the rotating log file and the standard output
+func setupLogger(c LogConfig) (err error) {
+	level, err := parseLogLevel(c.Level, levelInfo)
+	if err != nil {
+		return
+	}
+	channelLevel, err := parseLogLevel(c.DebugChannelLevel, levelError)
+	if err != nil {
+		return
+	}
+	if c.File == "" {
+		c.File = debugFile
+	}
+	if c.MaxSizeMB <= 0 {
+		c.MaxSizeMB = 10
+	}
+	if c.MaxAgeDays <= 0 {
+		c.MaxAgeDays = 7
+	}
+	if c.MaxBackups <= 0 {
+		c.MaxBackups = 5
+	}
+	file, err := openRotatingFile(
+		c.File,
+		int64(c.MaxSizeMB*1024*1024),
+		time.Duration(c.MaxAgeDays*24*float64(time.Hour)),
+		c.MaxBackups,
+	)
+	if err != nil {
+		return
+	}
+	logger = newLogger(io.MultiWriter(file, os.Stdout), strings.ToLower(c.Format) == "json", level, channelLevel)
+	// API clients use the standard logger
+	log.SetFlags(0)
+	log.SetOutput(stdLogWriter{logger})
+	return
+}
+
+// validateLogConfig checks the log levels of the config
+func validateLogConfig(c LogConfig) (err error) {
+	if _, err = parseLogLevel(c.Level, levelInfo); err != nil {
+		return
+	}
+	_, err = parseLogLevel(c.DebugChannelLevel, levelError)
+	return
+}
+
+// digestInterval returns the interval between debug channel digests
+func digestInterval(c LogConfig) time.Duration {
+	if c.DigestIntervalMins <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(c.DigestIntervalMins * float64(time.Minute))
+}
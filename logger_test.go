@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerFormats(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newLogger(buf, false, levelInfo, levelError).With("guild", "guild-1")
+	l.Debug("hidden")
+	l.Info("Command received", "command", "ticker", "message", `!ticker "halo"`)
+	line := strings.TrimSpace(buf.String())
+	if strings.Contains(line, "hidden") {
+		t.Fatalf("debug entry logged below minimum level: %q", line)
+	}
+	expected := `level=info msg="Command received" guild=guild-1 command=ticker message="!ticker \"halo\""`
+	if !strings.HasSuffix(line, expected) || !strings.HasPrefix(line, "time=") {
+		t.Fatalf("unexpected logfmt entry: %q", line)
+	}
+
+	buf.Reset()
+	l = newLogger(buf, true, levelDebug, levelError)
+	l.Warn("failed", "err", errors.New("timeout"), "count", 2)
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid JSON entry %q: %v", buf.String(), err)
+	}
+	if entry["level"] != "warn" || entry["err"] != "timeout" || entry["count"] != float64(2) {
+		t.Fatalf("unexpected JSON entry: %v", entry)
+	}
+}
+
+func TestLoggerDebugChannelDigest(t *testing.T) {
+	fake := setupCommandTest(t)
+	state.Config().DebugChannelID = "debug"
+	state.SetSession(fake)
+	defer state.SetSession(nil)
+	l := newLogger(ioutil.Discard, false, levelInfo, levelWarn)
+
+	l.Info("not mirrored", "tag", "test")
+	for i := 0; i < 5; i++ {
+		l.Error("connection refused", "tag", "test")
+	}
+	l.Warn("slow response", "tag", "test")
+	msgs := fake.Messages("debug")
+	if len(msgs) != 2 || !strings.Contains(msgs[0], "[ERROR] [test] connection refused") ||
+		!strings.Contains(msgs[1], "[WARN] [test] slow response") {
+		t.Fatalf("expected first occurrences only: %q", msgs)
+	}
+
+	l.FlushDigest()
+	msgs = fake.Messages("debug")
+	if len(msgs) != 3 || !strings.Contains(msgs[2], "4x [ERROR] [test] connection refused") ||
+		strings.Contains(msgs[2], "slow response") {
+		t.Fatalf("unexpected digest: %q", msgs)
+	}
+	// new digest started
+	l.Error("connection refused", "tag", "test")
+	if n := len(fake.Messages("debug")); n != 4 {
+		t.Fatalf("expected error to be sent after digest, got %d messages", n)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "debug.log")
+	f, err := openRotatingFile(path, 100, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte(strings.Repeat("a", 59) + "\n")
+	for i := 0; i < 6; i++ {
+		if _, err = f.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %d", len(backups))
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != len(line) {
+		t.Fatalf("unexpected log file size: %d", len(data))
+	}
+
+	// the age of an existing file is kept when reopened, regardless of the time of the last write
+	entry := "time=" + time.Now().Add(-2*time.Hour).UTC().Format(time.RFC3339) + " level=info msg=test\n"
+	if err = ioutil.WriteFile(path, []byte(entry+entry), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = openRotatingFile(path, 0, time.Hour, 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write(line); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ = filepath.Glob(path + ".*"); len(backups) != 3 {
+		t.Fatalf("expected the old file to be rotated, got %d backups", len(backups))
+	}
+
+	// a recently created file is not rotated
+	entry = `{"time":"` + time.Now().UTC().Format(time.RFC3339) + `","level":"info","msg":"test"}` + "\n"
+	if err = ioutil.WriteFile(path, []byte(entry), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = openRotatingFile(path, 0, time.Hour, 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write(line); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ = filepath.Glob(path + ".*"); len(backups) != 3 {
+		t.Fatalf("expected the new file not to be rotated, got %d backups", len(backups))
+	}
+}
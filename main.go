@@ -3,61 +3,75 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"os"
 	"strings"
-	"time"
 
 	client "github.com/alien45/halo-info-bot/client"
 	"github.com/bwmarrin/discordgo"
 )
 
-const configFile = "./config.json"
-const dataFile = "./discord.json"
-const commandsFile = "./commands.json"
 const debugFile = "./debug.log"
 const payoutsTXFile = "./alert-receiver/payouts.json"
 const payoutLogFile = "./payout-log.json"
-const guildAdminRole = "butleradmin" // case-insensitive allowed
+const databaseFile = "./discord.db"
+const auditLogFile = "./audit-log.jsonl"
 const guildCMD = "guildcmd"
 
+// configFile, dataFile and commandsFile are variables to allow tests to use temporary files
 var (
-	botID          string
-	discordSession *discordgo.Session
-	conf           Config
-	data           DiscordData
-	// API clients
-	cmc       client.CMC
-	dex       client.DEX
-	explorer  client.Explorer
-	etherscan client.Etherscan
-	mndapp    client.MNDApp
-	//
-	addressKeywords map[string]string
-	// Default commands
-	commands = Commands{}
-	// guildCommands
-	guildCommands = GuildCommands{}
-	// Commands names that are not allowed in the public chats. Key: command, value: unused.
-	privateCmds = map[string]string{}
+	configFile   = "./config.json"
+	dataFile     = "./discord.json"
+	commandsFile = "./commands.json"
+)
+
+var (
+	botID string
+	// Config, Discord data, commands, API clients etc. shared between goroutines
+	state = &State{}
 )
 
 // DiscordBot contains Discord bot authentication and other details
 type DiscordBot struct {
 	Token    string `json:"token"`
 	Prefix   string `json:"prefix"`
-	RootUser string `json:"rootuser"`
+	RootUser string `json:"rootuser"` // Deprecated: use RootUsers. Eg: user#1234
+	// IDs of the users allowed to use all commands in all guilds, including the root only commands
+	RootUsers []string `json:"rootusers"`
+	// Default language of the replies. Eg: es. Default: en
+	Language string `json:"language"`
+	// Whether to register the commands as Discord application (slash) commands.
+	// Requires the applications.commands scope when inviting the bot.
+	SlashCommands bool `json:"slashcommands"`
 }
 
 // Config configurations including API clients
 type Config struct {
-	DebugChannelID string `json:"debugchannelid"`
-	Client         struct {
+	DebugChannelID string    `json:"debugchannelid"`
+	Log            LogConfig `json:"log"`
+	// Address to serve Prometheus metrics on. Eg: 127.0.0.1:9100. Disabled if empty.
+	MetricsAddress string `json:"metricsaddress"`
+	// Address to serve the /healthz and /status endpoints on. Eg: 127.0.0.1:9101. Disabled if empty.
+	// May be the same as the metrics address.
+	AdminAddress string `json:"adminaddress"`
+	// Whether to automatically reload the config and commands files when changed
+	WatchFiles bool `json:"watchfiles"`
+	// Timeout, retry and circuit breaker settings by service name (eg: halodex, halorpc). Use "default" for all.
+	HTTP map[string]client.ServiceConfig `json:"http"`
+	// Command rate limits per user, channel and guild. Disabled if not configured.
+	RateLimit RateLimitConfig `json:"ratelimit"`
+	// USD price sources in the order of priority. Valid sources: cmc, coincap, dex. Default: all, in that order.
+	PriceSources []string `json:"pricesources"`
+	Storage      struct {
+		// Storage backend. Valid types: bolt (default), json
+		Type string `json:"type"`
+		// Path to the database file. Default: ./discord.db. Irrelevant for json.
+		Path string `json:"path"`
+	} `json:"storage"`
+	Client struct {
 		BlockCypher struct {
 			Token string `json:"token"`
 		} `json:"blockcypher"`
 		CMC        client.CMC       `json:"cmc"`
+		CoinCap    client.CoinCap   `json:"coincap"`
 		DEX        client.DEX       `json:"halodex"`
 		DiscordBot DiscordBot       `json:"discordbot"`
 		Etherscan  client.Etherscan `json:"etherscan"`
@@ -80,46 +94,92 @@ type DiscordData struct {
 	GuildInfoCommands GuildCommands `json:"guildinfocmds"`
 	Alerts            struct {
 		Payout map[string]string `json:"payout"`
+		// Large trade alerts. Key: channel ID
+		Trades map[string]TradeAlert `json:"trades"`
+		// Price alerts delivered by private message. Key: user ID
+		Price map[string][]PriceAlert `json:"price"`
 	} `json:"alerts"` // key: channel id, value: channel id/username
 	PrivacyExceptions map[string]string `json:"privacyexceptions"` // key: channel id, value: name
 	AddressBook       map[string][]string
+	// Guild specific settings. Key: guild ID
+	Guilds map[string]GuildSettings `json:"guilds"`
+	// User specific settings. Key: user ID
+	Users map[string]UserSettings `json:"users"`
+	// Most recent trades processed by the trade watcher. Key: pair. Eg: HALO/ETH
+	TradeCursors map[string]TradeCursor `json:"tradecursors"`
+}
+
+// GuildSettings stores the preferences of a guild
+type GuildSettings struct {
+	// Command prefix. Uses the configured prefix if empty.
+	Prefix string `json:"prefix,omitempty"`
+	// Language of the replies. Uses the configured language if empty. Overridden by the language of the user.
+	Language string `json:"language,omitempty"`
+	// ID of the channel where privileged actions are sent to. Disabled if empty.
+	AuditChannel string `json:"auditchannel,omitempty"`
+	// Whether to show tickers, tokens, masternodes and payouts as embeds instead of code blocks
+	Embeds bool `json:"embeds,omitempty"`
+	// IDs of the roles granting admin permissions. The ButlerAdmin role is used if empty.
+	AdminRoles []string `json:"adminroles,omitempty"`
+	// Permission required to use commands by command name: everyone, admin, root or a role ID.
+	// Overrides the default permission of the command.
+	Permissions map[string]string `json:"permissions,omitempty"`
+}
+
+// isEmpty checks if all settings are the default
+func (g GuildSettings) isEmpty() bool {
+	return g.Prefix == "" && g.Language == "" && g.AuditChannel == "" && !g.Embeds && len(g.AdminRoles) == 0 &&
+		len(g.Permissions) == 0
+}
+
+// clone returns a copy that does not share the roles and permissions
+func (g GuildSettings) clone() GuildSettings {
+	g.AdminRoles = append([]string{}, g.AdminRoles...)
+	permissions := map[string]string{}
+	for cmdName, required := range g.Permissions {
+		permissions[cmdName] = required
+	}
+	g.Permissions = permissions
+	return g
+}
+
+// UserSettings stores the preferences of a user
+type UserSettings struct {
+	// Language of the replies. Overrides the language of the guild.
+	Language string `json:"language,omitempty"`
+}
+
+// isEmpty checks if all settings are the default
+func (u UserSettings) isEmpty() bool {
+	return u.Language == ""
 }
 
 func main() {
-	setLogFile()
-	logTS("start", "Application started")
 	// Load configuration
-	configStr, err := client.ReadFile(configFile)
-	panicIf(err, "Failed to read config file")
-	err = json.Unmarshal([]byte(configStr), &conf)
+	conf, err := loadConfig()
 	panicIf(err, "Failed to load "+configFile+" file")
+	panicIf(state.SetConfig(conf), "Invalid "+configFile+" file")
+	panicIf(setupLogger(conf.Log), "Failed to open log file")
+	logTS("start", "Application started")
+
+	// Load discord data
+	storage, err := openStorage(conf)
+	panicIf(err, "Failed to open storage")
+	defer storage.Close()
+	state.SetStorage(storage)
+	panicIf(loadData(), "Failed to load Discord data")
 
 	// generate list of commands
-	generateCommandLists()
+	panicIf(generateCommandLists(), "Failed to load "+commandsFile+" file")
 
-	// address keywords
-	addressKeywords = data.AddressKeywords
+	catalogs, err := loadCatalogs(localesDir)
+	panicIf(err, "Failed to load message catalogs from "+localesDir)
+	state.SetCatalogs(catalogs)
 
-	// generate private commands' list
-	for cmdStr, cm := range commands {
-		if !cm.IsPublic {
-			privateCmds[cmdStr] = ""
-		}
-	}
-
-	cmc = conf.Client.CMC
-	if cmc.CacheOnStart {
+	if cmc := state.CMC(); cmc.CacheOnStart {
 		// Force cache CMC tickers
 		cmc.GetTicker("eth")
 	}
-	dex = conf.Client.DEX
-	etherscan = conf.Client.Etherscan
-	explorer = conf.Client.Explorer
-	conf.Client.MNDApp.LastPayout = data.LastPayout
-	mndapp = conf.Client.MNDApp
-	if data.HostingFeeUSD > 0 {
-		mndapp.HostingFeeUSD = data.HostingFeeUSD
-	}
 
 	// Connect to discord as a bot
 	discord, err := discordgo.New("Bot " + conf.Client.DiscordBot.Token)
@@ -128,19 +188,38 @@ func main() {
 	panicIf(err, "error retrieving account")
 
 	botID = bot.ID
+	// message content is required to handle prefix commands
+	discord.Identify.Intents |= discordgo.IntentMessageContent
+	state.SetMemberCache(discord.State)
 	discord.AddHandler(func(discord *discordgo.Session, message *discordgo.MessageCreate) {
-		go commandHandler(discord, message, conf.Client.DiscordBot.Prefix)
+		go commandHandler(discord, message)
+	})
+	discord.AddHandler(func(discord *discordgo.Session, interaction *discordgo.InteractionCreate) {
+		go interactionHandler(discord, interaction.Interaction)
+	})
+	discord.AddHandler(func(discord *discordgo.Session, connect *discordgo.Connect) {
+		state.SetConnected(true)
+	})
+	discord.AddHandler(func(discord *discordgo.Session, disconnect *discordgo.Disconnect) {
+		state.SetConnected(false)
+		logTS("Discord] [Disconnect", "Disconnected from Discord")
 	})
 	discord.AddHandler(func(discord *discordgo.Session, ready *discordgo.Ready) {
-		discordSession = discord
+		state.SetSession(discord)
+		state.SetConnected(true)
+		go func() {
+			logErrorTS("Discord] [Ready", updateApplicationCommands())
+		}()
 		numServers := len(discord.State.Guilds)
 		logTS("Discord] [Ready", fmt.Sprintf("Halo Info Bot has started on %d servers", numServers))
-		if mndapp.CheckPayout {
-			fmt.Println("mndapp.IntervalSeconds", mndapp.IntervalSeconds)
+		if mndapp := state.MNDApp(); mndapp.CheckPayout {
+			logger.Debug("Checking payouts", "tag", "Discord/Ready", "intervalseconds", mndapp.IntervalSeconds)
 			go discordInterval(discord, mndapp.IntervalSeconds, true, checkPayout)
 		}
+		startTradeWatcher(discord)
+		startPriceAlertScheduler(discord)
 
-		err = discord.UpdateStatus(1, fmt.Sprintf("Halo Bulter on %d servers", numServers))
+		err = discord.UpdateGameStatus(1, fmt.Sprintf("Halo Bulter on %d servers", numServers))
 		if logErrorTS("Discord] [Error", err) {
 			return
 		}
@@ -150,6 +229,12 @@ func main() {
 	panicIf(err, "Error opening connection to Discord")
 	defer discord.Close()
 
+	if conf.WatchFiles {
+		go watchFiles(fileWatchInterval)
+	}
+	go logger.runDigest(digestInterval(conf.Log))
+	startHTTPServers(conf)
+
 	// Keep application open infinitely
 	<-make(chan struct{})
 }
@@ -161,69 +246,95 @@ func panicIf(err error, msg string) {
 	}
 }
 
+// logTS logs an info entry with the debug tag. Eg: "cmd] [balance" is logged as tag=cmd/balance
 func logTS(debugTag, str string) {
-	log.Printf("[%s] : %s\n", debugTag, strings.Replace(str, "\n", "\\n", 0))
+	logger.Info(str, "tag", formatDebugTag(debugTag))
 }
 
+// logErrorTS logs an error entry with the debug tag, if err is not nil.
+// Errors are also sent to the debug channel, if configured, with repeated errors batched into periodic digests.
 func logErrorTS(debugTag string, err error) (hasError bool) {
 	if err == nil {
 		return
 	}
-	logTS(debugTag, "[Error] => "+err.Error())
-	if conf.DebugChannelID != "" {
-		discordSend(discordSession, conf.DebugChannelID,
-			fmt.Sprintf("%s [%s] Error: %s", time.Now().UTC(), debugTag, err.Error()), true)
-	}
+	logger.Error(err.Error(), "tag", formatDebugTag(debugTag))
 	return true
 }
 
-func saveDataFile() (err error) {
-	return client.SaveJSONFile(dataFile, data)
+// formatDebugTag converts nested debug tags used in the log prefixes into a path. Eg: "cmd] [balance" => cmd/balance
+func formatDebugTag(debugTag string) string {
+	return strings.Replace(debugTag, "] [", "/", -1)
 }
 
-func generateCommandLists() {
-	// Load defalt commands
-	commandsStr, err := client.ReadFile(commandsFile)
-	panicIf(err, "Failed to read config file")
-	err = json.Unmarshal([]byte(commandsStr), &commands)
-	panicIf(err, "Failed to load "+commandsFile+" file")
+// loadData reads the Discord data from the storage into the state
+func loadData() (err error) {
+	d, err := state.Storage().LoadData()
+	if err != nil {
+		return
+	}
+	state.SetData(d)
+	return
+}
 
-	// Load discord data
-	discordStr, err := client.ReadFile(dataFile)
-	panicIf(err, "Failed to read Discord data file")
-	err = json.Unmarshal([]byte(discordStr), &data)
-	panicIf(err, "Failed to load "+dataFile+" file")
-
-	// Add global info commands. Will override default commands if command name (case-sensitive) matches.
-	for cmdName, cmd := range data.GlobalInfoCommands {
-		commands[cmdName] = cmd
+// loadConfig reads and validates the config file
+func loadConfig() (c *Config, err error) {
+	configStr, err := client.ReadFile(configFile)
+	if err != nil {
+		return
 	}
-	// Construct a list of guild specific commands (if any specified in the data file)
-	// along with default and global info commands (overrides default/global info commands if exact name specified)
-	for gID, gCommands := range data.GuildInfoCommands {
-		guildCommands[gID] = Commands{}
-		for cmdName, cmd := range commands {
-			guildCommands[gID][cmdName] = cmd
-		}
+	c = &Config{}
+	if err = json.Unmarshal([]byte(configStr), c); err != nil {
+		return nil, err
+	}
+	if c.Client.DiscordBot.Token == "" || c.Client.DiscordBot.Prefix == "" {
+		return nil, fmt.Errorf("Discord bot token and prefix required")
+	}
+	if err = validateLogConfig(c.Log); err != nil {
+		return nil, err
+	}
+	return
+}
 
-		for cmdName, cmd := range gCommands {
-			if cmdName != guildCMD {
-				// avoid overriding the !cmd command
+// generateCommandLists replaces the default, guild specific and private command lists using the built-in commands,
+// the text overrides from the commands file and the info commands from the Discord data
+func generateCommandLists() (err error) {
+	// Built-in commands with text overrides from the commands file
+	texts, err := loadCommandTexts(commandsFile)
+	if err != nil {
+		return
+	}
+	commands := builtinCommandList(texts)
+
+	guildCommands := GuildCommands{}
+	state.View(func(data *DiscordData) {
+		// Add global info commands. Will override default commands if command name (case-sensitive) matches.
+		for cmdName, cmd := range data.GlobalInfoCommands {
+			commands[cmdName] = cmd
+		}
+		// Construct a list of guild specific commands (if any specified in the data file)
+		// along with default and global info commands (overrides default/global info commands if exact name specified)
+		for gID, gCommands := range data.GuildInfoCommands {
+			guildCommands[gID] = Commands{}
+			for cmdName, cmd := range commands {
 				guildCommands[gID][cmdName] = cmd
 			}
+
+			for cmdName, cmd := range gCommands {
+				if cmdName != guildCMD {
+					// avoid overriding the !cmd command
+					guildCommands[gID][cmdName] = cmd
+				}
+			}
 		}
-	}
-}
+	})
 
-// setLogFile sets log output file
-func setLogFile() {
-	if _, err := os.Stat(debugFile); os.IsNotExist(err) {
-		_, err = os.Create(debugFile)
-		panicIf(err, "Failed to create debug file "+debugFile)
+	// generate private commands' list
+	privateCmds := map[string]string{}
+	for cmdStr, cm := range commands {
+		if !cm.IsPublic {
+			privateCmds[cmdStr] = ""
+		}
 	}
-	file, err := os.OpenFile(debugFile, os.O_APPEND|os.O_WRONLY, 0666)
-	panicIf(err, "Couldn't open debug file"+debugFile)
-	//defer file.Close()
-	multi := io.MultiWriter(file, os.Stdout)
-	log.SetOutput(multi)
+	state.SetCommands(commands, guildCommands, privateCmds)
+	return
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// Messenger describes the subset of the Discord API used by the command handlers and alert senders.
+// *discordgo.Session satisfies this interface. Use a different implementation (eg: an in-memory fake)
+// to run the command layer without a live Discord connection.
+type Messenger interface {
+	// ChannelMessageSend sends a text message to the specified channel
+	ChannelMessageSend(channelID, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	// ChannelMessageEdit replaces the content of an existing message
+	ChannelMessageEdit(channelID, messageID, content string,
+		options ...discordgo.RequestOption) (*discordgo.Message, error)
+	// ChannelMessageSendComplex sends a message with embeds and/or components
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend,
+		options ...discordgo.RequestOption) (*discordgo.Message, error)
+	// ChannelMessageEditComplex replaces the content, embeds and/or components of an existing message
+	ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	// GuildRoles returns all roles available on a guild
+	GuildRoles(guildID string, options ...discordgo.RequestOption) ([]*discordgo.Role, error)
+	// GuildMember returns a guild member including the IDs of the roles assigned to the member
+	GuildMember(guildID, userID string, options ...discordgo.RequestOption) (*discordgo.Member, error)
+	// UserChannelCreate returns the private message channel with a user, creating it if necessary
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+}
+
+// make sure discordgo.Session always satisfies Messenger
+var _ Messenger = &discordgo.Session{}
+
+// InteractionMessenger is a Messenger that can also respond to interactions such as slash commands
+type InteractionMessenger interface {
+	Messenger
+	// InteractionRespond sends the initial response to an interaction
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse,
+		options ...discordgo.RequestOption) error
+	// FollowupMessageCreate sends a message in response to an interaction
+	FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams,
+		options ...discordgo.RequestOption) (*discordgo.Message, error)
+	// FollowupMessageEdit replaces the content of a message sent using FollowupMessageCreate
+	FollowupMessageEdit(interaction *discordgo.Interaction, messageID string, data *discordgo.WebhookEdit,
+		options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+// applicationCommandRegistrar registers application (slash) commands
+type applicationCommandRegistrar interface {
+	// ApplicationCommandBulkOverwrite replaces all application commands of the guild or global if guild ID is empty
+	ApplicationCommandBulkOverwrite(appID, guildID string, commands []*discordgo.ApplicationCommand,
+		options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error)
+}
+
+var _ InteractionMessenger = &discordgo.Session{}
+var _ applicationCommandRegistrar = &discordgo.Session{}
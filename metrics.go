@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alien45/halo-info-bot/client"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Metrics exposed in the Prometheus text format
+var (
+	metricCommands = newCounterVec(
+		"halobot_commands_total",
+		"Number of commands handled by command name, guild and result",
+		"command", "guild", "result",
+	)
+	metricCommandDuration = newHistogramVec(
+		"halobot_command_duration_seconds",
+		"Duration of command handling in seconds",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		"command",
+	)
+	metricPayoutAlerts = newCounterVec(
+		"halobot_payout_alerts_total",
+		"Number of payout alert messages by action (send/update) and result (success/fail)",
+		"action", "result",
+	)
+	metricTradeAlerts = newCounterVec(
+		"halobot_trade_alerts_total",
+		"Number of large trade alert messages by result (success/fail)",
+		"result",
+	)
+	metrics = &metricsRegistry{
+		metrics: []metric{metricCommands, metricCommandDuration, metricPayoutAlerts, metricTradeAlerts},
+		collectors: []func(w io.Writer){
+			collectUpstreamMetrics,
+			collectCacheMetrics,
+		},
+	}
+)
+
+// metric is a group of samples with the same name
+type metric interface {
+	write(w io.Writer)
+}
+
+// metricsRegistry renders the registered metrics and the metrics collected on demand
+type metricsRegistry struct {
+	metrics    []metric
+	collectors []func(w io.Writer)
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format
+func (r *metricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.write(w)
+}
+
+func (r *metricsRegistry) write(w io.Writer) {
+	for _, m := range r.metrics {
+		m.write(w)
+	}
+	for _, collect := range r.collectors {
+		collect(w)
+	}
+}
+
+// counterVec is a counter partitioned by labels
+type counterVec struct {
+	name       string
+	help       string
+	labelNames []string
+	mutex      sync.Mutex
+	// key: label values joined
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+func newCounterVec(name, help string, labelNames ...string) *counterVec {
+	return &counterVec{name: name, help: help, labelNames: labelNames, values: map[string]*counterValue{}}
+}
+
+// Inc increments the counter of the label values by one
+func (c *counterVec) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add increments the counter of the label values by v
+func (c *counterVec) Add(v float64, labels ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := strings.Join(labels, "\xff")
+	cv, ok := c.values[key]
+	if !ok {
+		cv = &counterValue{labels: labels}
+		c.values[key] = cv
+	}
+	cv.value += v
+}
+
+// Value returns the counter of the label values
+func (c *counterVec) Value(labels ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if cv, ok := c.values[strings.Join(labels, "\xff")]; ok {
+		return cv.value
+	}
+	return 0
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	writeMetricHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		cv := c.values[key]
+		writeSample(w, c.name, c.labelNames, cv.labels, cv.value)
+	}
+}
+
+// histogramVec is a histogram partitioned by labels
+type histogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+	mutex      sync.Mutex
+	values     map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	// cumulative counts by bucket
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labelNames ...string) *histogramVec {
+	return &histogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    buckets,
+		values:     map[string]*histogramValue{},
+	}
+}
+
+// Observe adds an observation for the label values
+func (h *histogramVec) Observe(v float64, labels ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	key := strings.Join(labels, "\xff")
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{labels: labels, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	for i, upperBound := range h.buckets {
+		if v <= upperBound {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	writeMetricHeader(w, h.name, h.help, "histogram")
+	labelNames := append(append([]string{}, h.labelNames...), "le")
+	for _, key := range sortedKeys(h.values) {
+		hv := h.values[key]
+		for i, upperBound := range h.buckets {
+			labels := append(append([]string{}, hv.labels...), fmt.Sprint(upperBound))
+			writeSample(w, h.name+"_bucket", labelNames, labels, float64(hv.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", labelNames, append(append([]string{}, hv.labels...), "+Inf"),
+			float64(hv.count))
+		writeSample(w, h.name+"_sum", h.labelNames, hv.labels, hv.sum)
+		writeSample(w, h.name+"_count", h.labelNames, hv.labels, float64(hv.count))
+	}
+}
+
+// collectUpstreamMetrics writes the request counters of the API clients
+func collectUpstreamMetrics(w io.Writer) {
+	stats := client.HTTP.Stats()
+	upstreams := []string{}
+	for name := range stats {
+		upstreams = append(upstreams, name)
+	}
+	sort.Strings(upstreams)
+	labelNames := []string{"upstream"}
+	writeStats := func(name, help, metricType string, value func(s client.ServiceStats) float64) {
+		writeMetricHeader(w, name, help, metricType)
+		for _, upstream := range upstreams {
+			writeSample(w, name, labelNames, []string{upstream}, value(stats[upstream]))
+		}
+	}
+	writeStats("halobot_upstream_requests_total", "Number of requests sent to upstream APIs, including retries",
+		"counter", func(s client.ServiceStats) float64 { return float64(s.Requests) })
+	writeStats("halobot_upstream_errors_total", "Number of failed requests to upstream APIs",
+		"counter", func(s client.ServiceStats) float64 { return float64(s.Errors) })
+	writeStats("halobot_upstream_retries_total", "Number of retried requests to upstream APIs",
+		"counter", func(s client.ServiceStats) float64 { return float64(s.Retries) })
+	writeStats("halobot_upstream_rejected_total", "Number of requests rejected due to open circuit breaker",
+		"counter", func(s client.ServiceStats) float64 { return float64(s.Rejected) })
+	writeStats("halobot_upstream_latency_seconds_total", "Total duration of requests to upstream APIs in seconds",
+		"counter", func(s client.ServiceStats) float64 { return s.TotalLatency.Seconds() })
+	writeStats("halobot_upstream_circuit_open", "Whether requests to upstream APIs are being rejected (1) or not (0)",
+		"gauge", func(s client.ServiceStats) float64 {
+			if s.CircuitOpen {
+				return 1
+			}
+			return 0
+		})
+
+	if c := state.Config(); c != nil {
+		writeMetricHeader(w, "halobot_cmc_credits_used", "CoinMarketCap API credits used today", "gauge")
+		writeSample(w, "halobot_cmc_credits_used", nil, nil, float64(state.CMC().CreditsUsed()))
+	}
+}
+
+// collectCacheMetrics writes the cache hit and miss counters of the API clients
+func collectCacheMetrics(w io.Writer) {
+	stats := client.CacheStats()
+	caches := []string{}
+	for name := range stats {
+		caches = append(caches, name)
+	}
+	sort.Strings(caches)
+	writeMetricHeader(w, "halobot_cache_requests_total", "Number of cache lookups by cache and result (hit/miss)",
+		"counter")
+	labelNames := []string{"cache", "result"}
+	for _, name := range caches {
+		writeSample(w, "halobot_cache_requests_total", labelNames, []string{name, "hit"}, float64(stats[name].Hits))
+		writeSample(w, "halobot_cache_requests_total", labelNames, []string{name, "miss"}, float64(stats[name].Misses))
+	}
+}
+
+// commandRecorder records whether a command failed. Use as the Messenger of the command handlers.
+type commandRecorder struct {
+	Messenger
+	mutex  sync.Mutex
+	failed bool
+}
+
+// ChannelMessageSend sends a message and records failure
+func (r *commandRecorder) ChannelMessageSend(channelID, content string,
+	options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	msg, err := r.Messenger.ChannelMessageSend(channelID, content, options...)
+	if err != nil {
+		r.setFailed()
+	}
+	return msg, err
+}
+
+// ChannelMessageSendComplex sends a message with embeds and/or components and records failure
+func (r *commandRecorder) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend,
+	options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	msg, err := r.Messenger.ChannelMessageSendComplex(channelID, data, options...)
+	if err != nil {
+		r.setFailed()
+	}
+	return msg, err
+}
+
+func (r *commandRecorder) setFailed() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failed = true
+}
+
+// result returns the command result label
+func (r *commandRecorder) result() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.failed {
+		return "error"
+	}
+	return "ok"
+}
+
+// observeCommand records the command metrics including the duration of the command handler
+func observeCommand(cmdName, guildID, result string, start time.Time) {
+	countCommand(cmdName, guildID, result)
+	metricCommandDuration.Observe(time.Since(start).Seconds(), cmdName)
+}
+
+// countCommand counts the command by result. Used without observeCommand if the command handler did not run, eg:
+// denied, invalid or rate limited commands, so that the duration histogram only contains the durations of the handlers.
+func countCommand(cmdName, guildID, result string) {
+	if guildID == "" {
+		guildID = "private"
+	}
+	metricCommands.Inc(cmdName, guildID, result)
+}
+
+func writeMetricHeader(w io.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writeSample(w io.Writer, name string, labelNames, labels []string, value float64) {
+	pairs := []string{}
+	for i, labelName := range labelNames {
+		v := ""
+		if i < len(labels) {
+			v = labels[i]
+		}
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labelName, escapeLabelValue(v)))
+	}
+	if len(pairs) > 0 {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(w, "%s %v\n", name, value)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func sortedKeys(m interface{}) (keys []string) {
+	switch v := m.(type) {
+	case map[string]*counterValue:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]*histogramValue:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return
+}
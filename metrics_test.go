@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	fake := setupCommandTest(t)
+	// metrics are shared by all tests
+	metricCommands.values = map[string]*counterValue{}
+	metricCommandDuration.values = map[string]*histogramValue{}
+	metricPayoutAlerts.values = map[string]*counterValue{}
+	send(fake, testGuildID, testChannelID, "alice", "!help")
+	send(fake, testGuildID, testChannelID, "alice", "!address")
+	fake.FailChannels[testChannelID] = true
+	send(fake, testGuildID, testChannelID, "alice", "!help")
+	sendPayoutAlerts(fake, state.LastPayout(), map[string]string{testChannelID: "", "channel-2": ""})
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		`halobot_commands_total{command="help",guild="guild-1",result="ok"} 1`,
+		`halobot_commands_total{command="help",guild="guild-1",result="error"} 1`,
+		`halobot_commands_total{command="address",guild="guild-1",result="denied"} 1`,
+		`halobot_command_duration_seconds_bucket{command="help",le="+Inf"} 2`,
+		`halobot_command_duration_seconds_count{command="help"} 2`,
+		`halobot_payout_alerts_total{action="send",result="success"} 1`,
+		`halobot_payout_alerts_total{action="send",result="fail"} 1`,
+		"# TYPE halobot_upstream_requests_total counter",
+		"halobot_cmc_credits_used 0",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("metric not found: %s", expected)
+		}
+	}
+	// denied commands are counted without a duration sample
+	if strings.Contains(body, `halobot_command_duration_seconds_count{command="address"}`) {
+		t.Error("duration of a denied command observed")
+	}
+}
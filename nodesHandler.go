@@ -2,51 +2,28 @@ package main
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/alien45/halo-info-bot/client"
-	"github.com/bwmarrin/discordgo"
 )
 
-func cmdNodes(discord *discordgo.Session, channelID, debugTag string, cmdArgs, userAddresses []string, numArgs, numAddresses int) {
+func cmdNodes(discord Messenger, guildID, channelID, lang, debugTag string, args commandArgs, userAddresses []string) {
 	addrs := map[string]int{}
 	nodes := []client.Masternode{}
 	txt := ""
 	summary := ""
-	action := "table"
-	if numArgs > 0 {
-		action = strings.ToLower(cmdArgs[0])
-		switch action {
-		case "full": //"summary"
-			// Remove arg so only addresses remain
-			cmdArgs = cmdArgs[1:]
-			numArgs = len(cmdArgs)
-			break
-		default:
-			action = "table"
-		}
-	}
-	addresses := cmdArgs
-
-	if numArgs == 0 {
+	action := args.String("mode", "table")
+	mndapp := state.MNDApp()
+	// address book item numbers are resolved by the argument parser
+	addresses := args.List("address")
+	if len(addresses) == 0 {
 		// No address supplied
-		if numAddresses == 0 {
+		if len(userAddresses) == 0 {
 			// User has no saved addresses
-			txt = "Owner address required"
+			txt = tr(lang, "Owner address required")
 			goto SendMessage
 		}
 		addresses = userAddresses
-	} else {
-		for i, addr := range addresses {
-			// Check if address book index supplied
-			itemNum, err := strconv.Atoi(addr)
-			if err != nil || itemNum <= 0 || itemNum > numAddresses {
-				continue
-			}
-			// replace index with address
-			addresses[i] = userAddresses[itemNum-1]
-		}
 	}
 	for i := 0; i < len(addresses); i++ {
 		address := strings.ToUpper(addresses[i])
@@ -56,18 +33,30 @@ func cmdNodes(discord *discordgo.Session, channelID, debugTag string, cmdArgs, u
 		}
 		addrs[address] = 0
 		iNodes, err := mndapp.GetMasternodes(addresses[i])
-		if commandErrorIf(err, discord, channelID, "Failed to retrieve masternodes for "+addresses[i], debugTag) {
+		if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve masternodes for %s", addresses[i]), debugTag) {
 			return
 		}
 		nodes = append(nodes, iNodes...)
 	}
-	txt, summary = mndapp.FormatNodes(nodes)
-	if action == "full" {
-		txt = ""
-		for i := 0; i < len(nodes); i++ {
-			_, err := discordSend(discord, channelID, "js\n"+nodes[i].Format(), true)
-			logErrorTS(debugTag, err)
+	txt, summary = mndapp.FormatNodes(localizer(lang), nodes)
+	if len(nodes) > 0 {
+		// list one node per page in full mode and multiple nodes per page otherwise
+		pages := []page{}
+		if action == "full" {
+			for i := 0; i < len(nodes); i++ {
+				p := page{Text: "js\n" + nodes[i].Format(localizer(lang))}
+				if useEmbeds(guildID) {
+					p.Embed = masternodeEmbed(lang, nodes[i])
+				}
+				pages = append(pages, p)
+			}
+		} else {
+			header, rows := tableRows("diff\n" + txt)
+			pages = textPages(header, rows, rowsPerPage, "")
 		}
+		txt = ""
+		err := sendPages(discord, channelID, lang, 1, len(pages), staticPages(pages))
+		logErrorTS(debugTag, err)
 	}
 SendMessage:
 	if txt != "" {
@@ -80,54 +69,48 @@ SendMessage:
 	}
 }
 
-func cmdMN(discord *discordgo.Session, channelID, debugTag string, cmdArgs []string, numArgs int) {
-	m := mndapp
+func cmdMN(discord Messenger, channelID, lang, debugTag string, args commandArgs) {
+	m := state.MNDApp()
+	lastPayout := state.LastPayout()
 	var txt string
 	var err error
-	arg0 := strings.ToLower(strings.Join(cmdArgs, "-"))
-	switch arg0 {
+	switch args.String("topic", "payout") {
 	case "collateral":
-		txt = fmt.Sprintf(""+
-			"Tier 1: %s\n"+client.DashLine+
-			"Tier 2: %s\n"+client.DashLine+
-			"Tier 3: %s\n"+client.DashLine+
-			"Tier 4: %s",
-			client.FormatNumShort(m.Collateral["t1"], 0),
-			client.FormatNumShort(m.Collateral["t2"], 0),
-			client.FormatNumShort(m.Collateral["t3"], 0),
-			client.FormatNumShort(m.Collateral["t4"], 0),
-		)
+		for i := 1; i <= 4; i++ {
+			if i > 1 {
+				txt += "\n" + client.DashLine
+			}
+			txt += tr(lang, "Tier %d: %s", i, formatNumberShort(lang, m.Collateral[fmt.Sprintf("t%d", i)], 0))
+		}
 		break
-	case "nodes", "tier-distribution":
+	case "nodes":
 		t1, t2, t3, t4, err := m.GetAllTierDistribution()
 		if logErrorTS(debugTag, err) {
-			txt = fmt.Sprintf("Failed to retrieve tier distribution. Error: %v", err)
+			txt = tr(lang, "Failed to retrieve tier distribution")
 			break
 		}
-		txt = fmt.Sprintf(""+
-			"Tier 1: %.0f\n"+
-			"Tier 2: %.0f\n"+
-			"Tier 3: %.0f\n"+
-			"Tier 4: %.0f",
-			t1, t2, t3, t4,
-		)
+		for i, n := range []float64{t1, t2, t3, t4} {
+			if i > 0 {
+				txt += "\n"
+			}
+			txt += tr(lang, "Tier %d: %s", i+1, formatNumber(lang, n, 0))
+		}
 		break
-	case "payout", "last-payout":
-		fallthrough
-	default:
-		txt = "________________/ Last Payout \\_____________\n"
-		txt += m.LastPayout.Format()
-		txt += "\n___________________/ ROI \\__________________\n"
-		txt += m.LastPayout.FormatROI(m.BlockReward, m.BlockTimeMins, m.Collateral)
+	case "payout":
+		txt = "________________/ " + tr(lang, "Last Payout") + " \\_____________\n"
+		txt += lastPayout.Format(localizer(lang))
+		txt += "\n___________________/ " + tr(lang, "ROI") + " \\__________________\n"
+		txt += lastPayout.FormatROI(localizer(lang), m.BlockReward, m.BlockTimeMins, m.Collateral)
 		break
-	case "pool", "reward-pool":
-		txt, err = m.GetFormattedPoolData()
+	case "pool":
+		txt, err = m.GetFormattedPoolData(localizer(lang))
 		if err != nil {
-			txt = fmt.Sprintf("Failed to retrive pool data. Error: %v", err)
+			logErrorTS(debugTag, err)
+			txt = tr(lang, "Failed to retrieve pool data")
 		}
 		break
 	case "roi":
-		txt = m.LastPayout.FormatROI(m.BlockReward, m.BlockTimeMins, m.Collateral)
+		txt = lastPayout.FormatROI(localizer(lang), m.BlockReward, m.BlockTimeMins, m.Collateral)
 		break
 	}
 	_, err = discordSend(discord, channelID, "js\n"+txt, true)
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alien45/halo-info-bot/client"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// duration of inactivity after which the page controls are removed
+	paginationTimeout = 5 * time.Minute
+	// maximum length of the text of a page, leaving room for the code block and page number
+	maxPageLength = 1900
+	// number of rows per page of lists
+	rowsPerPage = 15
+	// custom IDs of the page control buttons
+	pagePrevID = "page:prev"
+	pageNextID = "page:next"
+)
+
+// page is the content of a page: text, sent as a code block, or an embed.
+// Text may start with the language of the code block. Eg: "js\n".
+type page struct {
+	Text  string
+	Embed *discordgo.MessageEmbed
+}
+
+// pageLoader returns a page by page number starting at 1 and whether there are more pages
+type pageLoader func(pageNo int) (p page, hasNext bool, err error)
+
+// paginator is a message that shows a page at a time and is edited in place using the next and previous buttons
+type paginator struct {
+	discord   Messenger
+	channelID string
+	messageID string
+	// language of the page number and controls
+	lang string
+	load pageLoader
+	// total number of pages. Zero if unknown.
+	total   int
+	pageNo  int
+	current page
+	hasNext bool
+	timer   *time.Timer
+	mutex   sync.Mutex
+}
+
+var (
+	// active paginators. Key: message ID
+	paginators      = map[string]*paginator{}
+	paginatorsMutex sync.Mutex
+)
+
+// sendPages sends the first page along with the page controls. Sends without controls if there is only one page.
+// Total is the number of pages, zero if unknown.
+func sendPages(discord Messenger, channelID, lang string, pageNo, total int, load pageLoader) error {
+	p, hasNext, err := load(pageNo)
+	if err != nil {
+		return err
+	}
+	if pageNo == 1 && !hasNext {
+		if p.Embed != nil {
+			_, err = discord.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+				Embeds: []*discordgo.MessageEmbed{p.Embed},
+			})
+			return err
+		}
+		_, err = discordSend(discord, channelID, p.Text, true)
+		return err
+	}
+	pg := &paginator{
+		discord:   discord,
+		channelID: channelID,
+		lang:      lang,
+		load:      load,
+		total:     total,
+		pageNo:    pageNo,
+		current:   p,
+		hasNext:   hasNext,
+	}
+	msg, err := discord.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:    pg.content(),
+		Embeds:     pg.embeds(),
+		Components: pg.components(),
+	})
+	if err != nil {
+		return err
+	}
+	pg.messageID = msg.ID
+	paginatorsMutex.Lock()
+	paginators[msg.ID] = pg
+	paginatorsMutex.Unlock()
+	pg.timer = time.AfterFunc(paginationTimeout, pg.expire)
+	return nil
+}
+
+// staticPages returns a loader of pre-generated pages
+func staticPages(pages []page) pageLoader {
+	return func(pageNo int) (page, bool, error) {
+		if pageNo < 1 || pageNo > len(pages) {
+			return page{}, false, fmt.Errorf("Invalid page number: %d", pageNo)
+		}
+		return pages[pageNo-1], pageNo < len(pages), nil
+	}
+}
+
+// textPages splits rows into pages of up to perPage rows. Header and footer are included in every page.
+// Rows may span multiple lines and must end with a line break. Pages are also split to fit the message size limit.
+// Rows that do not fit a page on their own are split into multiple rows.
+func textPages(header string, rows []string, perPage int, footer string) (pages []page) {
+	text, count := "", 0
+	for _, row := range rows {
+		for _, row := range splitRow(row, maxPageLength-len(header+footer)-1) {
+			if count > 0 && (count == perPage || len(header+text+row+footer) >= maxPageLength) {
+				pages = append(pages, page{Text: header + text + footer})
+				text, count = "", 0
+			}
+			text += row
+			count++
+		}
+	}
+	if count > 0 || len(pages) == 0 {
+		pages = append(pages, page{Text: header + text + footer})
+	}
+	return
+}
+
+// splitRow splits a row into rows of up to limit bytes. Rows are split at line breaks, if possible, otherwise lines
+// are split at the last character that fits and a line break is added.
+func splitRow(row string, limit int) (rows []string) {
+	if limit < 2 {
+		return []string{row}
+	}
+	for len(row) > limit {
+		i := strings.LastIndex(row[:limit], "\n") + 1
+		if i > 0 {
+			rows = append(rows, row[:i])
+			row = row[i:]
+			continue
+		}
+		i = limit - 1
+		for i > 0 && !utf8.RuneStart(row[i]) {
+			i--
+		}
+		rows = append(rows, row[:i]+"\n")
+		row = row[i:]
+	}
+	return append(rows, row)
+}
+
+// tableRows splits a table formatted with dash lines between the rows. Eg: client.DEX.GetFormattedTokens.
+func tableRows(table string) (header string, rows []string) {
+	rows = strings.SplitAfter(table, client.DashLine)
+	if rows[len(rows)-1] == "" {
+		rows = rows[:len(rows)-1]
+	}
+	return rows[0], rows[1:]
+}
+
+// content returns the message content of the current page: the text as a code block and the page number
+func (pg *paginator) content() string {
+	s := ""
+	if pg.current.Embed == nil {
+		s = "```" + pg.current.Text + "```"
+	}
+	if pg.total > 0 {
+		return s + tr(pg.lang, "Page %d of %d", pg.pageNo, pg.total)
+	}
+	return s + tr(pg.lang, "Page %d", pg.pageNo)
+}
+
+func (pg *paginator) embeds() []*discordgo.MessageEmbed {
+	if pg.current.Embed == nil {
+		return []*discordgo.MessageEmbed{}
+	}
+	return []*discordgo.MessageEmbed{pg.current.Embed}
+}
+
+func (pg *paginator) components() []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    tr(pg.lang, "Prev"),
+					Emoji:    discordgo.ComponentEmoji{Name: "◀️"},
+					Style:    discordgo.SecondaryButton,
+					CustomID: pagePrevID,
+					Disabled: pg.pageNo <= 1,
+				},
+				discordgo.Button{
+					Label:    tr(pg.lang, "Next"),
+					Emoji:    discordgo.ComponentEmoji{Name: "▶️"},
+					Style:    discordgo.SecondaryButton,
+					CustomID: pageNextID,
+					Disabled: !pg.hasNext,
+				},
+			},
+		},
+	}
+}
+
+// turn loads the next or previous page. Restarts the expiry timer.
+// Data is the current page if the page failed to load.
+func (pg *paginator) turn(customID string) (data *discordgo.InteractionResponseData, err error) {
+	pg.mutex.Lock()
+	defer pg.mutex.Unlock()
+	pageNo := pg.pageNo
+	switch customID {
+	case pagePrevID:
+		pageNo--
+		break
+	case pageNextID:
+		pageNo++
+		break
+	}
+	if pageNo < 1 {
+		pageNo = 1
+	}
+	p, hasNext, err := pg.load(pageNo)
+	if err != nil {
+		// stay on the current page, eg: no trades on the next page. Next is disabled if the next page failed to load.
+		pageNo, p, hasNext = pg.pageNo, pg.current, pg.hasNext && customID != pageNextID
+	}
+	pg.pageNo, pg.current, pg.hasNext = pageNo, p, hasNext
+	if pg.timer != nil {
+		pg.timer.Reset(paginationTimeout)
+	}
+	data = &discordgo.InteractionResponseData{
+		Content:    pg.content(),
+		Embeds:     pg.embeds(),
+		Components: pg.components(),
+	}
+	return
+}
+
+// expire removes the page controls and stops handling them
+func (pg *paginator) expire() {
+	paginatorsMutex.Lock()
+	delete(paginators, pg.messageID)
+	paginatorsMutex.Unlock()
+	pg.mutex.Lock()
+	if pg.timer != nil {
+		pg.timer.Stop()
+	}
+	content := pg.content()
+	edit := &discordgo.MessageEdit{
+		ID:         pg.messageID,
+		Channel:    pg.channelID,
+		Content:    &content,
+		Embeds:     pg.embeds(),
+		Components: []discordgo.MessageComponent{},
+	}
+	pg.mutex.Unlock()
+	_, err := pg.discord.ChannelMessageEditComplex(edit)
+	logErrorTS("paginator", err)
+}
+
+// paginationHandler handles the page control buttons. Removes the controls if the pages have expired.
+func paginationHandler(discord InteractionMessenger, interaction *discordgo.Interaction) {
+	customID := interaction.MessageComponentData().CustomID
+	if !strings.HasPrefix(customID, "page:") || interaction.Message == nil {
+		return
+	}
+	paginatorsMutex.Lock()
+	pg := paginators[interaction.Message.ID]
+	paginatorsMutex.Unlock()
+	data := &discordgo.InteractionResponseData{
+		Content:    interaction.Message.Content,
+		Embeds:     interaction.Message.Embeds,
+		Components: []discordgo.MessageComponent{},
+	}
+	if pg != nil {
+		turned, err := pg.turn(customID)
+		logErrorTS("paginator", err)
+		data = turned
+	}
+	err := discord.InteractionRespond(interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: data,
+	})
+	logErrorTS("paginator", err)
+}
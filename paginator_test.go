@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alien45/halo-info-bot/client"
+	"github.com/bwmarrin/discordgo"
+)
+
+// newComponentInteraction constructs a button click on a message as received from Discord
+func newComponentInteraction(msg *discordgo.Message, username, customID string) *discordgo.Interaction {
+	interaction := newInteraction(testGuildID, msg.ChannelID, username, discordgo.InteractionMessageComponent, "")
+	interaction.Message = msg
+	interaction.Data = discordgo.MessageComponentInteractionData{CustomID: customID}
+	return interaction
+}
+
+func TestTextPages(t *testing.T) {
+	rows := []string{"a\n", "b\n", "c\n"}
+	pages := textPages("css\n", rows, 2, "legend")
+	if len(pages) != 2 || pages[0].Text != "css\na\nb\nlegend" || pages[1].Text != "css\nc\nlegend" {
+		t.Fatalf("unexpected pages: %+v", pages)
+	}
+	// pages must fit the message size limit
+	pages = textPages("", []string{strings.Repeat("a", 1000) + "\n", strings.Repeat("b", 1000) + "\n"}, 10, "")
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages, got %d", len(pages))
+	}
+	// rows longer than a page are split at line breaks, then within lines
+	pages = textPages("js\n", []string{"a\n" + strings.Repeat("é", 2000) + "\n"}, 10, "")
+	if len(pages) != 4 || pages[0].Text != "js\na\n" {
+		t.Fatalf("expected 4 pages, got %d", len(pages))
+	}
+	for _, p := range pages {
+		if len(p.Text) >= maxPageLength || !utf8.ValidString(p.Text) || !strings.HasSuffix(p.Text, "\n") {
+			t.Fatalf("invalid page of %d bytes", len(p.Text))
+		}
+	}
+}
+
+func TestPageLoadError(t *testing.T) {
+	fake := newFakeMessenger()
+	err := sendPages(fake, testChannelID, "en", 1, 0, func(pageNo int) (page, bool, error) {
+		if pageNo > 1 {
+			return page{}, false, fmt.Errorf("No more pages")
+		}
+		return page{Text: "first"}, true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := fake.Sent[len(fake.Sent)-1]
+	defer func() {
+		paginatorsMutex.Lock()
+		paginators[msg.ID].timer.Stop()
+		delete(paginators, msg.ID)
+		paginatorsMutex.Unlock()
+	}()
+
+	// the interaction is answered with the current page and the next button disabled
+	interactionHandler(fake, newComponentInteraction(msg, "bob", pageNextID))
+	if len(fake.Responses) != 1 {
+		t.Fatalf("interaction not answered")
+	}
+	resp := fake.Responses[0]
+	if resp.Data.Content != "```first```Page 1" {
+		t.Fatalf("unexpected page: %q", resp.Data.Content)
+	}
+	if buttons := resp.Data.Components[0].(discordgo.ActionsRow).Components; !buttons[1].(discordgo.Button).Disabled {
+		t.Fatalf("next button not disabled: %+v", buttons)
+	}
+}
+
+func TestTokenPages(t *testing.T) {
+	fake := setupCommandTest(t)
+	dex := state.DEX()
+	dex.CachedTokens = map[string]client.Token{}
+	for i := 0; i < rowsPerPage+5; i++ {
+		ticker := fmt.Sprintf("T%02d", i)
+		dex.CachedTokens[ticker] = client.Token{Name: "Token " + ticker, Ticker: ticker}
+	}
+	dex.CachedTokenLastUpdated = time.Now()
+	dex.CachedTokenExpireMins = 10
+
+	send(fake, testGuildID, testChannelID, "alice", "!tokens")
+	msg := fake.Sent[len(fake.Sent)-1]
+	if !strings.Contains(msg.Content, "T00") || strings.Contains(msg.Content, "T19") ||
+		!strings.HasSuffix(msg.Content, "Page 1 of 2") || len(msg.Components) != 1 {
+		t.Fatalf("unexpected first page: %+v", msg)
+	}
+
+	interactionHandler(fake, newComponentInteraction(msg, "bob", pageNextID))
+	resp := fake.Responses[len(fake.Responses)-1]
+	if resp.Type != discordgo.InteractionResponseUpdateMessage || !strings.Contains(resp.Data.Content, "T19") ||
+		!strings.HasPrefix(resp.Data.Content, "```js\nName") || !strings.HasSuffix(resp.Data.Content, "Page 2 of 2") {
+		t.Fatalf("unexpected second page: %+v", resp.Data)
+	}
+	buttons := resp.Data.Components[0].(discordgo.ActionsRow).Components
+	if buttons[0].(discordgo.Button).Disabled || !buttons[1].(discordgo.Button).Disabled {
+		t.Fatalf("unexpected buttons: %+v", buttons)
+	}
+
+	// controls are removed once expired
+	paginatorsMutex.Lock()
+	pg := paginators[msg.ID]
+	paginatorsMutex.Unlock()
+	pg.expire()
+	edited := fake.Edited[len(fake.Edited)-1]
+	if edited.ID != msg.ID || len(edited.Components) != 0 || !strings.Contains(edited.Content, "T19") {
+		t.Fatalf("unexpected expired message: %+v", edited)
+	}
+	msg.Content = edited.Content
+	interactionHandler(fake, newComponentInteraction(msg, "bob", pagePrevID))
+	resp = fake.Responses[len(fake.Responses)-1]
+	if resp.Data.Content != edited.Content || len(resp.Data.Components) != 0 {
+		t.Fatalf("unexpected response to expired pages: %+v", resp.Data)
+	}
+
+	// single page lists are sent without controls
+	dex.CachedTokens = map[string]client.Token{"HALO": {Name: "Halo Platform", Ticker: "HALO"}}
+	send(fake, testGuildID, testChannelID, "alice", "!tokens")
+	msg = fake.Sent[len(fake.Sent)-1]
+	if !strings.Contains(msg.Content, "HALO") || len(msg.Components) != 0 {
+		t.Fatalf("unexpected single page: %+v", msg)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Permission levels required to use a command. A Discord role ID may be used instead to allow the members of the
+// role along with the admins.
+const (
+	permEveryone = "everyone"
+	permAdmin    = "admin"
+	permRoot     = "root"
+)
+
+// guildAdminRole is the name of the role granting admin permissions in guilds without admin roles configured.
+// Case-insensitive.
+const guildAdminRole = "butleradmin"
+
+// roleMentionRegex matches a role mention or a role ID. Eg: <@&123456789012345678>
+var roleMentionRegex = regexp.MustCompile(`^(?:<@&)?(\d{5,20})>?$`)
+
+// memberCache looks up guild members and roles without REST requests. *discordgo.State satisfies this interface.
+type memberCache interface {
+	Guild(guildID string) (*discordgo.Guild, error)
+	Member(guildID, userID string) (*discordgo.Member, error)
+	MemberAdd(member *discordgo.Member) error
+}
+
+var _ memberCache = &discordgo.State{}
+
+// isRootUser checks if the user is a root user by ID or, for existing configs, by username#discriminator
+func isRootUser(user *discordgo.User) bool {
+	if user == nil {
+		return false
+	}
+	bot := state.Config().Client.DiscordBot
+	for _, id := range bot.RootUsers {
+		if id == user.ID {
+			return true
+		}
+	}
+	return bot.RootUser != "" && fmt.Sprint(user) == bot.RootUser
+}
+
+// guildRoles returns the roles of a guild from the state cache or using a REST request if not cached
+func guildRoles(discord Messenger, guildID string) ([]*discordgo.Role, error) {
+	if cache := state.MemberCache(); cache != nil {
+		if guild, err := cache.Guild(guildID); err == nil && len(guild.Roles) > 0 {
+			return guild.Roles, nil
+		}
+	}
+	return discord.GuildRoles(guildID)
+}
+
+// memberRoles returns the role IDs of the author of the message. Uses the member included in the message, if
+// available, or the state cache. Members not cached are retrieved using a REST request and added to the cache.
+func memberRoles(discord Messenger, message *discordgo.MessageCreate) []string {
+	if message.Member != nil && message.Member.Roles != nil {
+		return message.Member.Roles
+	}
+	cache := state.MemberCache()
+	if cache != nil {
+		if member, err := cache.Member(message.GuildID, message.Author.ID); err == nil {
+			return member.Roles
+		}
+	}
+	member, err := discord.GuildMember(message.GuildID, message.Author.ID)
+	if logErrorTS("permissions", err) {
+		return nil
+	}
+	if cache != nil {
+		member.GuildID = message.GuildID
+		// fails if the guild is not cached
+		cache.MemberAdd(member)
+	}
+	return member.Roles
+}
+
+// adminRoles returns the IDs of the roles granting admin permissions in a guild
+func adminRoles(discord Messenger, guildID string) []string {
+	if roleIDs := state.GuildSettings(guildID).AdminRoles; len(roleIDs) > 0 {
+		return roleIDs
+	}
+	roles, err := guildRoles(discord, guildID)
+	if logErrorTS("permissions", err) {
+		return nil
+	}
+	for _, role := range roles {
+		if strings.ToLower(role.Name) == guildAdminRole {
+			return []string{role.ID}
+		}
+	}
+	return nil
+}
+
+// hasAnyRole checks if the author of the message has any of the roles
+func hasAnyRole(discord Messenger, message *discordgo.MessageCreate, roleIDs []string) bool {
+	if len(roleIDs) == 0 {
+		return false
+	}
+	for _, memberRoleID := range memberRoles(discord, message) {
+		for _, roleID := range roleIDs {
+			if memberRoleID == roleID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isGuildAdmin checks if the author of the message is a guild admin or a root user
+func isGuildAdmin(discord Messenger, message *discordgo.MessageCreate) bool {
+	if isRootUser(message.Author) {
+		return true
+	}
+	return message.GuildID != "" && hasAnyRole(discord, message, adminRoles(discord, message.GuildID))
+}
+
+// commandPermission returns the permission required to use a command in a guild.
+// Uses the override of the guild, if any, or the default of the command.
+func commandPermission(guildID, cmdName string, command Command) string {
+	if required := state.GuildSettings(guildID).Permissions[cmdName]; required != "" && guildID != "" {
+		return required
+	}
+	if command.IsAdminOnly {
+		return permAdmin
+	}
+	return permEveryone
+}
+
+// hasPermission checks if the author of the message has the required permission level or role.
+// Role permissions are irrelevant for private messages. Admin-only commands are allowed for root users only in
+// private messages, as there are no guild admins.
+func hasPermission(discord Messenger, message *discordgo.MessageCreate, required string) bool {
+	switch {
+	case required == permEveryone || isRootUser(message.Author):
+		return true
+	case required == permRoot:
+		return false
+	case message.GuildID == "":
+		return required != permAdmin
+	case isGuildAdmin(discord, message):
+		return true
+	case required == permAdmin:
+		return false
+	}
+	return hasAnyRole(discord, message, []string{required})
+}
+
+// parsePermission validates a permission level or resolves a role mention, ID or name to the role ID
+func parsePermission(discord Messenger, guildID, lang, text string) (string, error) {
+	switch strings.ToLower(text) {
+	case permEveryone, permAdmin, permRoot:
+		return strings.ToLower(text), nil
+	}
+	return parseRole(discord, guildID, lang, text)
+}
+
+// parseRole resolves a role mention, ID or name to the role ID
+func parseRole(discord Messenger, guildID, lang, text string) (string, error) {
+	roles, err := guildRoles(discord, guildID)
+	if err != nil {
+		return "", err
+	}
+	roleID := ""
+	if m := roleMentionRegex.FindStringSubmatch(text); m != nil {
+		roleID = m[1]
+	}
+	for _, role := range roles {
+		if role.ID == roleID || strings.EqualFold(role.Name, strings.TrimPrefix(text, "@")) {
+			return role.ID, nil
+		}
+	}
+	return "", errors.New(tr(lang, "Role not found: %s", text))
+}
+
+// formatPermission returns the name of the permission level or role
+func formatPermission(lang string, roles []*discordgo.Role, required string) string {
+	switch required {
+	case permEveryone, permAdmin, permRoot:
+		return required
+	}
+	for _, role := range roles {
+		if role.ID == required {
+			return "@" + role.Name
+		}
+	}
+	return tr(lang, "role %s", required)
+}
+
+// cmdPerms shows and changes the admin roles and the permissions required to use the commands in the guild
+func cmdPerms(discord Messenger, message *discordgo.MessageCreate, lang, debugTag string, args commandArgs) {
+	guildID := message.GuildID
+	if guildID == "" {
+		// ignore if not from a guild
+		return
+	}
+	text := ""
+	target := strings.ToLower(args.String("target", ""))
+	level := args.String("level", "")
+	action := args.String("action", "")
+	required, roleID := "", ""
+	previous := state.GuildSettings(guildID)
+	var err error
+	switch action {
+	case "addadmin", "removeadmin":
+		if roleID, err = parseRole(discord, guildID, lang, args.String("target", "")); err != nil {
+			text = err.Error()
+			goto SendMessage
+		}
+		err = state.UpdateGuildSettings(guildID, func(settings *GuildSettings) {
+			roleIDs := []string{}
+			for _, id := range settings.AdminRoles {
+				if id != roleID {
+					roleIDs = append(roleIDs, id)
+				}
+			}
+			if action == "addadmin" {
+				roleIDs = append(roleIDs, roleID)
+			}
+			settings.AdminRoles = roleIDs
+		})
+		break
+	case "set":
+		cmds := state.Commands()
+		if gCMDs, ok := state.GuildCommands(guildID); ok {
+			cmds = gCMDs
+		}
+		if _, found := cmds[target]; !found {
+			text = tr(lang, "Invalid command: %s", target)
+			goto SendMessage
+		}
+		if target == "perms" {
+			text = tr(lang, "Permission of this command cannot be changed.")
+			goto SendMessage
+		}
+		if level == "" {
+			text = tr(lang, "Permission required: everyone, admin, root or a role")
+			goto SendMessage
+		}
+		if required, err = parsePermission(discord, guildID, lang, level); err != nil {
+			text = err.Error()
+			goto SendMessage
+		}
+		err = state.UpdateGuildSettings(guildID, func(settings *GuildSettings) {
+			if settings.Permissions == nil {
+				settings.Permissions = map[string]string{}
+			}
+			settings.Permissions[target] = required
+		})
+		break
+	case "reset":
+		err = state.UpdateGuildSettings(guildID, func(settings *GuildSettings) {
+			delete(settings.Permissions, target)
+		})
+		break
+	}
+	if commandErrorIf(err, discord, message.ChannelID, tr(lang, "Failed to save permissions"), debugTag) {
+		return
+	}
+	if current := state.GuildSettings(guildID); roleID != "" {
+		audit(discord, message, "perms "+action, roleID, strings.Join(previous.AdminRoles, ","),
+			strings.Join(current.AdminRoles, ","))
+	} else if action != "" {
+		audit(discord, message, "perms "+action, target, previous.Permissions[target], current.Permissions[target])
+	}
+	text = formatGuildPermissions(discord, guildID, lang)
+SendMessage:
+	_, err = discordSend(discord, message.ChannelID, text, true)
+	logErrorTS(debugTag, err)
+}
+
+// formatGuildPermissions lists the admin roles and the permission overrides of a guild
+func formatGuildPermissions(discord Messenger, guildID, lang string) string {
+	settings := state.GuildSettings(guildID)
+	roles, err := guildRoles(discord, guildID)
+	logErrorTS("permissions", err)
+	admins := []string{}
+	for _, roleID := range settings.AdminRoles {
+		admins = append(admins, formatPermission(lang, roles, roleID))
+	}
+	if len(admins) == 0 {
+		admins = append(admins, tr(lang, "@ButlerAdmin (default)"))
+	}
+	s := tr(lang, "Admin roles: %s\n", strings.Join(admins, ", "))
+	cmdNames := []string{}
+	for cmdName := range settings.Permissions {
+		cmdNames = append(cmdNames, cmdName)
+	}
+	sort.Strings(cmdNames)
+	if len(cmdNames) == 0 {
+		return s + tr(lang, "Command permissions: default")
+	}
+	s += tr(lang, "Command permissions:") + "\n"
+	for _, cmdName := range cmdNames {
+		s += fmt.Sprintf(" - %s: %s\n", cmdName, formatPermission(lang, roles, settings.Permissions[cmdName]))
+	}
+	return s
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCommandPermissions(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "ButlerAdmin", "id-admin")
+	fake.AddRole(testGuildID, "Moderators", "id-mod")
+	fake.AddRole(testGuildID, "Members", "id-member")
+
+	reply := send(fake, testGuildID, testChannelID, "mod", "!perms")
+	if !strings.Contains(reply, "You do not have permission to use this command") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!perms addadmin @moderators")
+	if !strings.Contains(reply, "Admin roles: @Moderators") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	// configured admin roles replace the ButlerAdmin role
+	reply = send(fake, testGuildID, testChannelID, "mod", "!perms set mn @Members")
+	if !strings.Contains(reply, "mn: @Members") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!perms")
+	if !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	if reply = send(fake, testGuildID, testChannelID, "alice", "!mn collateral"); !strings.Contains(reply,
+		"You do not have permission") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if reply = send(fake, testGuildID, testChannelID, "member", "!mn collateral"); !strings.Contains(reply, "Tier 1") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	// overrides are per guild
+	if reply = send(fake, "guild-2", "channel-2", "alice", "!mn collateral"); !strings.Contains(reply, "Tier 1") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	send(fake, testGuildID, testChannelID, "mod", "!perms set mn root")
+	if reply = send(fake, testGuildID, testChannelID, "mod", "!mn collateral"); !strings.Contains(reply,
+		"You do not have permission") {
+		t.Fatalf("admins should not be allowed to use root commands: %q", reply)
+	}
+	if reply = send(fake, testGuildID, testChannelID, "root", "!mn collateral"); !strings.Contains(reply, "Tier 1") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	reply = send(fake, testGuildID, testChannelID, "mod", "!perms set perms everyone")
+	if !strings.Contains(reply, "cannot be changed") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "mod", "!perms reset mn")
+	if !strings.Contains(reply, "Command permissions: default") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	// admin-only commands are denied in private messages unless root user
+	if reply = send(fake, "", testDMChannelID, "mod", "!prefix"); !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("admin-only command allowed in private message: %q", reply)
+	}
+
+	send(fake, testGuildID, testChannelID, "mod", "!perms removeadmin Moderators")
+	if reply = send(fake, testGuildID, testChannelID, "admin", "!perms"); !strings.Contains(reply,
+		"Admin roles: @ButlerAdmin (default)") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestRootUsers(t *testing.T) {
+	fake := setupCommandTest(t)
+	c := *state.Config()
+	c.Client.DiscordBot.RootUser = ""
+	c.Client.DiscordBot.RootUsers = []string{"id-carol"}
+	state.SetConfig(&c)
+
+	if reply := send(fake, testGuildID, testChannelID, "carol", "!perms"); !strings.Contains(reply, "Admin roles") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if reply := send(fake, testGuildID, testChannelID, "root", "!perms"); !strings.Contains(reply,
+		"You do not have permission") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestMemberCache(t *testing.T) {
+	fake := setupCommandTest(t)
+	cache := discordgo.NewState()
+	state.SetMemberCache(cache)
+	defer state.SetMemberCache(nil)
+	err := cache.GuildAdd(&discordgo.Guild{
+		ID:    testGuildID,
+		Roles: []*discordgo.Role{{ID: "123456789", Name: "Staff"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.MemberAdd(&discordgo.Member{
+		GuildID: testGuildID,
+		User:    &discordgo.User{ID: "id-staff"},
+		Roles:   []string{"123456789"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// roles are not available using REST requests
+	err = state.UpdateGuildSettings(testGuildID, func(settings *GuildSettings) {
+		settings.AdminRoles = []string{"123456789"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := send(fake, testGuildID, testChannelID, "staff", "!perms set mn <@&123456789>"); !strings.Contains(
+		reply, "mn: @Staff") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	// roles of the member included in the message are used
+	msg := newMessageCreate(testGuildID, testChannelID, "bob", "!mn collateral")
+	msg.Member = &discordgo.Member{Roles: []string{"123456789"}}
+	commandHandler(fake, msg)
+	if reply := fake.LastMessage(testChannelID); !strings.Contains(reply, "Tier 1") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maximum number of price alerts of a user
+	maxPriceAlerts = 20
+	// duration between price alert checks. Also the resolution of the price history used by move alerts.
+	priceAlertInterval = time.Minute
+	// longest window of move alerts
+	maxPriceAlertWindow = 24 * time.Hour
+	// Hysteresis of above and below alerts as a fraction of the threshold. A triggered alert is re-armed once the
+	// price moves back past the threshold by more than this. Eg: an alert above $1.00 is re-armed below $0.98.
+	priceAlertHysteresis = 0.02
+	// A triggered move alert is re-armed once the change over the window falls below this fraction of the percentage
+	moveAlertRearmRatio = 0.5
+)
+
+// PriceAlert notifies a user by private message when the price of a token crosses a threshold or moves by a
+// percentage within a time window
+type PriceAlert struct {
+	// Number of the alert. Unique for each user.
+	ID     int64  `json:"id"`
+	Ticker string `json:"ticker"`
+	// Valid conditions: above, below, move
+	Condition string `json:"condition"`
+	// Price threshold or, for move alerts, the percentage change in either direction
+	Value float64 `json:"value"`
+	// Currency of the price: usd or eth
+	Unit string `json:"unit"`
+	// Duration of the window of move alerts. Eg: 1h
+	Window string `json:"window,omitempty"`
+	// Repeating alerts are kept after triggering and re-armed according to the hysteresis.
+	// One-shot alerts are removed after triggering.
+	Repeat bool `json:"repeat,omitempty"`
+	// Whether the alert can trigger. Disarmed after triggering until the price moves back.
+	Armed         bool      `json:"armed"`
+	Created       time.Time `json:"created"`
+	LastTriggered time.Time `json:"lasttriggered,omitempty"`
+}
+
+// met checks if the threshold of an above or below alert is reached
+func (a PriceAlert) met(price float64) bool {
+	if a.Condition == "below" {
+		return price <= a.Value
+	}
+	return price >= a.Value
+}
+
+// check evaluates the alert using the price and, for move alerts, the percentage change over the window (if known).
+// Returns true if the alert triggers. Triggered alerts are disarmed and re-armed once the price moves back past the
+// hysteresis.
+func (a *PriceAlert) check(price, change float64, hasChange bool) bool {
+	switch a.Condition {
+	case "move":
+		if !hasChange {
+			return false
+		}
+		if !a.Armed {
+			a.Armed = math.Abs(change) < a.Value*moveAlertRearmRatio
+			return false
+		}
+		a.Armed = math.Abs(change) < a.Value
+		return !a.Armed
+	case "below":
+		if !a.Armed {
+			a.Armed = price > a.Value*(1+priceAlertHysteresis)
+			return false
+		}
+	default:
+		if !a.Armed {
+			a.Armed = price < a.Value*(1-priceAlertHysteresis)
+			return false
+		}
+	}
+	a.Armed = !a.met(price)
+	return !a.Armed
+}
+
+// format describes the alert. Eg: "#1 HALO above $0.020000 (once)", "#2 HALO move 5.00% in 1h (repeat)"
+func (a PriceAlert) format(lang string) string {
+	s := ""
+	switch a.Condition {
+	case "above":
+		s = tr(lang, "#%d %s above %s", a.ID, a.Ticker, formatAlertPrice(lang, a.Value, a.Unit))
+	case "below":
+		s = tr(lang, "#%d %s below %s", a.ID, a.Ticker, formatAlertPrice(lang, a.Value, a.Unit))
+	case "move":
+		s = tr(lang, "#%d %s move %s%% in %s", a.ID, a.Ticker, formatNumber(lang, a.Value, 2), a.Window)
+		if a.Unit == "eth" {
+			s += " (ETH)"
+		}
+	}
+	if a.Repeat {
+		return s + " " + tr(lang, "(repeat)")
+	}
+	return s + " " + tr(lang, "(once)")
+}
+
+// alertPrice is the price of a token in USD and ETH
+type alertPrice struct {
+	USD float64
+	ETH float64
+}
+
+// value returns the price in the currency: usd or eth
+func (p alertPrice) value(unit string) float64 {
+	if unit == "eth" {
+		return p.ETH
+	}
+	return p.USD
+}
+
+// formatAlertPrice formats a price in the currency. Eg: $1.50, $0.020000, 0.00005000 ETH
+func formatAlertPrice(lang string, price float64, unit string) string {
+	if unit == "eth" {
+		return formatNumber(lang, price, 8) + " ETH"
+	}
+	dp := 2
+	if price < 1 {
+		dp = 6
+	}
+	return "$" + formatNumber(lang, price, dp)
+}
+
+// getAlertPrice retrieves the price of a token from the HaloDEX ticker, if the token is traded on HaloDEX against
+// ETH, or from the price sources. The ETH price is retrieved from the price sources, in the order of priority.
+func getAlertPrice(ticker string) (p alertPrice, err error) {
+	eth, err := state.Prices().GetPrice("ETH")
+	if err != nil {
+		return
+	}
+	if eth.USD <= 0 {
+		err = fmt.Errorf("Price not available for ETH")
+		return
+	}
+	tokens, err := state.DEX().GetTokens()
+	if err != nil {
+		return
+	}
+	if token, found := tokens[ticker]; found && strings.ToUpper(token.Type) != "BASE" {
+		t, err := state.DEX().GetTicker(ticker, "ETH", eth.USD, 0)
+		if err != nil {
+			return p, err
+		}
+		return alertPrice{USD: t.Last * eth.USD, ETH: t.Last}, nil
+	}
+	price, err := state.Prices().GetPrice(ticker)
+	if err != nil {
+		return
+	}
+	if price.USD <= 0 {
+		err = fmt.Errorf("Price not available for %s", ticker)
+		return
+	}
+	return alertPrice{USD: price.USD, ETH: price.USD / eth.USD}, nil
+}
+
+// priceSample is the price of a token at a point in time
+type priceSample struct {
+	Time  time.Time
+	Price alertPrice
+}
+
+// priceHistory keeps the recent prices of the tokens with price alerts. Used to calculate the change of the price
+// over the window of move alerts. Not persisted.
+type priceHistory struct {
+	mutex sync.Mutex
+	// Oldest first. Key: ticker
+	samples map[string][]priceSample
+}
+
+func newPriceHistory() *priceHistory {
+	return &priceHistory{samples: map[string][]priceSample{}}
+}
+
+// alertPriceHistory is a variable to allow tests to replace it
+var alertPriceHistory = newPriceHistory()
+
+// add appends a price and discards the samples older than the longest window
+func (h *priceHistory) add(ticker string, t time.Time, p alertPrice) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	samples := append(h.samples[ticker], priceSample{t, p})
+	for len(samples) > 1 && t.Sub(samples[1].Time) >= maxPriceAlertWindow {
+		samples = samples[1:]
+	}
+	h.samples[ticker] = samples
+}
+
+// change returns the percentage change of the price in the currency since the start of the window up to the most
+// recent price. Ok is false if the history does not cover the window yet.
+func (h *priceHistory) change(ticker, unit string, window time.Duration) (percent float64, ok bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	samples := h.samples[ticker]
+	if len(samples) == 0 {
+		return
+	}
+	last := samples[len(samples)-1]
+	if last.Time.Sub(samples[0].Time) < window {
+		return
+	}
+	// most recent price at or before the start of the window
+	start := samples[0]
+	for _, sample := range samples {
+		if last.Time.Sub(sample.Time) < window {
+			break
+		}
+		start = sample
+	}
+	from := start.Price.value(unit)
+	if from <= 0 {
+		return
+	}
+	return (last.Price.value(unit) - from) / from * 100, true
+}
+
+var priceAlertSchedulerOnce sync.Once
+
+// startPriceAlertScheduler checks the price alerts periodically. Subsequent invocations are ignored.
+func startPriceAlertScheduler(discord Messenger) {
+	priceAlertSchedulerOnce.Do(func() {
+		go func() {
+			for range time.Tick(priceAlertInterval) {
+				checkPriceAlerts(discord)
+			}
+		}()
+	})
+}
+
+// checkPriceAlerts retrieves the prices of the tokens with price alerts and notifies the users of the triggered
+// alerts by private message. One-shot alerts are removed after triggering.
+func checkPriceAlerts(discord Messenger) {
+	debugTag := "CheckPriceAlerts"
+	now := time.Now()
+	all := state.AllPriceAlerts()
+	prices := map[string]alertPrice{}
+	for _, alerts := range all {
+		for _, a := range alerts {
+			if _, done := prices[a.Ticker]; done {
+				continue
+			}
+			p, err := getAlertPrice(a.Ticker)
+			if logErrorTS(debugTag, err) {
+				continue
+			}
+			prices[a.Ticker] = p
+			alertPriceHistory.add(a.Ticker, now, p)
+		}
+	}
+	for userID, alerts := range all {
+		// evaluate a copy and only save the alerts that changed
+		changed := map[int64]PriceAlert{}
+		triggered := []PriceAlert{}
+		for _, a := range alerts {
+			p, found := prices[a.Ticker]
+			if !found {
+				continue
+			}
+			armed := a.Armed
+			window, _ := time.ParseDuration(a.Window)
+			change, hasChange := alertPriceHistory.change(a.Ticker, a.Unit, window)
+			if a.check(p.value(a.Unit), change, hasChange) {
+				if err := sendPriceAlert(discord, userID, a, p, change); logErrorTS(debugTag, err) {
+					// the alert stays armed and is sent on the next check
+					continue
+				}
+				a.LastTriggered = now
+				triggered = append(triggered, a)
+				changed[a.ID] = a
+				continue
+			}
+			if a.Armed != armed {
+				changed[a.ID] = a
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		err := state.UpdatePriceAlerts(userID, func(alerts []PriceAlert) (result []PriceAlert) {
+			for _, a := range alerts {
+				c, found := changed[a.ID]
+				if found && !c.LastTriggered.IsZero() && !c.Repeat {
+					continue
+				}
+				if found {
+					a.Armed, a.LastTriggered = c.Armed, c.LastTriggered
+				}
+				result = append(result, a)
+			}
+			return
+		})
+		logErrorTS(debugTag, err)
+		logTS(debugTag, fmt.Sprintf("User: %s | Triggered: %d | Changed: %d", userID, len(triggered), len(changed)))
+	}
+}
+
+// sendPriceAlert notifies the user of a triggered price alert by private message
+func sendPriceAlert(discord Messenger, userID string, a PriceAlert, p alertPrice, change float64) error {
+	lang := state.Language("", userID)
+	price := formatAlertPrice(lang, p.value(a.Unit), a.Unit)
+	txt := ""
+	switch a.Condition {
+	case "above":
+		txt = tr(lang, "Price alert #%d: %s is above %s. Current price: %s", a.ID, a.Ticker,
+			formatAlertPrice(lang, a.Value, a.Unit), price)
+	case "below":
+		txt = tr(lang, "Price alert #%d: %s is below %s. Current price: %s", a.ID, a.Ticker,
+			formatAlertPrice(lang, a.Value, a.Unit), price)
+	case "move":
+		txt = tr(lang, "Price alert #%d: %s moved %s%% in %s. Current price: %s", a.ID, a.Ticker,
+			formatNumber(lang, change, 2), a.Window, price)
+	}
+	if !a.Repeat {
+		txt += "\n" + tr(lang, "This alert has been removed.")
+	}
+	channel, err := discord.UserChannelCreate(userID)
+	if err != nil {
+		return err
+	}
+	_, err = discordSend(discord, channel.ID, txt, true)
+	return err
+}
+
+// cmdPriceAlert adds, lists and removes the price alerts of the user
+func cmdPriceAlert(discord Messenger, message *discordgo.MessageCreate, lang, debugTag, action string,
+	args commandArgs) {
+	channelID, userID := message.ChannelID, message.Author.ID
+	prefix := state.CommandPrefix(message.GuildID)
+	txt := ""
+	ticker := args.String("quote-ticker", "")
+	condition := args.String("condition", "")
+	values := args.Floats("value")
+	unit := args.String("unit", "usd")
+	alerts := state.PriceAlerts(userID)
+	alert := PriceAlert{}
+	var p alertPrice
+	var err error
+	switch {
+	case action == "list" || (action == "" && ticker == "" && condition == ""):
+		if len(alerts) == 0 {
+			txt = tr(lang, "You have no price alerts. Example: %salert price halo above 0.02", prefix)
+			goto SendMessage
+		}
+		for _, a := range alerts {
+			txt += a.format(lang) + "\n"
+		}
+		goto SendMessage
+	case action == "remove":
+		if len(values) == 0 {
+			txt = tr(lang, "Alert number required. To list your alerts: %salert price list", prefix)
+			goto SendMessage
+		}
+		removed := int64(0)
+		err = state.UpdatePriceAlerts(userID, func(alerts []PriceAlert) (result []PriceAlert) {
+		Alerts:
+			for _, a := range alerts {
+				for _, id := range values {
+					if a.ID == int64(id) {
+						removed++
+						continue Alerts
+					}
+				}
+				result = append(result, a)
+			}
+			return
+		})
+		if commandErrorIf(err, discord, channelID, tr(lang, "Failed to save preferences"), debugTag) {
+			return
+		}
+		txt = trn(lang, removed, "%d price alert removed", "%d price alerts removed", removed)
+		goto SendMessage
+	case action != "" || ticker == "" || condition == "" || len(values) == 0:
+		txt = tr(lang, "Ticker, condition and value required. Example: %salert price halo above 0.02", prefix)
+		goto SendMessage
+	case condition == "move" && !args.Has("window"):
+		txt = tr(lang, "Window required for move alerts. Example: %salert price halo move 5 1h", prefix)
+		goto SendMessage
+	case values[0] <= 0:
+		txt = tr(lang, "Value must be greater than zero")
+		goto SendMessage
+	case len(alerts) >= maxPriceAlerts:
+		txt = tr(lang, "You have reached the maximum number (%d) of price alerts.", maxPriceAlerts)
+		goto SendMessage
+	}
+
+	p, err = getAlertPrice(ticker)
+	if err != nil {
+		logErrorTS(debugTag, err)
+		txt = tr(lang, "Price not available for %s", ticker)
+		goto SendMessage
+	}
+	alert = PriceAlert{
+		Ticker:    ticker,
+		Condition: condition,
+		Value:     values[0],
+		Unit:      unit,
+		Window:    args.String("window", ""),
+		Repeat:    args.String("mode", "") == "repeat",
+		Armed:     true,
+		Created:   time.Now().UTC(),
+	}
+	if condition != "move" && alert.met(p.value(unit)) {
+		txt = tr(lang, "%s is already above %s. Current price: %s", ticker, formatAlertPrice(lang, alert.Value, unit),
+			formatAlertPrice(lang, p.value(unit), unit))
+		if condition == "below" {
+			txt = tr(lang, "%s is already below %s. Current price: %s", ticker,
+				formatAlertPrice(lang, alert.Value, unit), formatAlertPrice(lang, p.value(unit), unit))
+		}
+		goto SendMessage
+	}
+	err = state.UpdatePriceAlerts(userID, func(alerts []PriceAlert) []PriceAlert {
+		alert.ID = 1
+		for _, a := range alerts {
+			if a.ID >= alert.ID {
+				alert.ID = a.ID + 1
+			}
+		}
+		return append(alerts, alert)
+	})
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to save preferences"), debugTag) {
+		return
+	}
+	txt = tr(lang, "Price alert added: %s\nCurrent price: %s\nYou will be notified by private message.",
+		alert.format(lang), formatAlertPrice(lang, p.value(unit), unit))
+SendMessage:
+	_, err = discordSend(discord, channelID, txt, true)
+	logErrorTS(debugTag, err)
+}
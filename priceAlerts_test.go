@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriceAlertHysteresis(t *testing.T) {
+	above := PriceAlert{Condition: "above", Value: 1, Repeat: true, Armed: true}
+	for i, step := range []struct {
+		price    float64
+		triggers bool
+	}{{0.99, false}, {1, true}, {1.01, false}, {0.99, false}, {0.97, false}, {0.99, false}, {1.02, true}} {
+		if triggered := above.check(step.price, 0, false); triggered != step.triggers {
+			t.Errorf("above, step %d (%v): expected %v, got %v", i, step.price, step.triggers, triggered)
+		}
+	}
+	below := PriceAlert{Condition: "below", Value: 1, Armed: true}
+	for i, step := range []struct {
+		price    float64
+		triggers bool
+	}{{1.01, false}, {0.9, true}, {1.01, false}, {0.9, false}, {1.03, false}, {1, true}} {
+		if triggered := below.check(step.price, 0, false); triggered != step.triggers {
+			t.Errorf("below, step %d (%v): expected %v, got %v", i, step.price, step.triggers, triggered)
+		}
+	}
+	move := PriceAlert{Condition: "move", Value: 5, Armed: true}
+	if move.check(1, 10, false) {
+		t.Error("move alert triggered without price history")
+	}
+	for i, step := range []struct {
+		change   float64
+		triggers bool
+	}{{3, false}, {6, true}, {4, false}, {-6, false}, {2, false}, {-5, true}} {
+		if triggered := move.check(1, step.change, true); triggered != step.triggers {
+			t.Errorf("move, step %d (%v%%): expected %v, got %v", i, step.change, step.triggers, triggered)
+		}
+	}
+}
+
+func TestPriceAlerts(t *testing.T) {
+	fake := setupCommandTest(t)
+	fallback := newFakeAPIServer()
+	defer fallback.Close()
+	var mu sync.Mutex
+	// HALO/ETH. ETH: $200
+	last := "0.00005"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dex/public/pricing/all" {
+			fallback.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, `[{ "pair": "HALO/ETH", "quoteTicker": "HALO", "baseTicker": "ETH", "last": "%s" }]`, last)
+	}))
+	defer server.Close()
+	setPrice := func(price string) {
+		mu.Lock()
+		defer mu.Unlock()
+		last = price
+	}
+	c := state.Config()
+	c.Client.CMC.BaseURL = server.URL
+	c.Client.CMC.APIKEY = "test"
+	c.Client.CMC.DailyCreditLimit = 333
+	c.Client.DEX.BaseURL = server.URL
+	c.Client.DEX.CachedTickerExpireMins = 0
+	state.SetConfig(c)
+	alertPriceHistory = newPriceHistory()
+	// price an hour and a half ago
+	alertPriceHistory.add("HALO", time.Now().Add(-90*time.Minute), alertPrice{USD: 0.01, ETH: 0.00005})
+
+	reply := send(fake, "", testDMChannelID, "alice", "!alert price halo above 0.005")
+	if !strings.Contains(reply, "HALO is already above $0.005000. Current price: $0.010000") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!alert price halo move 5")
+	if !strings.Contains(reply, "Window required for move alerts") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!alert price halo above 0.02")
+	if !strings.Contains(reply, "Price alert added: #1 HALO above $0.020000 (once)") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "alice", "!alert price halo below 0.00004 eth repeat")
+	if !strings.Contains(reply, "Price alert added: #2 HALO below 0.00004000 ETH (repeat)") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	send(fake, "", testDMChannelID, "alice", "!alert price halo move 50 1h")
+	reply = send(fake, "", testDMChannelID, "alice", "!alert price list")
+	if !strings.Contains(reply, "#3 HALO move 50.00% in 1h (once)") || strings.Count(reply, "#") != 3 {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+
+	// $0.022: alerts that failed to send are kept and sent on the next check
+	setPrice("0.00011")
+	fake.FailChannels["dm-id-alice"] = true
+	checkPriceAlerts(fake)
+	if alerts := state.PriceAlerts("id-alice"); len(alerts) != 3 || !alerts[0].Armed || !alerts[2].Armed {
+		t.Fatalf("alerts not kept after failing to send: %+v", alerts)
+	}
+	delete(fake.FailChannels, "dm-id-alice")
+
+	// above and move alerts are sent and removed
+	checkPriceAlerts(fake)
+	msgs := fake.Messages("dm-id-alice")
+	if len(msgs) != 2 || !strings.Contains(strings.Join(msgs, "\n"), "Price alert #1: HALO is above $0.020000. "+
+		"Current price: $0.022000\nThis alert has been removed.") ||
+		!strings.Contains(strings.Join(msgs, "\n"), "Price alert #3: HALO moved 120.00% in 1h.") {
+		t.Fatalf("unexpected alerts: %q", msgs)
+	}
+	if alerts := state.PriceAlerts("id-alice"); len(alerts) != 1 || alerts[0].ID != 2 {
+		t.Fatalf("one-shot alerts not removed: %+v", alerts)
+	}
+
+	// repeating alert is only sent again once the price moves back past the hysteresis
+	for _, price := range []string{"0.00003", "0.00003", "0.000035", "0.000041", "0.0000405", "0.00004"} {
+		setPrice(price)
+		checkPriceAlerts(fake)
+	}
+	msgs = fake.Messages("dm-id-alice")[2:]
+	if len(msgs) != 2 || !strings.Contains(msgs[0], "Price alert #2: HALO is below 0.00004000 ETH. "+
+		"Current price: 0.00003000 ETH") || strings.Contains(msgs[0], "removed") {
+		t.Fatalf("unexpected alerts: %q", msgs)
+	}
+
+	if err := loadData(); err != nil {
+		t.Fatal(err)
+	}
+	if alerts := state.PriceAlerts("id-alice"); len(alerts) != 1 || alerts[0].Armed ||
+		alerts[0].LastTriggered.IsZero() {
+		t.Fatalf("alert state not saved: %+v", alerts)
+	}
+	reply = send(fake, "", testDMChannelID, "alice", "!alert price remove 2 5")
+	if !strings.Contains(reply, "1 price alert removed") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	if reply = send(fake, "", testDMChannelID, "alice", "!alert price"); !strings.Contains(reply, "no price alerts") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+
+	// ETH price falls back to CoinCap without a CMC API key: $150
+	c.Client.CMC.APIKEY = ""
+	c.Client.CoinCap.BaseURL = server.URL
+	state.SetConfig(c)
+	if p, err := getAlertPrice("HALO"); err != nil || math.Abs(p.USD-0.006) > 1e-9 {
+		t.Fatalf("unexpected price: %+v, %v", p, err)
+	}
+
+	catalogs, err := loadCatalogs(localesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetCatalogs(catalogs)
+	below := PriceAlert{ID: 1, Ticker: "HALO", Condition: "below", Value: 0.02, Unit: "usd"}
+	if s := below.format("es"); s != "#1 HALO por debajo de $0,020000 (una vez)" {
+		t.Fatalf("condition should be translated: %q", s)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alien45/halo-info-bot/client"
+)
+
+// defaultPriceSources lists the supported price sources in the default order of priority
+var defaultPriceSources = []string{"cmc", "coincap", "dex"}
+
+// newPriceSources constructs the price sources using the API clients of the config, in the configured order.
+// The HaloDEX derived source uses the other configured sources for the base token (ETH) price.
+func newPriceSources(c *Config) (sources client.PriceSources, err error) {
+	names := c.PriceSources
+	if len(names) == 0 {
+		names = defaultPriceSources
+	}
+	baseSources := client.PriceSources{}
+	dexIndex := -1
+	for i, name := range names {
+		switch strings.ToLower(name) {
+		case "cmc":
+			sources = append(sources, &c.Client.CMC)
+		case "coincap":
+			sources = append(sources, c.Client.CoinCap)
+		case "dex":
+			if dexIndex >= 0 {
+				return nil, fmt.Errorf("Duplicate price source: %s", name)
+			}
+			dexIndex = i
+			sources = append(sources, nil)
+			continue
+		default:
+			return nil, fmt.Errorf("Unsupported price source: %s", name)
+		}
+		baseSources = append(baseSources, sources[i])
+	}
+	if dexIndex >= 0 {
+		sources[dexIndex] = &client.DEXPrice{
+			DEX:         &c.Client.DEX,
+			BaseTicker:  "ETH",
+			BaseSources: baseSources,
+		}
+	}
+	return
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// maximum number of buckets kept before removing the idle ones
+const maxRateLimitBuckets = 10000
+
+// defaultCommandCosts is the cost of commands sending multiple upstream requests. Other commands cost 1.
+var defaultCommandCosts = map[string]float64{
+	// DEX ticker, two RPC calls and trades
+	"halo":       4,
+	"nodes":      3,
+	"orderbook":  3,
+	"dexbalance": 3,
+	"balance":    2,
+	"cmc":        2,
+	"ticker":     2,
+	"trades":     2,
+}
+
+// RateLimitConfig describes the command rate limits per user, channel and guild.
+// Limits with zero capacity are disabled. Root user and guild admins are exempted.
+type RateLimitConfig struct {
+	User    BucketConfig `json:"user"`
+	Channel BucketConfig `json:"channel"`
+	Guild   BucketConfig `json:"guild"`
+	// Cost of commands by name. Overrides the default costs of the expensive commands.
+	Costs map[string]float64 `json:"costs"`
+}
+
+// BucketConfig describes a token bucket
+type BucketConfig struct {
+	// Maximum number of tokens. Allows bursts of commands up to this cost.
+	Capacity float64 `json:"capacity"`
+	// Number of tokens added per minute
+	RefillPerMinute float64 `json:"refillperminute"`
+}
+
+// commandCost returns the configured cost of a command or the default
+func (c RateLimitConfig) commandCost(cmdName string) float64 {
+	if cost, ok := c.Costs[cmdName]; ok {
+		return cost
+	}
+	if cost, ok := defaultCommandCosts[cmdName]; ok {
+		return cost
+	}
+	return 1
+}
+
+// rateLimitKey identifies a bucket. Scope is used in the slow down reply. Eg: "user"
+type rateLimitKey struct {
+	ID     string
+	Scope  string
+	Config BucketConfig
+}
+
+// rateLimitKeys returns the keys of the enabled buckets applicable to the command request
+func (c RateLimitConfig) rateLimitKeys(r *commandRequest) (keys []rateLimitKey) {
+	candidates := []rateLimitKey{
+		{ID: "user:" + r.Message.Author.ID, Scope: "user", Config: c.User},
+		{ID: "channel:" + r.ChannelID, Scope: "channel", Config: c.Channel},
+	}
+	if r.GuildID != "" {
+		candidates = append(candidates, rateLimitKey{ID: "guild:" + r.GuildID, Scope: "guild", Config: c.Guild})
+	}
+	for _, key := range candidates {
+		if key.Config.Capacity > 0 {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// time until which the slow down reply is not repeated
+	warnedUntil time.Time
+}
+
+// refill adds tokens for the time elapsed since the last update
+func (b *tokenBucket) refill(config BucketConfig, now time.Time) {
+	b.tokens = math.Min(config.Capacity, b.tokens+now.Sub(b.updated).Minutes()*config.RefillPerMinute)
+	b.updated = now
+}
+
+// wait returns the duration until the bucket has enough tokens
+func (b *tokenBucket) wait(config BucketConfig, cost float64) time.Duration {
+	if b.tokens >= cost {
+		return 0
+	}
+	if config.RefillPerMinute <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration((cost - b.tokens) / config.RefillPerMinute * float64(time.Minute))
+}
+
+// rateLimiter limits commands using token buckets
+type rateLimiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+// limiter limits the commands of all guilds
+var limiter = newRateLimiter()
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[string]*tokenBucket{}, now: time.Now}
+}
+
+// bucket returns the refilled bucket of the key. New buckets are full.
+func (l *rateLimiter) bucket(key rateLimitKey, now time.Time) *tokenBucket {
+	b, found := l.buckets[key.ID]
+	if !found {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.removeIdle(now)
+		}
+		b = &tokenBucket{tokens: key.Config.Capacity, updated: now}
+		l.buckets[key.ID] = b
+	}
+	b.refill(key.Config, now)
+	return b
+}
+
+// removeIdle removes buckets that have refilled, which are equivalent to new buckets
+func (l *rateLimiter) removeIdle(now time.Time) {
+	for id, b := range l.buckets {
+		if b.tokens >= 0 && now.After(b.warnedUntil) && now.Sub(b.updated) > time.Hour {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// allow takes the cost from all buckets if every bucket has enough tokens. Otherwise, returns the bucket with the
+// longest wait and whether the user should be told to slow down, only once until the wait is over.
+// The cost is capped at the capacity of each bucket to allow commands costing more than the capacity.
+func (l *rateLimiter) allow(keys []rateLimitKey, cost float64) (limited *rateLimitKey, wait time.Duration, warn bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	var limitedBucket *tokenBucket
+	for i, key := range keys {
+		b := l.bucket(key, now)
+		if w := b.wait(key.Config, math.Min(cost, key.Config.Capacity)); w > wait {
+			limited, limitedBucket, wait = &keys[i], b, w
+		}
+	}
+	if limited != nil {
+		warn = now.After(limitedBucket.warnedUntil)
+		if warn {
+			limitedBucket.warnedUntil = now.Add(wait)
+		}
+		return
+	}
+	for _, key := range keys {
+		l.buckets[key.ID].tokens -= math.Min(cost, key.Config.Capacity)
+	}
+	return
+}
+
+// charge takes additional cost from the buckets, if any, after a command has been allowed.
+// Buckets may go below zero, delaying the next commands.
+func (l *rateLimiter) charge(keys []rateLimitKey, cost float64) {
+	if cost <= 0 {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	for _, key := range keys {
+		l.bucket(key, now).tokens -= cost
+	}
+}
+
+// slowDownMessage returns the reply to a throttled command
+func slowDownMessage(lang, scope string, wait time.Duration) string {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	switch scope {
+	case "channel":
+		return tr(lang, "Slow down! Too many commands in this channel.") + " " +
+			trn(lang, seconds, "Try again in %d second.", "Try again in %d seconds.", seconds)
+	case "guild":
+		return tr(lang, "Slow down! Too many commands in this server.") + " " +
+			trn(lang, seconds, "Try again in %d second.", "Try again in %d seconds.", seconds)
+	}
+	return tr(lang, "Slow down!") + " " + trn(lang, seconds, "Try again in %d second.", "Try again in %d seconds.", seconds)
+}
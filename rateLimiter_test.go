@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+	keys := []rateLimitKey{
+		{ID: "user:alice", Scope: "user", Config: BucketConfig{Capacity: 4, RefillPerMinute: 2}},
+		{ID: "channel:1", Scope: "channel", Config: BucketConfig{Capacity: 10, RefillPerMinute: 10}},
+	}
+	if limited, _, _ := l.allow(keys, 3); limited != nil {
+		t.Fatal("expected command to be allowed")
+	}
+	limited, wait, warn := l.allow(keys, 3)
+	if limited == nil || limited.Scope != "user" || wait != time.Minute || !warn {
+		t.Fatalf("unexpected limit: %+v, wait: %v, warn: %v", limited, wait, warn)
+	}
+	// slow down reply is sent once until the wait is over
+	if _, _, warn = l.allow(keys, 3); warn {
+		t.Fatal("slow down reply must not be repeated")
+	}
+	// denied commands are not charged
+	if l.buckets["channel:1"].tokens != 7 {
+		t.Fatalf("unexpected channel tokens: %v", l.buckets["channel:1"].tokens)
+	}
+
+	now = now.Add(time.Minute)
+	if limited, _, _ = l.allow(keys, 3); limited != nil {
+		t.Fatal("expected command to be allowed after refill")
+	}
+	// additional cost delays the next commands
+	l.charge(keys, 4)
+	if _, wait, _ = l.allow(keys, 1); wait != 2*time.Minute+30*time.Second {
+		t.Fatalf("unexpected wait: %v", wait)
+	}
+	// cost is capped at the capacity
+	now = now.Add(time.Hour)
+	if limited, _, _ = l.allow(keys, 100); limited != nil {
+		t.Fatal("expected expensive command to be allowed when the bucket is full")
+	}
+}
+
+func TestCommandRateLimit(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "ButlerAdmin", "id-admin")
+	c := *state.Config()
+	c.RateLimit = RateLimitConfig{
+		User:  BucketConfig{Capacity: 2, RefillPerMinute: 1},
+		Costs: map[string]float64{"mn": 2},
+	}
+	state.SetConfig(&c)
+
+	for i := 0; i < 2; i++ {
+		if reply := send(fake, testGuildID, testChannelID, "alice", "!help"); !strings.Contains(reply, "!help") {
+			t.Fatalf("unexpected reply: %q", reply)
+		}
+	}
+	reply := send(fake, testGuildID, testChannelID, "alice", "!help")
+	if !strings.HasPrefix(reply, "Slow down! Try again in 60 seconds.") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	fake.Reset()
+	send(fake, testGuildID, testChannelID, "alice", "!help")
+	if len(fake.Sent) != 0 {
+		t.Fatalf("expected no reply while throttled, got: %+v", fake.Sent)
+	}
+
+	// other users are limited separately
+	if reply = send(fake, testGuildID, testChannelID, "bob", "!mn collateral"); !strings.Contains(reply, "Tier 1") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if reply = send(fake, testGuildID, testChannelID, "bob", "!help"); !strings.HasPrefix(reply, "Slow down!") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	// admins are exempted
+	for i := 0; i < 3; i++ {
+		if reply = send(fake, testGuildID, testChannelID, "admin", "!help"); strings.HasPrefix(reply, "Slow down!") {
+			t.Fatalf("admin must not be throttled")
+		}
+	}
+
+	// denied commands and commands with invalid arguments are not charged
+	for i := 0; i < 3; i++ {
+		send(fake, testGuildID, testChannelID, "carol", "!prefix ?")
+		send(fake, testGuildID, testChannelID, "carol", "!mn invalid")
+	}
+	if reply = send(fake, testGuildID, testChannelID, "carol", "!help"); !strings.Contains(reply, "!help") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if _, found := limiter.buckets["user:id-carol"]; !found {
+		t.Fatal("user bucket not keyed on the user ID")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fileWatchInterval is the duration between checks for changes of the config and commands files
+const fileWatchInterval = 10 * time.Second
+
+// reloadTargets lists the supported reload targets in the order they are reloaded
+var reloadTargets = []string{"config", "commands", "locales", "data"}
+
+// cmdReload reloads the config, commands, message catalogs and/or Discord data without restarting the bot. Root user only.
+func cmdReload(discord Messenger, message *discordgo.MessageCreate, lang, debugTag string, args commandArgs) {
+	channelID := message.ChannelID
+	txt := ""
+	targets := reloadTargets
+	var err error
+	if !isRootUser(message.Author) {
+		txt = tr(lang, "You are not authorized to reload")
+		goto SendMessage
+	}
+	if args.Has("target") {
+		targets = args.List("target")
+	}
+	for _, target := range targets {
+		if _, isBolt := state.Storage().(*boltStorage); isBolt && target == "data" && !args.Has("target") {
+			// importing the data file replaces the data in the database, therefore, only done if requested
+			continue
+		}
+		warning, err := reload(target)
+		if commandErrorIf(err, discord, channelID, tr(lang, "Failed to reload %s. No changes applied.", target),
+			debugTag) {
+			return
+		}
+		audit(discord, message, "reload", target, "", "")
+		txt += tr(lang, "Reloaded %s\n", target)
+		if warning != "" {
+			// warnings are message keys
+			txt += tr(lang, "Warning: %s\n", tr(lang, warning))
+		}
+	}
+
+SendMessage:
+	_, err = discordSend(discord, channelID, txt, true)
+	logErrorTS(debugTag, err)
+}
+
+// reload re-reads and validates the files of the reload target and replaces the current ones only if successful.
+// Warning is set if any of the changes require a restart to take effect.
+func reload(target string) (warning string, err error) {
+	switch target {
+	case "config":
+		c, err := loadConfig()
+		if err != nil {
+			return "", err
+		}
+		old := state.Config()
+		if c.Client.DiscordBot.Token != old.Client.DiscordBot.Token ||
+			c.Storage != old.Storage ||
+			c.Client.MNDApp.CheckPayout != old.Client.MNDApp.CheckPayout ||
+			c.Client.MNDApp.IntervalSeconds != old.Client.MNDApp.IntervalSeconds ||
+			c.Log.File != old.Log.File || c.Log.Format != old.Log.Format ||
+			c.MetricsAddress != old.MetricsAddress || c.AdminAddress != old.AdminAddress {
+			warning = "Changes to the Discord token, storage, payout check interval, log file and HTTP server " +
+				"addresses require a restart"
+		}
+		// keep the caches and the CMC credits used, otherwise the CMC daily credit limit is reset on every reload
+		c.Client.CMC.CopyCache(&old.Client.CMC)
+		c.Client.DEX.CopyCache(&old.Client.DEX)
+		c.Client.MNDApp.CopyCache(&old.Client.MNDApp)
+		if err = state.SetConfig(c); err != nil {
+			return "", err
+		}
+		level, _ := parseLogLevel(c.Log.Level, levelInfo)
+		channelLevel, _ := parseLogLevel(c.Log.DebugChannelLevel, levelError)
+		logger.SetLevels(level, channelLevel)
+	case "commands":
+		if err = generateCommandLists(); err == nil && logErrorTS("reload", updateApplicationCommands()) {
+			warning = "Failed to update the slash commands"
+		}
+	case "locales":
+		catalogs, err := loadCatalogs(localesDir)
+		if err != nil {
+			return "", err
+		}
+		state.SetCatalogs(catalogs)
+	case "data":
+		// the data file is only imported on the first start when using the database
+		if s, ok := state.Storage().(*boltStorage); ok {
+			if err = s.ImportData(dataFile); err != nil {
+				return
+			}
+		}
+		if err = loadData(); err != nil {
+			return
+		}
+		// guild specific commands are stored in the data
+		err = generateCommandLists()
+	default:
+		err = fmt.Errorf("Invalid reload target: %s", target)
+	}
+	return
+}
+
+// watchFiles periodically checks the config and commands files for changes and reloads the changed files
+func watchFiles(interval time.Duration) {
+	debugTag := "watchFiles"
+	files := map[string]string{
+		"config":   configFile,
+		"commands": commandsFile,
+	}
+	modTimes := map[string]time.Time{}
+	for target, filename := range files {
+		if info, err := os.Stat(filename); err == nil {
+			modTimes[target] = info.ModTime()
+		}
+	}
+	for range time.Tick(interval) {
+		for _, target := range reloadTargets {
+			filename, ok := files[target]
+			if !ok {
+				continue
+			}
+			info, err := os.Stat(filename)
+			if logErrorTS(debugTag, err) || !info.ModTime().After(modTimes[target]) {
+				continue
+			}
+			modTimes[target] = info.ModTime()
+			warning, err := reload(target)
+			if logErrorTS(debugTag, err) {
+				continue
+			}
+			logTS(debugTag, "Reloaded "+filename)
+			if warning != "" {
+				logTS(debugTag, "Warning: "+warning)
+			}
+		}
+	}
+}
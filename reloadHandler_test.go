@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	fake := setupCommandTest(t)
+	reply := send(fake, "", testDMChannelID, "alice", "!reload")
+	if !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	reply = send(fake, "", testDMChannelID, "root", "!reload everything")
+	if !strings.Contains(reply, "Invalid target: everything") || !strings.Contains(reply, "Usage: !reload") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	// external changes to the data file
+	err := ioutil.WriteFile(dataFile, []byte(`{
+		"addressbook": { "alice#0001": ["0x1234"] },
+		"guildinfocmds": { "guild-1": { "sayhello": { "type": "text", "message": "Hello" } } }
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply = send(fake, "", testDMChannelID, "root", "!reload data")
+	if !strings.Contains(reply, "Reloaded data") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if n := len(state.AddressBook("alice#0001")); n != 1 {
+		t.Fatalf("expected 1 address after reload, got %d", n)
+	}
+	if reply = send(fake, testGuildID, testChannelID, "alice", "!sayhello"); reply != "Hello" {
+		t.Fatalf("guild commands not regenerated: %q", reply)
+	}
+
+	// invalid or missing config file must not replace the current config
+	c := state.Config()
+	reply = send(fake, "", testDMChannelID, "root", "!reload config")
+	if !strings.Contains(reply, "Failed to reload config") || state.Config() != c {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+
+	// the CMC credits used are kept, so that the daily credit limit is still enforced
+	configFile = filepath.Join(filepath.Dir(dataFile), "config.json")
+	defer func() { configFile = "./config.json" }()
+	err = ioutil.WriteFile(configFile, []byte(`{
+		"apiclients": { "discordbot": { "token": "test", "prefix": "!", "rootuser": "root#0001" } }
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.CMC().DailyCreditUsed = 42
+	reply = send(fake, "", testDMChannelID, "root", "!reload config")
+	if !strings.Contains(reply, "Reloaded config") || state.Config() == c {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if used := state.CMC().CreditsUsed(); used != 42 {
+		t.Fatalf("CMC credits used not kept after reload: %d", used)
+	}
+}
+
+func TestReloadBoltStorage(t *testing.T) {
+	fake := setupCommandTest(t)
+	s, err := openBoltStorage(filepath.Join(filepath.Dir(dataFile), "discord.db"), dataFile, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	state.SetStorage(s)
+	configFile = filepath.Join(filepath.Dir(dataFile), "config.json")
+	defer func() { configFile = "./config.json" }()
+	err = ioutil.WriteFile(configFile, []byte(`{
+		"apiclients": { "discordbot": { "token": "test", "prefix": "!", "rootuser": "root#0001" } }
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// external changes to the data file are only imported if requested
+	err = ioutil.WriteFile(dataFile, []byte(`{ "addressbook": { "alice#0001": ["0x1234"] } }`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := send(fake, "", testDMChannelID, "root", "!reload")
+	if !strings.Contains(reply, "Reloaded locales") || strings.Contains(reply, "Reloaded data") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if n := len(state.AddressBook("alice#0001")); n != 0 {
+		t.Fatalf("expected no addresses without the data target, got %d", n)
+	}
+	reply = send(fake, "", testDMChannelID, "root", "!reload data")
+	if !strings.Contains(reply, "Reloaded data") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if n := len(state.AddressBook("alice#0001")); n != 1 {
+		t.Fatalf("expected 1 address after reload, got %d", n)
+	}
+	d, err := s.LoadData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(d.AddressBook["alice#0001"]); n != 1 {
+		t.Fatalf("expected 1 address in the database, got %d", n)
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maximum number of choices and autocomplete suggestions supported by Discord
+	maxChoices = 25
+	// maximum length of descriptions, choice names and values supported by Discord
+	maxDescriptionLength = 100
+)
+
+// Discord requires lower case command and option names of up to 32 characters
+var applicationCommandNameRegex = regexp.MustCompile(`^[-_a-z0-9]{1,32}$`)
+
+// suggestion is an autocomplete suggestion for the value of an option
+type suggestion struct {
+	Name  string
+	Value string
+}
+
+// applicationCommands generates the application (slash) commands of the built-in and global info commands.
+// Arguments of the built-in commands are mapped to options. Keywords are listed as choices of the option.
+func applicationCommands(commands Commands) (appCommands []*discordgo.ApplicationCommand) {
+	names := []string{}
+	for name, command := range commands {
+		if (command.Type == "text" && command.Message == "") || !applicationCommandNameRegex.MatchString(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		command := commands[name]
+		description := command.Description
+		if description == "" {
+			description = name
+		}
+		appCommand := &discordgo.ApplicationCommand{
+			Name:        name,
+			Description: limitText(strings.Join(strings.Fields(withPrefix(description, "/")), " "), maxDescriptionLength),
+			Options:     []*discordgo.ApplicationCommandOption{},
+		}
+		if builtin := findBuiltinCommand(name); builtin != nil && command.Type != "text" {
+			appCommand.Options = commandOptions(builtin.argSpec)
+		}
+		appCommands = append(appCommands, appCommand)
+	}
+	return
+}
+
+// commandOptions maps the elements of an argument specification to application command options.
+// Tickers and addresses are autocompleted. Repeated values are supplied as a single text separated by spaces.
+func commandOptions(spec argSpec) (options []*discordgo.ApplicationCommandOption) {
+	for _, el := range spec {
+		option := &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        el.Name,
+			Description: optionDescription(el),
+			Required:    el.Required,
+		}
+		alt := el.Alternatives[0]
+		switch argType := elementType(el); {
+		case argType == "":
+			for _, a := range el.Alternatives {
+				if len(option.Choices) < maxChoices {
+					option.Choices = append(option.Choices,
+						&discordgo.ApplicationCommandOptionChoice{Name: a.Name, Value: a.Name})
+				}
+			}
+			break
+		case argType == argInt && len(el.Alternatives) == 1 && !el.Variadic:
+			option.Type = discordgo.ApplicationCommandOptionInteger
+			if alt.HasRange {
+				min := float64(alt.Min)
+				option.MinValue = &min
+				option.MaxValue = float64(alt.Max)
+			}
+			break
+		case argType == argNumber && len(el.Alternatives) == 1 && !el.Variadic:
+			option.Type = discordgo.ApplicationCommandOptionNumber
+			break
+		case argType == argTicker || argType == argAddress || argType == argWallet || argType == argIndex:
+			option.Autocomplete = true
+			break
+		}
+		options = append(options, option)
+	}
+	// Discord requires the required options to be listed first
+	sort.SliceStable(options, func(i, j int) bool { return options[i].Required && !options[j].Required })
+	return
+}
+
+// elementType returns the type of the first non-keyword alternative. Empty if all alternatives are keywords.
+func elementType(el argElement) string {
+	for _, a := range el.Alternatives {
+		if !a.Keyword {
+			return a.Type
+		}
+	}
+	return ""
+}
+
+// optionDescription generates the description of an option from the name and type of the argument.
+// Eg: "quote-ticker" => "Quote ticker"
+func optionDescription(el argElement) string {
+	description := strings.Replace(el.Name, "-", " ", -1)
+	description = strings.ToUpper(description[:1]) + description[1:]
+	switch elementType(el) {
+	case argAddress, argWallet:
+		description += " or address book item number"
+		break
+	case argIndex:
+		description += " (address book item number)"
+		break
+	}
+	if el.Variadic {
+		description += ". Separate multiple values using spaces"
+	}
+	return limitText(description, maxDescriptionLength)
+}
+
+// limitText truncates text longer than limit characters
+func limitText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-3]) + "..."
+}
+
+// updateApplicationCommands registers the application commands, if enabled and connected to Discord
+func updateApplicationCommands() error {
+	registrar, ok := state.Session().(applicationCommandRegistrar)
+	if !ok || !state.Config().Client.DiscordBot.SlashCommands {
+		return nil
+	}
+	_, err := registrar.ApplicationCommandBulkOverwrite(botID, "", applicationCommands(state.Commands()))
+	return err
+}
+
+// interactionHandler handles slash commands, autocompletion of their options and the page controls
+func interactionHandler(discord InteractionMessenger, interaction *discordgo.Interaction) {
+	user := interaction.User
+	if interaction.Member != nil {
+		user = interaction.Member.User
+	}
+	if user == nil || user.Bot {
+		return
+	}
+	switch interaction.Type {
+	case discordgo.InteractionApplicationCommand:
+		slashCommandHandler(discord, interaction, user)
+		break
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		autocompleteHandler(discord, interaction, user)
+		break
+	case discordgo.InteractionMessageComponent:
+		paginationHandler(discord, interaction)
+		break
+	}
+}
+
+// slashCommandHandler executes the command of the interaction. Private commands invoked in public channels are
+// executed with replies only visible to the user.
+func slashCommandHandler(discord InteractionMessenger, interaction *discordgo.Interaction, user *discordgo.User) {
+	data := interaction.ApplicationCommandData()
+	cmdName := data.Name
+	channelID := interaction.ChannelID
+	debugTag := "slashCommandHandler"
+	lang := state.Language(interaction.GuildID, user.ID)
+	isPrivateMsg := interaction.GuildID == "" || state.IsPrivacyException(channelID)
+	var flags discordgo.MessageFlags
+	if state.IsPrivateCommand(cmdName) && !isPrivateMsg {
+		flags = discordgo.MessageFlagsEphemeral
+		isPrivateMsg = true
+	}
+	// Discord requires a response within 3 seconds. Replies are sent as follow-up messages.
+	err := discord.InteractionRespond(interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: flags},
+	})
+	if logErrorTS(debugTag, err) {
+		return
+	}
+	responder := &interactionMessenger{
+		InteractionMessenger: discord,
+		interaction:          interaction,
+		flags:                flags,
+		sent:                 map[string]bool{},
+	}
+	defer func() {
+		if !responder.replied() {
+			// replace the "thinking" state of the deferred response
+			_, err := responder.ChannelMessageSend(channelID, tr(lang, "Nothing to show"))
+			logErrorTS(debugTag, err)
+		}
+	}()
+
+	cmds := state.Commands()
+	if gCMDs, ok := state.GuildCommands(interaction.GuildID); ok {
+		cmds = gCMDs
+	}
+	command, found := cmds[cmdName]
+	if !found || (command.Type == "text" && command.Message == "") {
+		_, err = discordSend(responder, channelID, tr(lang, "This command is not available here"), true)
+		logErrorTS(debugTag, err)
+		return
+	}
+	username := fmt.Sprint(user)
+	userAddresses := state.AddressBook(username)
+	message := &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ID:        interaction.ID,
+			GuildID:   interaction.GuildID,
+			ChannelID: channelID,
+			Author:    user,
+			Member:    interaction.Member,
+			Content:   slashCommandText(data),
+		},
+	}
+	runCommand(&commandRequest{
+		Discord:       responder,
+		Message:       message,
+		Name:          cmdName,
+		GuildID:       interaction.GuildID,
+		ChannelID:     channelID,
+		Username:      username,
+		Prefix:        state.CommandPrefix(interaction.GuildID),
+		Lang:          lang,
+		IsPrivateMsg:  isPrivateMsg,
+		UserAddresses: userAddresses,
+		DebugTag:      debugTag,
+	}, command, nil, func(spec argSpec) (commandArgs, error) {
+		return slashArgs(spec, data.Options, userAddresses)
+	})
+}
+
+// slashCommandText returns the slash command as typed by the user. Eg: "/ticker quote-ticker:vet"
+func slashCommandText(data discordgo.ApplicationCommandInteractionData) string {
+	text := "/" + data.Name
+	for _, o := range data.Options {
+		text += fmt.Sprintf(" %s:%s", o.Name, optionValue(o))
+	}
+	return text
+}
+
+// optionValue returns the value of an option as text
+func optionValue(o *discordgo.ApplicationCommandInteractionDataOption) string {
+	switch o.Type {
+	case discordgo.ApplicationCommandOptionString:
+		return o.StringValue()
+	case discordgo.ApplicationCommandOptionInteger:
+		return strconv.FormatInt(o.IntValue(), 10)
+	case discordgo.ApplicationCommandOptionNumber:
+		return strconv.FormatFloat(o.FloatValue(), 'f', -1, 64)
+	}
+	return fmt.Sprint(o.Value)
+}
+
+// slashArgs validates the options of a slash command against the argument specification.
+// Each option is validated individually, as options may be supplied in any order or skipped.
+func slashArgs(spec argSpec, options []*discordgo.ApplicationCommandInteractionDataOption,
+	addresses []string) (commandArgs, error) {
+	values := map[string]string{}
+	for _, o := range options {
+		values[o.Name] = optionValue(o)
+	}
+	args := commandArgs{}
+	for _, el := range spec {
+		value := strings.TrimSpace(values[el.Name])
+		if value == "" {
+			if el.Required {
+				return nil, argErrorf("Argument required: <%s>", el.Name)
+			}
+			continue
+		}
+		line := tokenize(value)
+		if elementType(el) == argText && !el.Variadic {
+			// text is used as typed, including any quotes
+			line = commandLine{Args: []string{value}, raw: []string{value}}
+		}
+		el.Required = true
+		result, err := argSpec{el}.Parse(line, addresses)
+		if err != nil {
+			return nil, err
+		}
+		for name, v := range result {
+			args[name] = v
+		}
+	}
+	return args, nil
+}
+
+// autocompleteHandler suggests tickers and address book items for the option being typed
+func autocompleteHandler(discord InteractionMessenger, interaction *discordgo.Interaction, user *discordgo.User) {
+	data := interaction.ApplicationCommandData()
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	if builtin := findBuiltinCommand(data.Name); builtin != nil {
+		for _, o := range data.Options {
+			if !o.Focused {
+				continue
+			}
+			for _, el := range builtin.argSpec {
+				if el.Name == o.Name {
+					choices = autocompleteChoices(el, optionValue(o), fmt.Sprint(user))
+				}
+			}
+		}
+	}
+	err := discord.InteractionRespond(interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	logErrorTS("autocompleteHandler", err)
+}
+
+// autocompleteChoices suggests values of an argument. For repeated arguments, the last value is completed.
+func autocompleteChoices(el argElement, value, username string) []*discordgo.ApplicationCommandOptionChoice {
+	previous, query := "", strings.TrimSpace(value)
+	if i := strings.LastIndexFunc(value, unicode.IsSpace); el.Variadic && i >= 0 {
+		previous, query = value[:i+1], value[i+1:]
+	}
+	suggestions := []suggestion{}
+	switch elementType(el) {
+	case argTicker:
+		suggestions = tickerSuggestions(query)
+		break
+	case argAddress, argWallet, argIndex:
+		suggestions = addressSuggestions(query, username)
+		break
+	}
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, s := range suggestions {
+		if len(choices) == maxChoices {
+			break
+		}
+		if len(previous+s.Value) > maxDescriptionLength {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  limitText(previous+s.Name, maxDescriptionLength),
+			Value: previous + s.Value,
+		})
+	}
+	return choices
+}
+
+// tickerSuggestions returns the HaloDEX tokens followed by the cached CMC tickers starting with query
+func tickerSuggestions(query string) (suggestions []suggestion) {
+	query = strings.ToUpper(query)
+	added := map[string]bool{}
+	if tokens, err := state.DEX().GetTokens(); err == nil {
+		tickers := []string{}
+		for _, token := range tokens {
+			if strings.HasPrefix(strings.ToUpper(token.Ticker), query) {
+				tickers = append(tickers, token.Ticker)
+			}
+		}
+		sort.Strings(tickers)
+		for _, ticker := range tickers {
+			suggestions = append(suggestions, suggestion{fmt.Sprintf("%s (HaloDEX)", ticker), ticker})
+			added[strings.ToUpper(ticker)] = true
+		}
+	}
+	for _, t := range state.CMC().SearchTickers(query, maxChoices) {
+		if !added[strings.ToUpper(t.Symbol)] {
+			suggestions = append(suggestions, suggestion{fmt.Sprintf("%s (%s)", t.Symbol, t.Name), t.Symbol})
+			added[strings.ToUpper(t.Symbol)] = true
+		}
+	}
+	return
+}
+
+// addressSuggestions returns the user's address book items matching the item number or the start of the address
+func addressSuggestions(query, username string) (suggestions []suggestion) {
+	query = strings.ToLower(query)
+	for i, address := range state.AddressBook(username) {
+		number := fmt.Sprint(i + 1)
+		if strings.HasPrefix(number, query) || strings.HasPrefix(strings.ToLower(address), query) {
+			suggestions = append(suggestions, suggestion{number + ". " + address, number})
+		}
+	}
+	return
+}
+
+// interactionMessenger sends messages to the channel of an interaction as responses to the interaction
+type interactionMessenger struct {
+	InteractionMessenger
+	interaction *discordgo.Interaction
+	// eg: ephemeral messages are only visible to the user
+	flags discordgo.MessageFlags
+	mutex sync.Mutex
+	// IDs of the messages sent in response to the interaction
+	sent map[string]bool
+}
+
+// ChannelMessageSend sends a follow-up message if channel ID is the channel of the interaction
+func (m *interactionMessenger) ChannelMessageSend(channelID, content string,
+	options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if channelID != m.interaction.ChannelID {
+		return m.InteractionMessenger.ChannelMessageSend(channelID, content, options...)
+	}
+	msg, err := m.FollowupMessageCreate(m.interaction, true, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   m.flags,
+	}, options...)
+	if err == nil {
+		m.mutex.Lock()
+		m.sent[msg.ID] = true
+		m.mutex.Unlock()
+	}
+	return msg, err
+}
+
+// ChannelMessageSendComplex sends a follow-up message if channel ID is the channel of the interaction
+func (m *interactionMessenger) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend,
+	options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if channelID != m.interaction.ChannelID {
+		return m.InteractionMessenger.ChannelMessageSendComplex(channelID, data, options...)
+	}
+	msg, err := m.FollowupMessageCreate(m.interaction, true, &discordgo.WebhookParams{
+		Content:    data.Content,
+		Embeds:     data.Embeds,
+		Components: data.Components,
+		Flags:      m.flags,
+	}, options...)
+	if err == nil {
+		m.mutex.Lock()
+		m.sent[msg.ID] = true
+		m.mutex.Unlock()
+	}
+	return msg, err
+}
+
+// ChannelMessageEdit edits the follow-up message if sent in response to the interaction
+func (m *interactionMessenger) ChannelMessageEdit(channelID, messageID, content string,
+	options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	m.mutex.Lock()
+	isFollowup := m.sent[messageID]
+	m.mutex.Unlock()
+	if !isFollowup {
+		return m.InteractionMessenger.ChannelMessageEdit(channelID, messageID, content, options...)
+	}
+	return m.FollowupMessageEdit(m.interaction, messageID, &discordgo.WebhookEdit{Content: &content}, options...)
+}
+
+// ChannelMessageEditComplex edits the follow-up message if sent in response to the interaction
+func (m *interactionMessenger) ChannelMessageEditComplex(edit *discordgo.MessageEdit,
+	options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	m.mutex.Lock()
+	isFollowup := m.sent[edit.ID]
+	m.mutex.Unlock()
+	if !isFollowup {
+		return m.InteractionMessenger.ChannelMessageEditComplex(edit, options...)
+	}
+	return m.FollowupMessageEdit(m.interaction, edit.ID, &discordgo.WebhookEdit{
+		Content:    edit.Content,
+		Embeds:     &edit.Embeds,
+		Components: &edit.Components,
+	}, options...)
+}
+
+// replied returns whether any message has been sent in response to the interaction
+func (m *interactionMessenger) replied() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.sent) > 0
+}
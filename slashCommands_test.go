@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alien45/halo-info-bot/client"
+	"github.com/bwmarrin/discordgo"
+)
+
+// newInteraction constructs an application command interaction as received from Discord.
+// Leave guildID empty for private messages.
+func newInteraction(guildID, channelID, username string, interactionType discordgo.InteractionType, name string,
+	options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.Interaction {
+	msg := newMessageCreate(guildID, channelID, username, "")
+	interaction := &discordgo.Interaction{
+		ID:        msg.ID,
+		Type:      interactionType,
+		GuildID:   guildID,
+		ChannelID: channelID,
+		Data:      discordgo.ApplicationCommandInteractionData{Name: name, Options: options},
+	}
+	if guildID == "" {
+		interaction.User = msg.Author
+	} else {
+		interaction.Member = &discordgo.Member{GuildID: guildID, User: msg.Author}
+	}
+	return interaction
+}
+
+func stringOption(name, value string, focused bool) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:    name,
+		Type:    discordgo.ApplicationCommandOptionString,
+		Value:   value,
+		Focused: focused,
+	}
+}
+
+func TestApplicationCommands(t *testing.T) {
+	setupCommandTest(t)
+	appCommands := map[string]*discordgo.ApplicationCommand{}
+	for _, c := range applicationCommands(state.Commands()) {
+		if !applicationCommandNameRegex.MatchString(c.Name) || c.Description == "" || len(c.Description) > 100 {
+			t.Errorf("%s: invalid name or description: %q", c.Name, c.Description)
+		}
+		for _, o := range c.Options {
+			if !applicationCommandNameRegex.MatchString(o.Name) || o.Description == "" || len(o.Description) > 100 {
+				t.Errorf("%s %s: invalid option name or description: %q", c.Name, o.Name, o.Description)
+			}
+		}
+		appCommands[c.Name] = c
+	}
+	for _, c := range builtinCommands {
+		if appCommands[c.Name] == nil {
+			t.Errorf("%s: application command not generated", c.Name)
+		}
+	}
+
+	trades := appCommands["trades"].Options
+	if len(trades) != 4 || !trades[0].Autocomplete || trades[2].Type != discordgo.ApplicationCommandOptionInteger ||
+		*trades[2].MinValue != 1 || trades[2].MaxValue != 50 {
+		t.Fatalf("unexpected trades options: %+v", trades)
+	}
+	mn := appCommands["mn"].Options
+	if len(mn) != 1 || len(mn[0].Choices) != 5 || mn[0].Choices[1].Value != "nodes" {
+		t.Fatalf("unexpected mn options: %+v", mn)
+	}
+	guildCMD := appCommands[guildCMD].Options
+	if !guildCMD[0].Required || !guildCMD[1].Required || guildCMD[2].Required {
+		t.Fatalf("unexpected guildcmd options: %+v", guildCMD)
+	}
+}
+
+func TestSlashCommand(t *testing.T) {
+	fake := setupCommandTest(t)
+	interactionHandler(fake, newInteraction(testGuildID, testChannelID, "alice",
+		discordgo.InteractionApplicationCommand, "help", stringOption("command-name", "ticker", false)))
+	if len(fake.Responses) != 1 || fake.Responses[0].Type != discordgo.InteractionResponseDeferredChannelMessageWithSource {
+		t.Fatalf("expected deferred response, got: %+v", fake.Responses)
+	}
+	reply := fake.LastMessage(testChannelID)
+	if !strings.Contains(reply, "!ticker [quote-ticker] [base-ticker]") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if flags := fake.Flags[fake.Sent[0].ID]; flags != 0 {
+		t.Fatalf("public command reply should not be ephemeral")
+	}
+
+	// private commands are allowed in public channels with ephemeral replies
+	fake.Reset()
+	interactionHandler(fake, newInteraction(testGuildID, testChannelID, "alice",
+		discordgo.InteractionApplicationCommand, "address"))
+	reply = fake.LastMessage(testChannelID)
+	if !strings.Contains(reply, "No addresses available!") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if fake.Flags[fake.Sent[0].ID] != discordgo.MessageFlagsEphemeral ||
+		fake.Responses[0].Data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Fatal("private command reply should be ephemeral")
+	}
+
+	// options are validated individually
+	interactionHandler(fake, newInteraction("", testDMChannelID, "alice",
+		discordgo.InteractionApplicationCommand, "nodes", stringOption("address", "0x1234", false)))
+	reply = fake.LastMessage(testDMChannelID)
+	if !strings.Contains(reply, "Invalid address: 0x1234") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+}
+
+func TestSlashArgs(t *testing.T) {
+	setupCommandTest(t)
+	spec, err := parseArgSpec("[quote-ticker:ticker] [base-ticker:ticker] [limit:int(1,50)] [address:address...]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses := []string{"0x1111111111111111111111111111111111111111"}
+	args, err := slashArgs(spec, []*discordgo.ApplicationCommandInteractionDataOption{
+		stringOption("base-ticker", "btc", false),
+		stringOption("address", "1 0x2222222222222222222222222222222222222222", false),
+	}, addresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// skipped options must not shift the other arguments
+	if args.String("quote-ticker", "") != "" || args.String("base-ticker", "") != "BTC" ||
+		len(args.List("address")) != 2 || args.List("address")[0] != addresses[0] {
+		t.Fatalf("unexpected arguments: %v", args)
+	}
+}
+
+func TestAutocomplete(t *testing.T) {
+	fake := setupCommandTest(t)
+	dex := state.DEX()
+	dex.CachedTokens = map[string]client.Token{"HALO": {Ticker: "HALO"}, "ETH": {Ticker: "ETH"}}
+	dex.CachedTokenLastUpdated = time.Now()
+	dex.CachedTokenExpireMins = 10
+	state.CMC().CachedTickers = map[string]client.CMCTicker{
+		"HOT": {Symbol: "HOT", Name: "Holo", Rank: 2},
+		"HT":  {Symbol: "HT", Name: "Huobi Token", Rank: 1},
+	}
+	interactionHandler(fake, newInteraction(testGuildID, testChannelID, "alice",
+		discordgo.InteractionApplicationCommandAutocomplete, "ticker", stringOption("quote-ticker", "h", true)))
+	choices := fake.Responses[0].Data.Choices
+	if len(choices) != 3 || choices[0].Value != "HALO" || choices[1].Value != "HT" || choices[2].Value != "HOT" {
+		t.Fatalf("unexpected choices: %+v", choices)
+	}
+
+	address := "0x1111111111111111111111111111111111111111"
+	send(fake, "", testDMChannelID, "alice", "!address add "+address)
+	fake.Reset()
+	interactionHandler(fake, newInteraction(testGuildID, testChannelID, "alice",
+		discordgo.InteractionApplicationCommandAutocomplete, "nodes", stringOption("address", "0x2 ", true)))
+	choices = fake.Responses[0].Data.Choices
+	if len(choices) != 1 || choices[0].Value != "0x2 1" || choices[0].Name != "0x2 1. "+address {
+		t.Fatalf("unexpected choices: %+v", choices)
+	}
+}
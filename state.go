@@ -0,0 +1,534 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alien45/halo-info-bot/client"
+)
+
+// State is a concurrency-safe container for the bot's mutable data. The data is shared between the command
+// handlers, which run on a separate goroutine for each message, and the background tasks such as the payout checker.
+//
+// Discord data must only be accessed using the View and Update transactions.
+// Config, command lists and API clients are replaced as a whole and must not be modified once set.
+type State struct {
+	dataMutex sync.RWMutex
+	data      DiscordData
+
+	cmdMutex      sync.RWMutex
+	commands      Commands
+	guildCommands GuildCommands
+	// Commands names that are not allowed in the public chats. Key: command, value: unused.
+	privateCmds map[string]string
+
+	payoutMutex      sync.RWMutex
+	payoutTX         client.PayoutTX
+	payoutTXReceived bool
+	rewardPool       client.Payout
+	lastAlert        time.Time
+	lastPayoutCheck  time.Time
+
+	healthMutex      sync.RWMutex
+	connected        bool
+	connectedChanged time.Time
+
+	catalogMutex sync.RWMutex
+	// Message catalogs. Key: language code
+	catalogs map[string]*Catalog
+
+	clientMutex sync.RWMutex
+	config      *Config
+	prices      client.PriceSources
+	storage     Storage
+	session     Messenger
+	memberCache memberCache
+}
+
+// View invokes f with read-only access to the Discord data.
+// f must not modify the data or keep references to any of it's maps or slices after returning.
+func (s *State) View(f func(data *DiscordData)) {
+	s.dataMutex.RLock()
+	defer s.dataMutex.RUnlock()
+	f(&s.data)
+}
+
+// Update invokes f with exclusive access to the Discord data and saves the records modified by f, unless f returns
+// an error. Saves the entire Discord data if no records are supplied.
+func (s *State) Update(f func(data *DiscordData) error, records ...Record) (err error) {
+	s.dataMutex.Lock()
+	defer s.dataMutex.Unlock()
+	if err = f(&s.data); err != nil {
+		return
+	}
+	return s.Storage().SaveData(&s.data, records...)
+}
+
+// SetData replaces the Discord data. Nil maps are initialised.
+func (s *State) SetData(d DiscordData) {
+	initData(&d)
+	s.dataMutex.Lock()
+	defer s.dataMutex.Unlock()
+	s.data = d
+}
+
+// AddressBook returns a copy of the addresses saved by the user
+func (s *State) AddressBook(username string) (addresses []string) {
+	s.View(func(data *DiscordData) {
+		addresses = append(addresses, data.AddressBook[username]...)
+	})
+	return
+}
+
+// AddressKeyword returns the address for an address keyword. Eg: reward-pool
+func (s *State) AddressKeyword(keyword string) (address string, found bool) {
+	s.View(func(data *DiscordData) {
+		address, found = data.AddressKeywords[keyword]
+	})
+	return
+}
+
+// IsPrivacyException checks if a channel is allowed to use private commands
+func (s *State) IsPrivacyException(channelID string) (found bool) {
+	s.View(func(data *DiscordData) {
+		found = data.PrivacyExceptions[channelID] != ""
+	})
+	return
+}
+
+// GuildSettings returns the settings of a guild
+func (s *State) GuildSettings(guildID string) (settings GuildSettings) {
+	s.View(func(data *DiscordData) {
+		settings = data.Guilds[guildID]
+	})
+	return
+}
+
+// UpdateGuildSettings invokes f with the settings of a guild and saves the changes
+func (s *State) UpdateGuildSettings(guildID string, f func(settings *GuildSettings)) error {
+	return s.Update(func(data *DiscordData) error {
+		// the settings returned by GuildSettings must not be modified
+		settings := data.Guilds[guildID].clone()
+		f(&settings)
+		if settings.isEmpty() {
+			delete(data.Guilds, guildID)
+		} else {
+			data.Guilds[guildID] = settings
+		}
+		return nil
+	}, Record{bucketGuilds, guildID})
+}
+
+// UserSettings returns the settings of a user
+func (s *State) UserSettings(userID string) (settings UserSettings) {
+	s.View(func(data *DiscordData) {
+		settings = data.Users[userID]
+	})
+	return
+}
+
+// UpdateUserSettings invokes f with the settings of a user and saves the changes
+func (s *State) UpdateUserSettings(userID string, f func(settings *UserSettings)) error {
+	return s.Update(func(data *DiscordData) error {
+		settings := data.Users[userID]
+		f(&settings)
+		if settings.isEmpty() {
+			delete(data.Users, userID)
+		} else {
+			data.Users[userID] = settings
+		}
+		return nil
+	}, Record{bucketUsers, userID})
+}
+
+// Language returns the language of the replies to a user: the language of the user, the guild or the configured
+// language, in that order. Uses the default language if none set.
+func (s *State) Language(guildID, userID string) (lang string) {
+	s.View(func(data *DiscordData) {
+		if lang = data.Users[userID].Language; lang == "" {
+			lang = data.Guilds[guildID].Language
+		}
+	})
+	if lang == "" {
+		lang = s.Config().Client.DiscordBot.Language
+	}
+	if lang == "" {
+		lang = defaultLanguage
+	}
+	return
+}
+
+// CommandPrefix returns the command prefix of a guild or the configured prefix if not set
+func (s *State) CommandPrefix(guildID string) string {
+	if prefix := s.GuildSettings(guildID).Prefix; prefix != "" {
+		return prefix
+	}
+	return s.Config().Client.DiscordBot.Prefix
+}
+
+// PayoutAlertChannels returns a copy of the channels subscribed to payout alerts
+func (s *State) PayoutAlertChannels() (channels map[string]string) {
+	channels = map[string]string{}
+	s.View(func(data *DiscordData) {
+		for channelID, name := range data.Alerts.Payout {
+			channels[channelID] = name
+		}
+	})
+	return
+}
+
+// TradeAlertChannels returns a copy of the channels subscribed to large trade alerts
+func (s *State) TradeAlertChannels() (channels map[string]TradeAlert) {
+	channels = map[string]TradeAlert{}
+	s.View(func(data *DiscordData) {
+		for channelID, alert := range data.Alerts.Trades {
+			channels[channelID] = alert.clone()
+		}
+	})
+	return
+}
+
+// UpdateTradeAlert invokes f with the large trade alert subscription of a channel and saves the changes.
+// The subscription is removed if no pairs are left.
+func (s *State) UpdateTradeAlert(channelID string, f func(alert *TradeAlert)) error {
+	return s.Update(func(data *DiscordData) error {
+		alert := data.Alerts.Trades[channelID].clone()
+		f(&alert)
+		if len(alert.Pairs) == 0 {
+			delete(data.Alerts.Trades, channelID)
+		} else {
+			data.Alerts.Trades[channelID] = alert
+		}
+		return nil
+	}, Record{bucketTradeAlerts, channelID})
+}
+
+// TradeCursor returns the most recent trades of a pair processed by the trade watcher.
+// Found is false if the pair has not been watched before.
+func (s *State) TradeCursor(pair string) (cursor TradeCursor, found bool) {
+	s.View(func(data *DiscordData) {
+		cursor, found = data.TradeCursors[pair]
+	})
+	return
+}
+
+// SetTradeCursor replaces and saves the most recent trades of a pair processed by the trade watcher.
+// The slices of cursor must not be modified afterwards.
+func (s *State) SetTradeCursor(pair string, cursor TradeCursor) error {
+	return s.Update(func(data *DiscordData) error {
+		data.TradeCursors[pair] = cursor
+		return nil
+	}, Record{bucketTradeCursors, pair})
+}
+
+// PriceAlerts returns a copy of the price alerts of a user
+func (s *State) PriceAlerts(userID string) (alerts []PriceAlert) {
+	s.View(func(data *DiscordData) {
+		alerts = append(alerts, data.Alerts.Price[userID]...)
+	})
+	return
+}
+
+// AllPriceAlerts returns a copy of the price alerts of all users. Key: user ID
+func (s *State) AllPriceAlerts() (alerts map[string][]PriceAlert) {
+	alerts = map[string][]PriceAlert{}
+	s.View(func(data *DiscordData) {
+		for userID, userAlerts := range data.Alerts.Price {
+			alerts[userID] = append([]PriceAlert{}, userAlerts...)
+		}
+	})
+	return
+}
+
+// UpdatePriceAlerts replaces the price alerts of a user with the alerts returned by f and saves the changes.
+// f is invoked with a copy of the alerts.
+func (s *State) UpdatePriceAlerts(userID string, f func(alerts []PriceAlert) []PriceAlert) error {
+	return s.Update(func(data *DiscordData) error {
+		alerts := f(append([]PriceAlert{}, data.Alerts.Price[userID]...))
+		if len(alerts) == 0 {
+			delete(data.Alerts.Price, userID)
+		} else {
+			data.Alerts.Price[userID] = alerts
+		}
+		return nil
+	}, Record{bucketPriceAlerts, userID})
+}
+
+// LastPayout returns the last payout
+func (s *State) LastPayout() (p client.Payout) {
+	s.View(func(data *DiscordData) {
+		p = data.LastPayout
+	})
+	return
+}
+
+// SetLastPayout replaces and saves the last payout.
+// The maps of p must not be modified afterwards.
+func (s *State) SetLastPayout(p client.Payout) error {
+	return s.Update(func(data *DiscordData) error {
+		data.LastPayout = p
+		return nil
+	}, Record{bucketSettings, recordLastPayout})
+}
+
+// HostingFeeUSD returns the monthly hosting fee per masternode. Uses the configured fee if not overridden.
+func (s *State) HostingFeeUSD() (fee float64) {
+	s.View(func(data *DiscordData) {
+		fee = data.HostingFeeUSD
+	})
+	if fee <= 0 {
+		fee = s.MNDApp().HostingFeeUSD
+	}
+	return
+}
+
+// SetCommands replaces the default, guild specific and private command lists
+func (s *State) SetCommands(commands Commands, guildCommands GuildCommands, privateCmds map[string]string) {
+	s.cmdMutex.Lock()
+	defer s.cmdMutex.Unlock()
+	s.commands = commands
+	s.guildCommands = guildCommands
+	s.privateCmds = privateCmds
+}
+
+// Commands returns the default commands (including global info commands)
+func (s *State) Commands() Commands {
+	s.cmdMutex.RLock()
+	defer s.cmdMutex.RUnlock()
+	return s.commands
+}
+
+// GuildCommands returns the guild specific list of commands, if available
+func (s *State) GuildCommands(guildID string) (cmds Commands, found bool) {
+	s.cmdMutex.RLock()
+	defer s.cmdMutex.RUnlock()
+	cmds, found = s.guildCommands[guildID]
+	return
+}
+
+// IsPrivateCommand checks if a command is not allowed in the public chats
+func (s *State) IsPrivateCommand(cmdName string) (found bool) {
+	s.cmdMutex.RLock()
+	defer s.cmdMutex.RUnlock()
+	_, found = s.privateCmds[cmdName]
+	return
+}
+
+// PayoutTX returns the payout transaction received and whether it is yet to be processed
+func (s *State) PayoutTX() (tx client.PayoutTX, received bool) {
+	s.payoutMutex.RLock()
+	defer s.payoutMutex.RUnlock()
+	return s.payoutTX, s.payoutTXReceived
+}
+
+// SetPayoutTX sets the payout transaction to be processed
+func (s *State) SetPayoutTX(tx client.PayoutTX) {
+	s.payoutMutex.Lock()
+	defer s.payoutMutex.Unlock()
+	s.payoutTX = tx
+	s.payoutTXReceived = true
+}
+
+// PayoutTXProcessed marks the received payout transaction as processed
+func (s *State) PayoutTXProcessed() {
+	s.payoutMutex.Lock()
+	defer s.payoutMutex.Unlock()
+	s.payoutTXReceived = false
+}
+
+// RewardPool returns the last retrieved reward pool balances
+func (s *State) RewardPool() client.Payout {
+	s.payoutMutex.RLock()
+	defer s.payoutMutex.RUnlock()
+	return s.rewardPool
+}
+
+// SetRewardPool updates the reward pool balances
+func (s *State) SetRewardPool(minted, fees float64, t time.Time) {
+	s.payoutMutex.Lock()
+	defer s.payoutMutex.Unlock()
+	s.rewardPool.Minted = minted
+	s.rewardPool.Fees = fees
+	s.rewardPool.Time = t
+}
+
+// LastAlert returns the time of the last payout alert
+func (s *State) LastAlert() time.Time {
+	s.payoutMutex.RLock()
+	defer s.payoutMutex.RUnlock()
+	return s.lastAlert
+}
+
+// SetLastAlert sets the time of the last payout alert
+func (s *State) SetLastAlert(t time.Time) {
+	s.payoutMutex.Lock()
+	defer s.payoutMutex.Unlock()
+	s.lastAlert = t
+}
+
+// LastPayoutCheck returns the time of the last successful payout check
+func (s *State) LastPayoutCheck() time.Time {
+	s.payoutMutex.RLock()
+	defer s.payoutMutex.RUnlock()
+	return s.lastPayoutCheck
+}
+
+// SetLastPayoutCheck sets the time of the last successful payout check
+func (s *State) SetLastPayoutCheck(t time.Time) {
+	s.payoutMutex.Lock()
+	defer s.payoutMutex.Unlock()
+	s.lastPayoutCheck = t
+}
+
+// Connected returns whether the Discord session is connected and the time the connection state last changed
+func (s *State) Connected() (connected bool, since time.Time) {
+	s.healthMutex.RLock()
+	defer s.healthMutex.RUnlock()
+	return s.connected, s.connectedChanged
+}
+
+// SetConnected sets the Discord connection state
+func (s *State) SetConnected(connected bool) {
+	s.healthMutex.Lock()
+	defer s.healthMutex.Unlock()
+	if s.connected != connected || s.connectedChanged.IsZero() {
+		s.connectedChanged = time.Now()
+	}
+	s.connected = connected
+}
+
+// SetConfig replaces the configuration along with the API clients.
+// The config must not be modified once set. Fails without any changes if the price sources are invalid.
+func (s *State) SetConfig(c *Config) error {
+	prices, err := newPriceSources(c)
+	if err != nil {
+		return err
+	}
+	s.clientMutex.Lock()
+	defer s.clientMutex.Unlock()
+	s.config = c
+	s.prices = prices
+	client.HTTP.Configure(c.HTTP)
+	return nil
+}
+
+// SetCatalogs replaces the message catalogs
+func (s *State) SetCatalogs(catalogs map[string]*Catalog) {
+	s.catalogMutex.Lock()
+	defer s.catalogMutex.Unlock()
+	s.catalogs = catalogs
+}
+
+// Catalog returns the message catalog of a language. Returns the English catalog if not found.
+func (s *State) Catalog(lang string) *Catalog {
+	s.catalogMutex.RLock()
+	defer s.catalogMutex.RUnlock()
+	if c, found := s.catalogs[lang]; found {
+		return c
+	}
+	return englishCatalog
+}
+
+// HasLanguage checks if a language is supported
+func (s *State) HasLanguage(lang string) bool {
+	s.catalogMutex.RLock()
+	defer s.catalogMutex.RUnlock()
+	_, found := s.catalogs[lang]
+	return found || lang == defaultLanguage
+}
+
+// Languages returns the codes of the supported languages, sorted
+func (s *State) Languages() []string {
+	s.catalogMutex.RLock()
+	defer s.catalogMutex.RUnlock()
+	languages := []string{defaultLanguage}
+	for lang := range s.catalogs {
+		if lang != defaultLanguage {
+			languages = append(languages, lang)
+		}
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Config returns the configuration
+func (s *State) Config() *Config {
+	s.clientMutex.RLock()
+	defer s.clientMutex.RUnlock()
+	return s.config
+}
+
+// CMC returns the CoinMarketCap API client
+func (s *State) CMC() *client.CMC {
+	return &s.Config().Client.CMC
+}
+
+// DEX returns the HaloDEX API client
+func (s *State) DEX() *client.DEX {
+	return &s.Config().Client.DEX
+}
+
+// MNDApp returns the Masternodes DApp API client
+func (s *State) MNDApp() *client.MNDApp {
+	return &s.Config().Client.MNDApp
+}
+
+// Prices returns the USD price sources in the configured order of priority
+func (s *State) Prices() client.PriceSources {
+	s.clientMutex.RLock()
+	defer s.clientMutex.RUnlock()
+	return s.prices
+}
+
+// Explorer returns the Halo Explorer API client
+func (s *State) Explorer() *client.Explorer {
+	return &s.Config().Client.Explorer
+}
+
+// Etherscan returns the Etherscan API client
+func (s *State) Etherscan() *client.Etherscan {
+	return &s.Config().Client.Etherscan
+}
+
+// SetStorage sets the storage used to load and save data
+func (s *State) SetStorage(storage Storage) {
+	s.clientMutex.Lock()
+	defer s.clientMutex.Unlock()
+	s.storage = storage
+}
+
+// Storage returns the storage used to load and save data
+func (s *State) Storage() Storage {
+	s.clientMutex.RLock()
+	defer s.clientMutex.RUnlock()
+	return s.storage
+}
+
+// SetSession sets the Discord session used by the background tasks and debug messages
+func (s *State) SetSession(session Messenger) {
+	s.clientMutex.Lock()
+	defer s.clientMutex.Unlock()
+	s.session = session
+}
+
+// SetMemberCache sets the cache used to look up guild members and roles
+func (s *State) SetMemberCache(cache memberCache) {
+	s.clientMutex.Lock()
+	defer s.clientMutex.Unlock()
+	s.memberCache = cache
+}
+
+// MemberCache returns the cache of guild members and roles. Nil if not available.
+func (s *State) MemberCache() memberCache {
+	s.clientMutex.RLock()
+	defer s.clientMutex.RUnlock()
+	return s.memberCache
+}
+
+// Session returns the Discord session. Nil until connected.
+func (s *State) Session() Messenger {
+	s.clientMutex.RLock()
+	defer s.clientMutex.RUnlock()
+	return s.session
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFakeAPIServer serves minimal responses for CMC, HaloDEX and Halo RPC (eth_call) requests
+func newFakeAPIServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodPost:
+			// Halo RPC
+			fmt.Fprint(w, `{"result": "0x3635c9adc5dea00000"}`)
+		case strings.HasPrefix(path, "/cryptocurrency/listings/latest"):
+			fmt.Fprint(w, `{
+				"status": { "error_code": 0, "credit_count": 1 },
+				"data": [
+					{ "name": "Ethereum", "symbol": "ETH", "total_supply": 100, "quote": { "USD": { "price": 200 } } },
+					{ "name": "Halo Platform", "symbol": "HALO", "total_supply": 100, "quote": { "USD": { "price": 0.01 } } }
+				]
+			}`)
+		case path == "/dex/public/tokens":
+			fmt.Fprint(w, `[
+				{ "ticker": "HALO", "name": "Halo", "type": "TOKEN", "decimals": 18 },
+				{ "ticker": "ETH", "name": "Ethereum", "type": "BASE", "decimals": 18 }
+			]`)
+		case path == "/dex/public/pricing/all":
+			fmt.Fprint(w, `[{ "pair": "HALO/ETH", "quoteTicker": "HALO", "baseTicker": "ETH", "last": "0.00005" }]`)
+		case path == "/assets":
+			fmt.Fprint(w, `{ "timestamp": 1546300800000, "data": [
+				{ "id": "ethereum", "symbol": "ETH", "supply": "100", "priceUsd": "150" },
+				{ "id": "ethereum-classic", "symbol": "ETC", "supply": "100", "priceUsd": "5" }
+			]}`)
+		case path == "/dex/account/balances/0xabcdef":
+			fmt.Fprint(w, `[
+				{ "ticker": "HALO", "balance": "1000", "available": "750" },
+				{ "ticker": "eth", "balance": "0", "available": "0" }
+			]`)
+		case strings.HasPrefix(path, "/dex/account/balances/"):
+			fmt.Fprint(w, `[]`)
+		case strings.HasPrefix(path, "/dex/market/trades/"):
+			fmt.Fprint(w, `{ "total": "1", "trades": [
+				{ "id": 1, "price": "0.00005", "amountReceived": "1000", "amountSent": "0.05", "side": "sell",
+				  "blockTimestamp": "2019-01-01T00:00:00Z" }
+			]}`)
+		case strings.HasPrefix(path, "/dex/market/orders/") && r.URL.Query().Get("user") != "":
+			if r.URL.Query().Get("user") != "0xabcdef" {
+				fmt.Fprint(w, `{ "orders": [] }`)
+				return
+			}
+			ts := time.Now().Add(-90 * time.Minute).UTC().Format(time.RFC3339)
+			fmt.Fprintf(w, `{ "orders": [
+				{ "price": "0.000048", "amountReceived": "1000", "amountSent": "0.048", "filled": "250", "side": "buy",
+				  "blockTimestamp": "%s" },
+				{ "price": "0.000051", "amountReceived": "0.153", "amountSent": "3000", "side": "sell",
+				  "blockTimestamp": "%s" },
+				{ "price": "0.00006", "amountReceived": "0.06", "amountSent": "1000", "filled": "1000", "side": "sell",
+				  "blockTimestamp": "%s" }
+			]}`, ts, time.Now().Add(-26*time.Hour).UTC().Format(time.RFC3339), ts)
+		case strings.HasPrefix(path, "/dex/market/orders/") && r.URL.Query().Get("side") == "buy":
+			fmt.Fprint(w, `{ "orders": [
+				{ "price": "0.000048", "amountReceived": "1000", "amountSent": "0.048" },
+				{ "price": "0.0000495", "amountReceived": "2000", "amountSent": "0.099", "filled": "500" },
+				{ "price": "0.0000495", "amountReceived": "500", "amountSent": "0.02475" },
+				{ "price": "0.000049", "amountReceived": "100", "amountSent": "0.0049", "deleted": true }
+			]}`)
+		case strings.HasPrefix(path, "/dex/market/orders/"):
+			fmt.Fprint(w, `{ "orders": [
+				{ "price": "0.000051", "amountReceived": "0.153", "amountSent": "3000" },
+				{ "price": "0.0000505", "amountReceived": "0.0505", "amountSent": "1000" },
+				{ "price": "0.00006", "amountReceived": "0.06", "amountSent": "1000", "filled": "1000" }
+			]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestConcurrentCommandsAndPayoutCheck(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "butleradmin", "id-admin")
+	server := newFakeAPIServer()
+	defer server.Close()
+	c := state.Config()
+	// expire caches immediately to update them as often as possible
+	c.Client.CMC.BaseURL = server.URL
+	c.Client.CMC.APIKEY = "test"
+	c.Client.CMC.DailyCreditLimit = 333
+	c.Client.DEX.BaseURL = server.URL
+	c.Client.MNDApp.MainnetGQL = server.URL
+	c.Client.MNDApp.BlockReward = 30400
+	c.Client.MNDApp.BlockTimeMins = 4
+	state.SetConfig(c)
+
+	messages := []struct{ guildID, channelID, username, content string }{
+		{testGuildID, testChannelID, "alice", "!ticker"},
+		{testGuildID, testChannelID, "alice", "!trades halo eth 5"},
+		{testGuildID, testChannelID, "alice", "!orderbook halo eth 5"},
+		{testGuildID, testChannelID, "alice", "!halo"},
+		{testGuildID, testChannelID, "alice", "!tokens halo"},
+		{testGuildID, testChannelID, "alice", "!cmc eth"},
+		{testGuildID, testChannelID, "alice", "!eth"},
+		{testGuildID, testChannelID, "alice", "!mn"},
+		{testGuildID, testChannelID, "alice", "!mn nodes"},
+		{testGuildID, testChannelID, "alice", "!help"},
+		{testGuildID, testChannelID, "alice", "!alert payout status"},
+		{testGuildID, testChannelID, "admin", "!alert payout on"},
+		{testGuildID, testChannelID, "admin", "!alert payout off"},
+		{testGuildID, testChannelID, "admin", "!guildcmd add hello Hello"},
+		{testGuildID, testChannelID, "alice", "!hello"},
+		{"", testDMChannelID, "root", "!alert payout hostingfee 20"},
+		{"", testDMChannelID, "alice", "!address add 0x1234"},
+		{"", testDMChannelID, "alice", "!address"},
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkPayout(fake)
+		}()
+		for _, m := range messages {
+			wg.Add(1)
+			go func(guildID, channelID, username, content string) {
+				defer wg.Done()
+				commandHandler(fake, newMessageCreate(guildID, channelID, username, content))
+			}(m.guildID, m.channelID, m.username, m.content)
+		}
+	}
+	wg.Wait()
+
+	if state.HostingFeeUSD() != 20 {
+		t.Fatalf("unexpected hosting fee: %f", state.HostingFeeUSD())
+	}
+	if rp := state.RewardPool(); rp.Minted != 1000 {
+		t.Fatalf("unexpected reward pool minted balance: %f", rp.Minted)
+	}
+}
+
+func TestPriceSourceFallback(t *testing.T) {
+	fake := setupCommandTest(t)
+	server := newFakeAPIServer()
+	defer server.Close()
+	c := state.Config()
+	// CMC API key not set
+	c.Client.CMC.BaseURL = server.URL
+	c.Client.CoinCap.BaseURL = server.URL
+	c.Client.DEX.BaseURL = server.URL
+	state.SetConfig(c)
+
+	reply := send(fake, testGuildID, testChannelID, "alice", "!ticker halo eth")
+	if !strings.Contains(reply, "ETH: $150.00000000 by CoinCap @ 2019-01-01 00:00:00 UTC") {
+		t.Fatalf("expected fallback to CoinCap: %q", reply)
+	}
+	p, err := state.Prices().GetPrice("HALO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(p.USD-0.0075) > 1e-9 || p.Source != "HaloDEX (ETH by CoinCap)" {
+		t.Fatalf("unexpected DEX derived price: %+v", p)
+	}
+
+	c.PriceSources = []string{"dex"}
+	state.SetConfig(c)
+	if _, err = state.Prices().GetPrice("HALO"); err == nil {
+		t.Fatal("expected error when no source available for the base token")
+	}
+	c.PriceSources = []string{"cmc", "unknown"}
+	if err = state.SetConfig(c); err == nil {
+		t.Fatal("expected error for unsupported price source")
+	}
+	if n := len(state.Prices()); n != 1 {
+		t.Fatalf("price sources replaced despite the error: %d", n)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alien45/halo-info-bot/client"
+)
+
+// Storage persists the Discord data, payout log, audit log and the processing status of payout transactions
+type Storage interface {
+	// LoadData reads the Discord data
+	LoadData() (DiscordData, error)
+	// SaveData saves the supplied records of the Discord data. Saves everything if no record supplied.
+	SaveData(data *DiscordData, records ...Record) error
+	// AddPayoutLog appends a payout to the payout log
+	AddPayoutLog(p client.Payout) error
+	// PayoutTXs returns the payout transactions received by the alert receiver, oldest first
+	PayoutTXs() ([]client.PayoutTX, error)
+	// SetPayoutTXProcessed marks a payout transaction as processed
+	SetPayoutTXProcessed(tx client.PayoutTX) error
+	// AddAuditEntry appends an entry to the audit log
+	AddAuditEntry(e AuditEntry) error
+	// AuditEntries returns up to limit most recent entries of the audit log matching the filter, oldest first
+	AuditEntries(filter func(AuditEntry) bool, limit int) ([]AuditEntry, error)
+	// Close releases any resources used by the storage
+	Close() error
+}
+
+// Names of the Discord data record groups (buckets)
+const (
+	// Keys: recordHostingFee, recordLastPayout etc.
+	bucketSettings = "settings"
+	// Keys: username
+	bucketAddressBook = "addressbook"
+	// Keys: channel ID
+	bucketPayoutAlerts = "alerts.payout"
+	// Keys: channel ID
+	bucketTradeAlerts = "alerts.trades"
+	// Keys: pair. Eg: HALO/ETH
+	bucketTradeCursors = "tradecursors"
+	// Keys: user ID
+	bucketPriceAlerts = "alerts.price"
+	// Keys: guild ID
+	bucketGuildCommands = "guildinfocmds"
+	// Keys: channel ID
+	bucketPrivacyExceptions = "privacyexceptions"
+	// Keys: guild ID
+	bucketGuilds = "guilds"
+	// Keys: user ID
+	bucketUsers = "users"
+)
+
+// Keys of the settings bucket
+const (
+	recordHostingFee         = "hostingfeeusd"
+	recordLastPayout         = "lastpayout"
+	recordAddressKeywords    = "addresskeywords"
+	recordInfo               = "info"
+	recordGlobalInfoCommands = "globalinfocmds"
+)
+
+// dataBuckets lists the buckets used to store the Discord data
+var dataBuckets = []string{
+	bucketSettings,
+	bucketAddressBook,
+	bucketPayoutAlerts,
+	bucketTradeAlerts,
+	bucketTradeCursors,
+	bucketPriceAlerts,
+	bucketGuildCommands,
+	bucketPrivacyExceptions,
+	bucketGuilds,
+	bucketUsers,
+}
+
+// Record identifies a single item of the Discord data that can be saved independently. Eg: user's address book.
+type Record struct {
+	Bucket string
+	Key    string
+}
+
+// getValue returns the value of a record. Exists is false if the item does not exist (ie: has been deleted).
+func (r Record) getValue(data *DiscordData) (value interface{}, exists bool, err error) {
+	switch r.Bucket {
+	case bucketSettings:
+		exists = true
+		switch r.Key {
+		case recordHostingFee:
+			value = data.HostingFeeUSD
+		case recordLastPayout:
+			value = data.LastPayout
+		case recordAddressKeywords:
+			value = data.AddressKeywords
+		case recordInfo:
+			value = data.Info
+		case recordGlobalInfoCommands:
+			value = data.GlobalInfoCommands
+		default:
+			exists = false
+			err = fmt.Errorf("Unknown settings record: %s", r.Key)
+		}
+	case bucketAddressBook:
+		value, exists = data.AddressBook[r.Key]
+	case bucketPayoutAlerts:
+		value, exists = data.Alerts.Payout[r.Key]
+	case bucketTradeAlerts:
+		value, exists = data.Alerts.Trades[r.Key]
+	case bucketTradeCursors:
+		value, exists = data.TradeCursors[r.Key]
+	case bucketPriceAlerts:
+		value, exists = data.Alerts.Price[r.Key]
+	case bucketGuildCommands:
+		value, exists = data.GuildInfoCommands[r.Key]
+	case bucketPrivacyExceptions:
+		value, exists = data.PrivacyExceptions[r.Key]
+	case bucketGuilds:
+		value, exists = data.Guilds[r.Key]
+	case bucketUsers:
+		value, exists = data.Users[r.Key]
+	default:
+		err = fmt.Errorf("Unknown record bucket: %s", r.Bucket)
+	}
+	return
+}
+
+// setValue decodes and sets the JSON encoded value of a record
+func (r Record) setValue(data *DiscordData, value []byte) (err error) {
+	switch r.Bucket {
+	case bucketSettings:
+		switch r.Key {
+		case recordHostingFee:
+			return json.Unmarshal(value, &data.HostingFeeUSD)
+		case recordLastPayout:
+			return json.Unmarshal(value, &data.LastPayout)
+		case recordAddressKeywords:
+			return json.Unmarshal(value, &data.AddressKeywords)
+		case recordInfo:
+			return json.Unmarshal(value, &data.Info)
+		case recordGlobalInfoCommands:
+			return json.Unmarshal(value, &data.GlobalInfoCommands)
+		}
+		// ignore unknown settings
+		return
+	case bucketAddressBook:
+		addresses := []string{}
+		err = json.Unmarshal(value, &addresses)
+		data.AddressBook[r.Key] = addresses
+	case bucketPayoutAlerts:
+		name := ""
+		err = json.Unmarshal(value, &name)
+		data.Alerts.Payout[r.Key] = name
+	case bucketTradeAlerts:
+		alert := TradeAlert{}
+		err = json.Unmarshal(value, &alert)
+		data.Alerts.Trades[r.Key] = alert
+	case bucketTradeCursors:
+		cursor := TradeCursor{}
+		err = json.Unmarshal(value, &cursor)
+		data.TradeCursors[r.Key] = cursor
+	case bucketPriceAlerts:
+		alerts := []PriceAlert{}
+		err = json.Unmarshal(value, &alerts)
+		data.Alerts.Price[r.Key] = alerts
+	case bucketGuildCommands:
+		cmds := Commands{}
+		err = json.Unmarshal(value, &cmds)
+		data.GuildInfoCommands[r.Key] = cmds
+	case bucketPrivacyExceptions:
+		name := ""
+		err = json.Unmarshal(value, &name)
+		data.PrivacyExceptions[r.Key] = name
+	case bucketGuilds:
+		settings := GuildSettings{}
+		err = json.Unmarshal(value, &settings)
+		data.Guilds[r.Key] = settings
+	case bucketUsers:
+		settings := UserSettings{}
+		err = json.Unmarshal(value, &settings)
+		data.Users[r.Key] = settings
+	default:
+		err = fmt.Errorf("Unknown record bucket: %s", r.Bucket)
+	}
+	return
+}
+
+// allRecords returns all records of the Discord data
+func allRecords(data *DiscordData) (records []Record) {
+	for _, key := range []string{
+		recordHostingFee,
+		recordLastPayout,
+		recordAddressKeywords,
+		recordInfo,
+		recordGlobalInfoCommands,
+	} {
+		records = append(records, Record{bucketSettings, key})
+	}
+	for key := range data.AddressBook {
+		records = append(records, Record{bucketAddressBook, key})
+	}
+	for key := range data.Alerts.Payout {
+		records = append(records, Record{bucketPayoutAlerts, key})
+	}
+	for key := range data.Alerts.Trades {
+		records = append(records, Record{bucketTradeAlerts, key})
+	}
+	for key := range data.TradeCursors {
+		records = append(records, Record{bucketTradeCursors, key})
+	}
+	for key := range data.Alerts.Price {
+		records = append(records, Record{bucketPriceAlerts, key})
+	}
+	for key := range data.GuildInfoCommands {
+		records = append(records, Record{bucketGuildCommands, key})
+	}
+	for key := range data.PrivacyExceptions {
+		records = append(records, Record{bucketPrivacyExceptions, key})
+	}
+	for key := range data.Guilds {
+		records = append(records, Record{bucketGuilds, key})
+	}
+	for key := range data.Users {
+		records = append(records, Record{bucketUsers, key})
+	}
+	return
+}
+
+// initData initialises nil maps of the Discord data
+func initData(d *DiscordData) {
+	if d.AddressBook == nil {
+		d.AddressBook = map[string][]string{}
+	}
+	if d.AddressKeywords == nil {
+		d.AddressKeywords = map[string]string{}
+	}
+	if d.Alerts.Payout == nil {
+		d.Alerts.Payout = map[string]string{}
+	}
+	if d.Alerts.Trades == nil {
+		d.Alerts.Trades = map[string]TradeAlert{}
+	}
+	if d.Alerts.Price == nil {
+		d.Alerts.Price = map[string][]PriceAlert{}
+	}
+	if d.TradeCursors == nil {
+		d.TradeCursors = map[string]TradeCursor{}
+	}
+	if d.GuildInfoCommands == nil {
+		d.GuildInfoCommands = GuildCommands{}
+	}
+	if d.PrivacyExceptions == nil {
+		d.PrivacyExceptions = map[string]string{}
+	}
+	if d.Guilds == nil {
+		d.Guilds = map[string]GuildSettings{}
+	}
+	if d.Users == nil {
+		d.Users = map[string]UserSettings{}
+	}
+}
+
+// openStorage opens the storage backend specified in the config
+func openStorage(c *Config) (Storage, error) {
+	switch strings.ToLower(c.Storage.Type) {
+	case "json":
+		return newJSONStorage(dataFile, payoutLogFile, payoutsTXFile, auditLogFile), nil
+	case "", "bolt":
+		path := c.Storage.Path
+		if path == "" {
+			path = databaseFile
+		}
+		return openBoltStorage(path, dataFile, payoutLogFile, payoutsTXFile)
+	}
+	return nil, fmt.Errorf("Unsupported storage type: %s", c.Storage.Type)
+}
+
+// jsonStorage stores data in JSON files. Every change rewrites the entire file, except for the audit log which is
+// appended to.
+type jsonStorage struct {
+	dataFile      string
+	payoutLogFile string
+	payoutsTXFile string
+	auditLogFile  string
+}
+
+func newJSONStorage(dataFile, payoutLogFile, payoutsTXFile, auditLogFile string) *jsonStorage {
+	return &jsonStorage{
+		dataFile:      dataFile,
+		payoutLogFile: payoutLogFile,
+		payoutsTXFile: payoutsTXFile,
+		auditLogFile:  auditLogFile,
+	}
+}
+
+// LoadData reads the Discord data file
+func (s *jsonStorage) LoadData() (d DiscordData, err error) {
+	str, err := client.ReadFile(s.dataFile)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(str), &d)
+	initData(&d)
+	return
+}
+
+// SaveData writes the entire Discord data file regardless of the records supplied
+func (s *jsonStorage) SaveData(data *DiscordData, records ...Record) error {
+	return client.SaveJSONFile(s.dataFile, data)
+}
+
+// AddPayoutLog appends a payout to the payout log file
+func (s *jsonStorage) AddPayoutLog(p client.Payout) (err error) {
+	payouts, err := readPayoutLog(s.payoutLogFile)
+	if err != nil {
+		return
+	}
+	payouts = append(payouts, p)
+	return client.SaveJSONFileLarge(s.payoutLogFile, payouts)
+}
+
+// PayoutTXs reads the payout transactions file
+func (s *jsonStorage) PayoutTXs() ([]client.PayoutTX, error) {
+	return readPayoutTXs(s.payoutsTXFile)
+}
+
+// SetPayoutTXProcessed marks the payout transaction as processed in the payout transactions file
+func (s *jsonStorage) SetPayoutTXProcessed(tx client.PayoutTX) (err error) {
+	payoutsTX, err := readPayoutTXs(s.payoutsTXFile)
+	if err != nil {
+		return
+	}
+	for i := range payoutsTX {
+		if payoutTXKey(payoutsTX[i]) == payoutTXKey(tx) {
+			payoutsTX[i].Processed = true
+		}
+	}
+	return client.SaveJSONFileLarge(s.payoutsTXFile, payoutsTX)
+}
+
+// AddAuditEntry appends an entry to the audit log file
+func (s *jsonStorage) AddAuditEntry(e AuditEntry) error {
+	return appendAuditLog(s.auditLogFile, e)
+}
+
+// AuditEntries reads the audit log file
+func (s *jsonStorage) AuditEntries(filter func(AuditEntry) bool, limit int) ([]AuditEntry, error) {
+	return readAuditLog(s.auditLogFile, filter, limit)
+}
+
+// Close does nothing
+func (s *jsonStorage) Close() error {
+	return nil
+}
+
+// readPayoutLog reads the payout log file. Returns empty list if file is empty.
+func readPayoutLog(filename string) (payouts []client.Payout, err error) {
+	str, err := client.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	if str == "" {
+		str = "[]"
+	}
+	err = json.Unmarshal([]byte(str), &payouts)
+	return
+}
+
+// readPayoutTXs reads the payout transactions file created by the alert receiver
+func readPayoutTXs(filename string) (payoutsTX []client.PayoutTX, err error) {
+	str, err := client.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(str), &payoutsTX)
+	return
+}
+
+// payoutTXKey returns an unique key for a payout transaction
+func payoutTXKey(tx client.PayoutTX) string {
+	if tx.Hash != "" {
+		return tx.Hash
+	}
+	return fmt.Sprint(tx.BlockNumber)
+}
+
+// fileExists checks if a file exists
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
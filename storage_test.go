@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alien45/halo-info-bot/client"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "halo-info-bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestBoltStorageMigration(t *testing.T) {
+	dir := tempDir(t)
+	dataPath := filepath.Join(dir, "discord.json")
+	logPath := filepath.Join(dir, "payout-log.json")
+	txPath := filepath.Join(dir, "payouts.json")
+	dbPath := filepath.Join(dir, "discord.db")
+	files := map[string]string{
+		dataPath: `{
+			"addressbook": { "alice#0001": ["0x1234"] },
+			"alerts": { "payout": { "channel-1": "guild-1#channel-1@admin|id-admin" } },
+			"hostingfeeusd": 20
+		}`,
+		logPath: `[{ "minted": 1000 }, { "minted": 2000 }]`,
+		txPath:  `[{ "hash": "0xa", "processed": true }, { "hash": "0xb" }]`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := openBoltStorage(dbPath, dataPath, logPath, txPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.LoadData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.HostingFeeUSD != 20 || len(d.AddressBook["alice#0001"]) != 1 || len(d.Alerts.Payout) != 1 {
+		t.Fatalf("data not migrated: %+v", d)
+	}
+	payoutsTX, err := s.PayoutTXs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payoutsTX) != 2 || !payoutsTX[0].Processed || payoutsTX[1].Processed {
+		t.Fatalf("unexpected payout transactions: %+v", payoutsTX)
+	}
+
+	// update individual records
+	d.AddressBook["bob#0001"] = []string{"0x5678"}
+	delete(d.Alerts.Payout, "channel-1")
+	err = s.SaveData(&d, Record{bucketAddressBook, "bob#0001"}, Record{bucketPayoutAlerts, "channel-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.SetPayoutTXProcessed(payoutsTX[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// changes to the JSON files after migration must not be imported again
+	if err = ioutil.WriteFile(dataPath, []byte(`{ "hostingfeeusd": 50 }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err = openBoltStorage(dbPath, dataPath, logPath, txPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	d, err = s.LoadData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.HostingFeeUSD != 20 || len(d.AddressBook) != 2 || len(d.Alerts.Payout) != 0 {
+		t.Fatalf("unexpected data after reopening: %+v", d)
+	}
+	if payoutsTX, err = s.PayoutTXs(); err != nil {
+		t.Fatal(err)
+	}
+	if !payoutsTX[1].Processed {
+		t.Fatal("payout transaction not marked as processed")
+	}
+}
+
+func TestJSONStorageShrinkingFiles(t *testing.T) {
+	dir := tempDir(t)
+	logPath := filepath.Join(dir, "payout-log.json")
+	txPath := filepath.Join(dir, "payouts.json")
+	longHash := "0x" + strings.Repeat("f", 64)
+	err := client.SaveJSONFileLarge(txPath, []client.PayoutTX{{Hash: longHash}, {Hash: "0xa"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.SaveJSONFileLarge(txPath, []client.PayoutTX{{Hash: "0xa"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newJSONStorage(filepath.Join(dir, "discord.json"), logPath, txPath, filepath.Join(dir, "audit-log.jsonl"))
+	if err = s.SetPayoutTXProcessed(client.PayoutTX{Hash: "0xa"}); err != nil {
+		t.Fatal(err)
+	}
+	payoutsTX, err := s.PayoutTXs()
+	if err != nil {
+		t.Fatalf("file corrupted after writing less data: %v", err)
+	}
+	if len(payoutsTX) != 1 || !payoutsTX[0].Processed {
+		t.Fatalf("unexpected payout transactions: %+v", payoutsTX)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	dir := tempDir(t)
+	bolt, err := openBoltStorage(filepath.Join(dir, "discord.db"), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+	storages := map[string]Storage{
+		"json": newJSONStorage("", "", "", filepath.Join(dir, "audit-log.jsonl")),
+		"bolt": bolt,
+	}
+	for name, s := range storages {
+		for i := 1; i <= 5; i++ {
+			guildID := "guild-1"
+			if i%2 == 0 {
+				guildID = "guild-2"
+			}
+			if err = s.AddAuditEntry(AuditEntry{GuildID: guildID, Action: "test", Target: fmt.Sprint(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		entries, err := s.AuditEntries(func(e AuditEntry) bool { return e.GuildID == "guild-1" }, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].Target != "3" || entries[1].Target != "5" {
+			t.Fatalf("%s: unexpected entries: %+v", name, entries)
+		}
+	}
+}
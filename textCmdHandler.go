@@ -2,11 +2,9 @@ package main
 
 import (
 	"strings"
-
-	"github.com/bwmarrin/discordgo"
 )
 
-func textCmdHandler(discord *discordgo.Session, guildID, channelID, debugTag string, command Command, args []string, numArgs int) {
+func textCmdHandler(discord Messenger, guildID, channelID, debugTag string, command Command, args []string, numArgs int) {
 	text := command.Message
 	arg := Argument{}
 	ok := false
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// closing quotes by opening quote. Includes the quotes inserted by mobile keyboards.
+var quotePairs = map[rune]rune{
+	'"': '"',
+	'“': '”',
+}
+
+// commandLine is a command message split into arguments
+type commandLine struct {
+	Args []string
+	// raw text of the message starting at each argument
+	raw []string
+}
+
+// tokenize splits text into arguments separated by any whitespace, including line breaks.
+// Double quoted text is a single argument. Use \" to include a quote within a quoted argument.
+// An unterminated quote includes the rest of the text.
+func tokenize(text string) (line commandLine) {
+	i := 0
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+		start := i
+		arg := strings.Builder{}
+		for i < len(text) {
+			r, size = utf8.DecodeRuneInString(text[i:])
+			if unicode.IsSpace(r) {
+				break
+			}
+			closing, isQuote := quotePairs[r]
+			i += size
+			if !isQuote {
+				arg.WriteRune(r)
+				continue
+			}
+			// quoted text
+			for i < len(text) {
+				r, size = utf8.DecodeRuneInString(text[i:])
+				i += size
+				if r == closing {
+					break
+				}
+				if r == '\\' && strings.HasPrefix(text[i:], string(closing)) {
+					r, size = closing, utf8.RuneLen(closing)
+					i += size
+				}
+				arg.WriteRune(r)
+			}
+		}
+		line.Args = append(line.Args, arg.String())
+		line.raw = append(line.raw, strings.TrimRightFunc(text[start:], unicode.IsSpace))
+	}
+	return
+}
+
+// Remainder returns the text starting at the argument i, preserving whitespace, quotes and formatting such as
+// code blocks. If i is the last argument, returns the unquoted argument.
+func (l commandLine) Remainder(i int) string {
+	if i >= len(l.Args) {
+		return ""
+	}
+	if i == len(l.Args)-1 {
+		return l.Args[i]
+	}
+	return l.raw[i]
+}
+
+// shift returns the first argument and the rest of the command line
+func (l commandLine) shift() (first string, rest commandLine) {
+	if len(l.Args) == 0 {
+		return
+	}
+	return l.Args[0], commandLine{Args: l.Args[1:], raw: l.raw[1:]}
+}
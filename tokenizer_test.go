@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"!cmc  power   ledger", []string{"!cmc", "power", "ledger"}},
+		{"!address add 0x1\n0x2\t0x3 ", []string{"!address", "add", "0x1", "0x2", "0x3"}},
+		{`!cmc "power ledger"`, []string{"!cmc", "power ledger"}},
+		{`!guildcmd add quote "say \"hi\""`, []string{"!guildcmd", "add", "quote", `say "hi"`}},
+		{"!cmc “power ledger”", []string{"!cmc", "power ledger"}},
+		{`!cmc "power ledger`, []string{"!cmc", "power ledger"}},
+		{`!cmc a""b`, []string{"!cmc", "ab"}},
+		{"   ", nil},
+	}
+	for _, test := range tests {
+		if args := tokenize(test.text).Args; !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("%q: expected %q, got %q", test.text, test.expected, args)
+		}
+	}
+
+	line := tokenize("!guildcmd add rules \"Rules\":\n```\n1. Be  nice\n```\n")
+	if r := line.Remainder(3); r != "\"Rules\":\n```\n1. Be  nice\n```" {
+		t.Fatalf("unexpected remainder: %q", r)
+	}
+	if r := line.Remainder(len(line.Args)); r != "" {
+		t.Fatalf("unexpected remainder: %q", r)
+	}
+	if r := tokenize(`!guildcmd add hi "Hello there"`).Remainder(3); r != "Hello there" {
+		t.Fatalf("single quoted argument should be unquoted: %q", r)
+	}
+}
+
+func TestGuildCMDKeepsFormatting(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "ButlerAdmin", "id-admin")
+	message := "Rules:\n```\n1.  Be nice\n2.  No spam\n```"
+	reply := send(fake, testGuildID, testChannelID, "admin", "!guildcmd  add rules "+message)
+	if !strings.Contains(reply, "added") {
+		t.Fatalf("unexpected reply: %q", reply)
+	}
+	if reply = send(fake, testGuildID, testChannelID, "alice", "!rules"); reply != message {
+		t.Fatalf("formatting not preserved: %q", reply)
+	}
+}
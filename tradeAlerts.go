@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alien45/halo-info-bot/client"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// minimum USD value of the alerted trades if not supplied
+	defaultTradeAlertUSD = 5000
+	// number of most recent trades retrieved for each watched pair on every check
+	tradeFetchLimit = 50
+	// trades older than this are not alerted. Eg: trades made while the bot was offline.
+	tradeAlertMaxAge = time.Hour
+	// duration between checks for new trades
+	tradeCheckInterval = 60 * time.Second
+)
+
+// TradeAlert is the subscription of a channel to the large trades of HaloDEX pairs
+type TradeAlert struct {
+	// Subscriber. Format: guildID#channelID@username|userID
+	Name string `json:"name"`
+	// Minimum USD value of the alerted trades by pair. Eg: HALO/ETH
+	Pairs map[string]float64 `json:"pairs"`
+}
+
+// clone returns a copy that does not share the pairs
+func (a TradeAlert) clone() TradeAlert {
+	pairs := map[string]float64{}
+	for pair, minUSD := range a.Pairs {
+		pairs[pair] = minUSD
+	}
+	a.Pairs = pairs
+	return a
+}
+
+// sortedPairs returns the watched pairs in alphabetical order
+func (a TradeAlert) sortedPairs() (pairs []string) {
+	for pair := range a.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return
+}
+
+// TradeCursor records the most recent trades of a pair processed by the trade watcher. Trades are identified by ID
+// or, if the ID is unavailable, by transaction hash.
+type TradeCursor struct {
+	LastID int64 `json:"lastid"`
+	// Transaction hashes of the most recent trades without ID
+	TxHashes []string `json:"txhashes,omitempty"`
+}
+
+// newTrades returns the trades not processed yet, oldest first, along with the updated cursor.
+// Trades must be sorted newest first.
+func (c TradeCursor) newTrades(trades []client.Trade) (unseen []client.Trade, next TradeCursor) {
+	seen := map[string]bool{}
+	for _, hash := range c.TxHashes {
+		seen[hash] = true
+	}
+	next.LastID = c.LastID
+	for i := len(trades) - 1; i >= 0; i-- {
+		trade := trades[i]
+		if trade.ID == 0 {
+			if trade.TxHash == "" {
+				continue
+			}
+			next.TxHashes = append(next.TxHashes, trade.TxHash)
+			if seen[trade.TxHash] {
+				continue
+			}
+		} else if trade.ID <= c.LastID {
+			continue
+		} else if trade.ID > next.LastID {
+			next.LastID = trade.ID
+		}
+		unseen = append(unseen, trade)
+	}
+	return
+}
+
+var tradeWatcherOnce sync.Once
+
+// startTradeWatcher checks for large trades of the watched pairs periodically. Subsequent invocations are ignored.
+func startTradeWatcher(discord Messenger) {
+	tradeWatcherOnce.Do(func() {
+		go func() {
+			for range time.Tick(tradeCheckInterval) {
+				checkTrades(discord)
+			}
+		}()
+	})
+}
+
+// checkTrades retrieves the most recent trades of the watched pairs and sends alerts for the new trades.
+// Trades are only recorded on the first check of a pair. A trade not alerted to any of the channels, eg: Discord is
+// unavailable, is retried along with the newer trades on the next check, unless too old by then. Failures of some of
+// the channels are not retried, as the other channels would receive the alert again.
+func checkTrades(discord Messenger) {
+	debugTag := "CheckTrades"
+	channels := state.TradeAlertChannels()
+	pairs := map[string]bool{}
+	for _, alert := range channels {
+		for pair := range alert.Pairs {
+			pairs[pair] = true
+		}
+	}
+	for pair := range pairs {
+		tickers := strings.SplitN(pair, "/", 2)
+		if len(tickers) != 2 {
+			continue
+		}
+		// the USD value is required to compare with the minimum value of the subscriptions
+		basePrice, err := state.Prices().GetPrice(tickers[1])
+		if logErrorTS(debugTag, err) {
+			continue
+		}
+		trades, err := state.DEX().GetTrades(tickers[0], tickers[1], tradeFetchLimit, 1, basePrice.USD)
+		if logErrorTS(debugTag, err) {
+			continue
+		}
+		cursor, found := state.TradeCursor(pair)
+		unseen, next := cursor.newTrades(trades)
+		for _, trade := range unseen {
+			if !found || time.Since(trade.Time) > tradeAlertMaxAge {
+				continue
+			}
+			if success, fail := sendTradeAlerts(discord, pair, trade, channels); success == 0 && fail > 0 {
+				// only the older trades are processed
+				_, next = cursor.newTrades(olderTrades(trades, trade))
+				break
+			}
+		}
+		logErrorTS(debugTag, state.SetTradeCursor(pair, next))
+	}
+}
+
+// olderTrades returns the trades older than the trade. Trades must be sorted newest first.
+func olderTrades(trades []client.Trade, trade client.Trade) []client.Trade {
+	for i := range trades {
+		if trades[i].ID == trade.ID && trades[i].TxHash == trade.TxHash {
+			return trades[i+1:]
+		}
+	}
+	return trades
+}
+
+// sendTradeAlerts sends a trade alert to the channels subscribed to the pair with a minimum value less than or equal
+// to the USD value of the trade
+func sendTradeAlerts(discord Messenger, pair string, trade client.Trade, channels map[string]TradeAlert) (success,
+	fail int) {
+	valueUSD := trade.Amount * trade.PriceUSD
+	tickers := strings.SplitN(pair, "/", 2)
+	txURL := explorerURL("tx", trade.TxHash)
+	for channelID, alert := range channels {
+		minUSD, found := alert.Pairs[pair]
+		if !found || valueUSD < minUSD {
+			continue
+		}
+		txt := trade.FormatAlert(localizer(alertLanguage(alert.Name)), tickers[0], tickers[1], txURL)
+		if _, err := discordSend(discord, channelID, txt, false); err != nil {
+			logTS("TradeAlert", fmt.Sprintf("Trade Alert Failed! Channel ID: %s, Name: %s, Error: %v", channelID,
+				alert.Name, err))
+			fail++
+			continue
+		}
+		success++
+	}
+	logTS("TradeAlertSummary", fmt.Sprintf("Pair: %s | Trade: %d | Value: $%.2f | Success: %d | Failure: %d", pair,
+		trade.ID, valueUSD, success, fail))
+	metricTradeAlerts.Add(float64(success), "success")
+	metricTradeAlerts.Add(float64(fail), "fail")
+	return
+}
+
+// cmdTradeAlert turns large trade alerts of a pair on or off in the channel or shows the watched pairs.
+// Turning off without a pair stops all trade alerts of the channel.
+func cmdTradeAlert(discord Messenger, message *discordgo.MessageCreate, channelID, username, lang, debugTag,
+	action string, args commandArgs, allowed bool) {
+	guildID, userID := message.GuildID, message.Author.ID
+	txt := ""
+	quote, base := args.String("quote-ticker", ""), args.String("base-ticker", "")
+	pair := ""
+	minUSD := float64(defaultTradeAlertUSD)
+	before := state.TradeAlertChannels()[channelID]
+	var after TradeAlert
+	var err error
+	if values := args.Floats("value"); len(values) > 0 {
+		minUSD = values[0]
+	}
+	if action == "status" {
+		txt = formatTradeAlert(lang, before)
+		goto SendMessage
+	}
+	if !allowed {
+		txt = tr(lang, "You do not have permission to enable alerts on this channel.")
+		goto SendMessage
+	}
+	if quote != "" || action == "on" {
+		tokens, err := state.DEX().GetTokens()
+		if commandErrorIf(err, discord, channelID, tr(lang, "Failed to retrieve tokens"), debugTag) {
+			return
+		}
+		if quote == "" {
+			quote = "HALO"
+		}
+		if base == "" {
+			base = "ETH"
+		}
+		if tokens[quote].Ticker == "" || tokens[base].Ticker == "" {
+			txt = tr(lang, "Invalid pair supplied: %s/%s", quote, base)
+			goto SendMessage
+		}
+		pair = quote + "/" + base
+	}
+
+	switch action {
+	case "on":
+		if minUSD <= 0 {
+			txt = tr(lang, "Minimum trade value must be greater than zero")
+			goto SendMessage
+		}
+		err = state.UpdateTradeAlert(channelID, func(alert *TradeAlert) {
+			alert.Name = fmt.Sprintf("%s#%s@%s|%s", guildID, channelID, username, userID)
+			alert.Pairs[pair] = minUSD
+		})
+		break
+	case "off":
+		err = state.UpdateTradeAlert(channelID, func(alert *TradeAlert) {
+			if pair == "" {
+				alert.Pairs = nil
+				return
+			}
+			delete(alert.Pairs, pair)
+		})
+		break
+	}
+	if commandErrorIf(err, discord, channelID, tr(lang, "Failed to save preferences"), debugTag) {
+		return
+	}
+	after = state.TradeAlertChannels()[channelID]
+	if guildID != "" {
+		audit(discord, message, "alert trades "+action, "#"+channelID, auditTradeAlert(before), auditTradeAlert(after))
+	}
+	txt = formatTradeAlert(lang, after)
+SendMessage:
+	_, err = discordSend(discord, channelID, txt, true)
+	logErrorTS(debugTag, err)
+}
+
+// formatTradeAlert lists the watched pairs of a trade alert subscription with the minimum USD value of the trades
+func formatTradeAlert(lang string, alert TradeAlert) string {
+	if len(alert.Pairs) == 0 {
+		return tr(lang, "Trade alert is turned off")
+	}
+	s := tr(lang, "Trade alert is turned on for:") + "\n"
+	for _, pair := range alert.sortedPairs() {
+		s += tr(lang, " - %s: trades worth $%s or more\n", pair, formatNumber(lang, alert.Pairs[pair], 2))
+	}
+	return s
+}
+
+// auditTradeAlert returns the watched pairs and minimum values of a trade alert subscription. Eg: HALO/ETH>=5000
+func auditTradeAlert(alert TradeAlert) string {
+	items := []string{}
+	for _, pair := range alert.sortedPairs() {
+		items = append(items, fmt.Sprintf("%s>=%v", pair, alert.Pairs[pair]))
+	}
+	return strings.Join(items, ", ")
+}
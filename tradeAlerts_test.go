@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTradeAlerts(t *testing.T) {
+	fake := setupCommandTest(t)
+	fake.AddRole(testGuildID, "ButlerAdmin", "id-admin")
+	fallback := newFakeAPIServer()
+	defer fallback.Close()
+	var mu sync.Mutex
+	trades := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/dex/market/trades/") {
+			fallback.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, `{ "total": "%d", "trades": [%s]}`, len(trades), strings.Join(trades, ","))
+	}))
+	defer server.Close()
+	addTrade := func(id int, amount string, age time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		// newest first
+		trades = append([]string{fmt.Sprintf(`{ "id": %d, "price": "0.00005", "amountReceived": "%s",
+			"side": "sell", "txHash": "0x%d", "blockTimestamp": "%s" }`, id, amount, id,
+			time.Now().Add(-age).UTC().Format(time.RFC3339))}, trades...)
+	}
+	c := state.Config()
+	c.Client.CMC.BaseURL = server.URL
+	c.Client.CMC.APIKEY = "test"
+	c.Client.CMC.DailyCreditLimit = 333
+	c.Client.DEX.BaseURL = server.URL
+	c.Client.Explorer.Homepage = "https://explorer.example"
+	state.SetConfig(c)
+
+	reply := send(fake, testGuildID, testChannelID, "bob", "!alert trades on halo eth 1000")
+	if !strings.Contains(reply, "You do not have permission") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!alert trades on halo xyz")
+	if !strings.Contains(reply, "Invalid pair supplied: HALO/XYZ") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	reply = send(fake, testGuildID, testChannelID, "admin", "!alert trades on halo eth 1000")
+	if !strings.Contains(reply, "Trade alert is turned on for:\n - HALO/ETH: trades worth $1,000.00 or more") {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	if reply = send(fake, "", testDMChannelID, "alice", "!alert trades on"); !strings.Contains(reply, "$5,000.00") {
+		t.Fatalf("default minimum value expected: %s", reply)
+	}
+
+	// trades made before the first check are not alerted
+	addTrade(1, "1000000", time.Minute)
+	checkTrades(fake)
+	fake.Reset()
+	addTrade(2, "1000000", 2*time.Hour)
+	addTrade(3, "1000", time.Minute)
+	addTrade(4, "300000", time.Minute)
+	checkTrades(fake)
+	msgs := fake.Messages(testChannelID)
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "+ BUY 300,000.00 HALO @ 0.00005000 ETH") ||
+		!strings.Contains(msgs[0], "Total : 15.0000 ETH | $3,000.00") ||
+		!strings.HasSuffix(msgs[0], "https://explorer.example/tx/0x4") {
+		t.Fatalf("unexpected alerts: %q", msgs)
+	}
+	if msgs = fake.Messages(testDMChannelID); len(msgs) != 0 {
+		t.Fatalf("trade below the minimum value alerted: %q", msgs)
+	}
+
+	// processed trades are not alerted again, even after a restart
+	checkTrades(fake)
+	if err := loadData(); err != nil {
+		t.Fatal(err)
+	}
+	checkTrades(fake)
+	if msgs = fake.Messages(testChannelID); len(msgs) != 1 {
+		t.Fatalf("duplicate alerts: %q", msgs)
+	}
+
+	// trades not alerted to any channel are retried on the next check
+	fake.FailChannels[testChannelID] = true
+	addTrade(5, "300000", time.Minute)
+	addTrade(6, "400000", time.Minute)
+	checkTrades(fake)
+	delete(fake.FailChannels, testChannelID)
+	if msgs = fake.Messages(testChannelID); len(msgs) != 1 {
+		t.Fatalf("unexpected alerts: %q", msgs)
+	}
+	checkTrades(fake)
+	msgs = fake.Messages(testChannelID)
+	if len(msgs) != 3 || !strings.HasSuffix(msgs[1], "/tx/0x5") || !strings.HasSuffix(msgs[2], "/tx/0x6") {
+		t.Fatalf("failed alerts not retried: %q", msgs)
+	}
+
+	reply = send(fake, testGuildID, testChannelID, "admin", "!alert trades off")
+	if !strings.Contains(reply, "Trade alert is turned off") || len(state.TradeAlertChannels()) != 1 {
+		t.Fatalf("unexpected reply: %s", reply)
+	}
+	entries, err := state.Storage().AuditEntries(func(e AuditEntry) bool { return true }, 10)
+	if err != nil || len(entries) != 2 || entries[1].Before != "HALO/ETH>=1000" {
+		t.Fatalf("unexpected audit entries: %+v, %v", entries, err)
+	}
+}